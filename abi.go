@@ -0,0 +1,110 @@
+package main
+
+import (
+	"debug/dwarf"
+
+	"github.com/ksrnnb/godbg/frame"
+)
+
+// integer registers which results are assigned to by the Go internal ABI on amd64, in DWARF register numbers.
+// they are RAX, RBX, RCX, RDI, RSI, R8, R9, R10 and R11 in order.
+// @see https://go.dev/s/regabi
+var abiIntRegisters = []uint64{0, 3, 2, 5, 4, 8, 9, 10, 11}
+
+// X0 to X14 are floating point registers for results.
+const numABIFloatRegisters = 15
+
+// abiAssigner assigns values to registers by the Go internal ABI.
+type abiAssigner struct {
+	nextInt   int
+	nextFloat int
+}
+
+// assignResults returns pieces of registers where results of types are after the function returns.
+// the pieces of the result are nil if it is assigned to the stack, which may be overwritten after the return,
+// or if the type of a preceding result is unknown.
+func assignResults(types []dwarf.Type) [][]frame.Piece {
+	var a abiAssigner
+	results := make([][]frame.Piece, len(types))
+	for i, t := range types {
+		if t == nil {
+			// registers of following results are not known without the type
+			break
+		}
+
+		saved := a
+		pieces := []frame.Piece{}
+		if !a.assign(t, &pieces) {
+			// the result is assigned to the stack, and registers are used by following results
+			a = saved
+			continue
+		}
+		results[i] = pieces
+	}
+
+	return results
+}
+
+// assign appends pieces of t to pieces, and reports whether t is assigned to registers.
+func (a *abiAssigner) assign(t dwarf.Type, pieces *[]frame.Piece) bool {
+	for {
+		typedef, ok := t.(*dwarf.TypedefType)
+		if !ok {
+			break
+		}
+		t = typedef.Type
+	}
+
+	size := t.Size()
+	switch t := t.(type) {
+	case *dwarf.StructType:
+		var offset int64
+		for _, field := range t.Field {
+			if field.ByteOffset > offset {
+				*pieces = append(*pieces, frame.Piece{Kind: frame.ImmPiece, Size: int(field.ByteOffset - offset)})
+			}
+			if !a.assign(field.Type, pieces) {
+				return false
+			}
+			offset = field.ByteOffset + field.Type.Size()
+		}
+		if size > offset {
+			*pieces = append(*pieces, frame.Piece{Kind: frame.ImmPiece, Size: int(size - offset)})
+		}
+		return true
+	case *dwarf.ArrayType:
+		switch t.Count {
+		case 0:
+			return true
+		case 1:
+			return a.assign(t.Type, pieces)
+		}
+		return false
+	case *dwarf.ComplexType:
+		return a.assignFloat(size/2, pieces) && a.assignFloat(size/2, pieces)
+	case *dwarf.FloatType:
+		return a.assignFloat(size, pieces)
+	}
+
+	if size == 0 {
+		return true
+	}
+	if size < 0 || size > 8 || a.nextInt >= len(abiIntRegisters) {
+		return false
+	}
+	*pieces = append(*pieces, frame.Piece{Kind: frame.RegPiece, Size: int(size), RegNum: abiIntRegisters[a.nextInt]})
+	a.nextInt++
+
+	return true
+}
+
+// assignFloat appends the piece of the next floating point register.
+func (a *abiAssigner) assignFloat(size int64, pieces *[]frame.Piece) bool {
+	if a.nextFloat >= numABIFloatRegisters {
+		return false
+	}
+	*pieces = append(*pieces, frame.Piece{Kind: frame.RegPiece, Size: int(size), RegNum: DwarfRegXMM0 + uint64(a.nextFloat)})
+	a.nextFloat++
+
+	return true
+}
@@ -0,0 +1,231 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+)
+
+// ErrClosed is returned when the connection is closed before the response is received.
+var ErrClosed = errors.New("connection is closed")
+
+// Event is a notification from the server.
+type Event struct {
+	Method string
+	// State is set by StoppedEvent
+	State *State
+	// Exited is set by ExitedEvent
+	Exited *Exited
+}
+
+// Client calls methods of the server. Messages are JSON values delimited by newlines.
+type Client struct {
+	conn    net.Conn
+	onEvent func(Event)
+
+	mu      sync.Mutex
+	nextID  uint64
+	pending map[uint64]chan Response
+	closed  bool
+}
+
+// Dial connects to the server, e.g. Dial("unix", "/tmp/godbg.sock", nil).
+// onEvent is called for each notification in the order they are received.
+func Dial(network, address string, onEvent func(Event)) (*Client, error) {
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewClient(conn, onEvent), nil
+}
+
+func NewClient(conn net.Conn, onEvent func(Event)) *Client {
+	c := &Client{conn: conn, onEvent: onEvent, pending: make(map[uint64]chan Response)}
+	go c.readLoop()
+	return c
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+func (c *Client) readLoop() {
+	scanner := bufio.NewScanner(c.conn)
+	// source listing and disassembly may be long
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+
+	for scanner.Scan() {
+		var msg struct {
+			Response
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			continue
+		}
+
+		if msg.Method != "" {
+			c.handleEvent(msg.Method, msg.Params)
+			continue
+		}
+
+		id, err := strconv.ParseUint(string(msg.ID), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		c.mu.Lock()
+		ch, ok := c.pending[id]
+		delete(c.pending, id)
+		c.mu.Unlock()
+
+		if ok {
+			ch <- msg.Response
+		}
+	}
+
+	// calls waiting for responses fail
+	c.mu.Lock()
+	c.closed = true
+	for id, ch := range c.pending {
+		close(ch)
+		delete(c.pending, id)
+	}
+	c.mu.Unlock()
+}
+
+func (c *Client) handleEvent(method string, params json.RawMessage) {
+	if c.onEvent == nil {
+		return
+	}
+
+	event := Event{Method: method}
+	switch method {
+	case StoppedEvent:
+		event.State = &State{}
+		json.Unmarshal(params, event.State)
+	case ExitedEvent:
+		event.Exited = &Exited{}
+		json.Unmarshal(params, event.Exited)
+	}
+
+	c.onEvent(event)
+}
+
+// call calls the method and decodes the result into result if it is not nil.
+func (c *Client) call(method string, params any, result any) error {
+	p, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return ErrClosed
+	}
+	c.nextID++
+	id := c.nextID
+	ch := make(chan Response, 1)
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	req, err := json.Marshal(Request{JSONRPC: "2.0", ID: json.RawMessage(strconv.FormatUint(id, 10)), Method: method, Params: p})
+	if err != nil {
+		return err
+	}
+
+	if _, err := c.conn.Write(append(req, '\n')); err != nil {
+		return fmt.Errorf("failed to send request: %s", err)
+	}
+
+	res, ok := <-ch
+	if !ok {
+		return ErrClosed
+	}
+
+	if res.Error != nil {
+		return res.Error
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	return json.Unmarshal(res.Result, result)
+}
+
+// CreateBreakpoint sets breakpoint at the location of break command.
+// Addr of the result is 0 if the breakpoint is pending until a library is loaded.
+func (c *Client) CreateBreakpoint(location string) (Breakpoint, error) {
+	var bp Breakpoint
+	err := c.call(CreateBreakpointMethod, CreateBreakpointParams{Location: location}, &bp)
+	return bp, err
+}
+
+func (c *Client) ClearBreakpoint(addr uint64) error {
+	return c.call(ClearBreakpointMethod, ClearBreakpointParams{Addr: addr}, nil)
+}
+
+func (c *Client) Breakpoints() ([]Breakpoint, error) {
+	var bps []Breakpoint
+	err := c.call(BreakpointsMethod, struct{}{}, &bps)
+	return bps, err
+}
+
+// Continue continues the process until it stops.
+func (c *Client) Continue() (State, error) {
+	var state State
+	err := c.call(ContinueMethod, struct{}{}, &state)
+	return state, err
+}
+
+// Step steps by kind (StepNext, StepIn, StepOut or StepInstruction).
+func (c *Client) Step(kind string) (State, error) {
+	var state State
+	err := c.call(StepMethod, StepParams{Kind: kind}, &state)
+	return state, err
+}
+
+func (c *Client) State() (State, error) {
+	var state State
+	err := c.call(StateMethod, struct{}{}, &state)
+	return state, err
+}
+
+// Stacktrace returns frames of the goroutine, or the current goroutine if goroutine is 0.
+func (c *Client) Stacktrace(goroutine uint64) ([]Frame, error) {
+	var frames []Frame
+	err := c.call(StacktraceMethod, StacktraceParams{Goroutine: goroutine}, &frames)
+	return frames, err
+}
+
+func (c *Client) Eval(expr string) (Variable, error) {
+	var v Variable
+	err := c.call(EvalMethod, EvalParams{Expr: expr}, &v)
+	return v, err
+}
+
+func (c *Client) Goroutines() ([]Goroutine, error) {
+	var goroutines []Goroutine
+	err := c.call(GoroutinesMethod, struct{}{}, &goroutines)
+	return goroutines, err
+}
+
+// Command runs a command of the REPL and returns its output.
+func (c *Client) Command(line string) (string, error) {
+	var result CommandResult
+	err := c.call(CommandMethod, CommandParams{Line: line}, &result)
+	return result.Output, err
+}
+
+// Interrupt stops the process resumed by another request, which returns where the process stops.
+// it does nothing if the process is not running.
+func (c *Client) Interrupt() error {
+	return c.call(InterruptMethod, struct{}{}, nil)
+}
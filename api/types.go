@@ -0,0 +1,163 @@
+package api
+
+import "encoding/json"
+
+// Version is the prefix of methods, which is changed when the API is changed incompatibly.
+const Version = "v1"
+
+// methods of the API
+const (
+	CreateBreakpointMethod = Version + ".createBreakpoint"
+	ClearBreakpointMethod  = Version + ".clearBreakpoint"
+	BreakpointsMethod      = Version + ".breakpoints"
+	ContinueMethod         = Version + ".continue"
+	StepMethod             = Version + ".step"
+	StateMethod            = Version + ".state"
+	StacktraceMethod       = Version + ".stacktrace"
+	EvalMethod             = Version + ".eval"
+	GoroutinesMethod       = Version + ".goroutines"
+	CommandMethod          = Version + ".command"
+	// InterruptMethod stops the running process, and it is handled while another request resumes the process
+	InterruptMethod = Version + ".interrupt"
+)
+
+// notifications sent by the server
+const (
+	// StoppedEvent is sent with State when the process stops
+	StoppedEvent = Version + ".stopped"
+	// ExitedEvent is sent with Exited when the process exits or is killed by a signal
+	ExitedEvent = Version + ".exited"
+)
+
+// kinds of step
+const (
+	StepNext        = "next"
+	StepIn          = "stepin"
+	StepOut         = "stepout"
+	StepInstruction = "instruction"
+)
+
+// error codes of JSON-RPC 2.0
+const (
+	ParseErrorCode     = -32700
+	InvalidRequestCode = -32600
+	MethodNotFoundCode = -32601
+	InvalidParamsCode  = -32602
+	// ServerErrorCode is returned when the debugger fails to handle the request
+	ServerErrorCode = -32000
+)
+
+// Request is a request or a notification (without ID) of JSON-RPC 2.0.
+type Request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// Response is a response of JSON-RPC 2.0.
+type Response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+type Breakpoint struct {
+	Addr     uint64 `json:"addr"`
+	Function string `json:"function"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Enabled  bool   `json:"enabled"`
+}
+
+// State is where the stopped process is.
+type State struct {
+	Pid       int    `json:"pid"`
+	PC        uint64 `json:"pc"`
+	Function  string `json:"function"`
+	File      string `json:"file"`
+	Line      int    `json:"line"`
+	Goroutine uint64 `json:"goroutine"`
+	// Breakpoint is true if the process stops at a breakpoint
+	Breakpoint bool `json:"breakpoint"`
+	// Signal is the name of the signal (e.g. SIGSEGV) if the process is stopped by it
+	Signal string `json:"signal,omitempty"`
+	// Exited is set instead of where the process is if it has terminated
+	Exited *Exited `json:"exited,omitempty"`
+	// Output is what the debugger prints while the process runs (e.g. signals, forks and return values of stepout),
+	// which is set only in the result of the request resuming the process
+	Output string `json:"output,omitempty"`
+}
+
+// Exited is how the process terminates.
+type Exited struct {
+	// Status is the exit status, which is 0 if the process is killed
+	Status int `json:"status"`
+	// Signal is the name of the signal (e.g. SIGSEGV) if the process is killed by it
+	Signal string `json:"signal,omitempty"`
+}
+
+type Frame struct {
+	PC       uint64 `json:"pc"`
+	Function string `json:"function"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+}
+
+type Goroutine struct {
+	ID       uint64 `json:"id"`
+	PC       uint64 `json:"pc"`
+	Function string `json:"function"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	// Current is true if the goroutine is running on the stopped thread
+	Current bool `json:"current"`
+}
+
+type Variable struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type CreateBreakpointParams struct {
+	// Location is an argument of break command (e.g. "main.main", "main.go:12" or "4a1000")
+	Location string `json:"location"`
+}
+
+type ClearBreakpointParams struct {
+	Addr uint64 `json:"addr"`
+}
+
+type StepParams struct {
+	Kind string `json:"kind"`
+}
+
+type StacktraceParams struct {
+	// Goroutine is the id of goroutine, or 0 for the current goroutine
+	Goroutine uint64 `json:"goroutine"`
+}
+
+type EvalParams struct {
+	// Expr is a name of variable, or an address expression of x command
+	Expr string `json:"expr"`
+}
+
+type CommandParams struct {
+	// Line is a command line of the REPL
+	Line string `json:"line"`
+}
+
+type CommandResult struct {
+	Output string `json:"output"`
+}
@@ -8,12 +8,21 @@ import (
 	"time"
 )
 
-func buildDebuggeeProgram(path string) (string, error) {
-	debuggeename := fmt.Sprintf("__debug_%d", time.Now().Unix())
+func buildDebuggeeProgram(path string, config *Config) (string, error) {
+	// restart may build it again in the same second
+	debuggeename := fmt.Sprintf("__debug_%d", time.Now().UnixNano())
 
-	cmd := exec.Command("go", "build", "-o", debuggeename, "-gcflags", "all=-N -l", path)
+	args := []string{"build", "-o", debuggeename, "-gcflags", "all=-N -l"}
+	if config.buildMode != "" {
+		args = append(args, "-buildmode="+config.buildMode)
+	}
+	if config.trimpath {
+		args = append(args, "-trimpath")
+	}
+
+	cmd := exec.Command("go", append(args, path)...)
 	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stdin
+	cmd.Stderr = os.Stderr
 
 	if err := cmd.Run(); err != nil {
 		return "", err
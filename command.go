@@ -12,12 +12,25 @@ const (
 	BreakCommand                 = "break"
 	RegisterCommand              = "register"
 	DumpSubCommand               = "dump"
+	GetSubCommand                = "get"
+	SetSubCommand                = "set"
 	SingleStepInstructionCommand = "si"
 	StepInCommand                = "stepin"
 	NextCommand                  = "next"
+	NextInstructionCommand       = "nexti"
 	StepOutCommand               = "stepout"
 	BackTraceCommand             = "backtrace"
 	VariablesCommand             = "variables"
+	ConfigCommand                = "config"
+	DisassembleCommand           = "disassemble"
+	ExamineCommand               = "x"
+	InfoCommand                  = "info"
+	ListCommand                  = "list"
+	RestartCommand               = "restart"
+	HandleSignalCommand          = "handle"
+	CatchCommand                 = "catch"
+	InferiorsCommand             = "inferiors"
+	PrintCommand                 = "print"
 	UnknownCommand               = "unknown"
 )
 
@@ -55,11 +68,21 @@ func NewCommand(input string) (Command, error) {
 			return Command{}, errors.New("register command must have at least 1 argument")
 		}
 
-		if s[1] != DumpSubCommand {
+		switch s[1] {
+		case DumpSubCommand:
+		case GetSubCommand, SetSubCommand:
+			if len(s) <= 2 {
+				return Command{}, fmt.Errorf("register %s command must have register name", s[1])
+			}
+		default:
 			return Command{}, fmt.Errorf("unexpected register sub command '%s' is given", s[1])
 		}
 
-		return Command{Type: RegisterCommand, SubType: DumpSubCommand}, nil
+		return Command{Type: RegisterCommand, SubType: s[1], Args: s[2:]}, nil
+	}
+
+	if strings.HasPrefix(RestartCommand, s[0]) {
+		return Command{Type: RestartCommand, Args: s[1:]}, nil
 	}
 
 	if strings.HasPrefix(SingleStepInstructionCommand, s[0]) {
@@ -74,6 +97,10 @@ func NewCommand(input string) (Command, error) {
 		return Command{Type: StepOutCommand}, nil
 	}
 
+	if s[0] == NextInstructionCommand {
+		return Command{Type: NextInstructionCommand}, nil
+	}
+
 	if strings.HasPrefix(NextCommand, s[0]) {
 		return Command{Type: NextCommand}, nil
 	}
@@ -86,5 +113,48 @@ func NewCommand(input string) (Command, error) {
 		return Command{Type: VariablesCommand}, nil
 	}
 
+	// examine command is like "x/4xg 0xc000012345"
+	if s[0] == ExamineCommand || strings.HasPrefix(s[0], ExamineCommand+"/") {
+		_, format, _ := strings.Cut(s[0], "/")
+		return Command{Type: ExamineCommand, SubType: format, Args: s[1:]}, nil
+	}
+
+	if strings.HasPrefix(DisassembleCommand, s[0]) {
+		return Command{Type: DisassembleCommand, Args: s[1:]}, nil
+	}
+
+	if strings.HasPrefix(InfoCommand, s[0]) {
+		return Command{Type: InfoCommand, Args: s[1:]}, nil
+	}
+
+	if strings.HasPrefix(ConfigCommand, s[0]) {
+		return Command{Type: ConfigCommand, Args: s[1:]}, nil
+	}
+
+	if strings.HasPrefix(HandleSignalCommand, s[0]) {
+		return Command{Type: HandleSignalCommand, Args: s[1:]}, nil
+	}
+
+	if strings.HasPrefix(CatchCommand, s[0]) {
+		return Command{Type: CatchCommand, Args: s[1:]}, nil
+	}
+
+	// inferiors command needs "infe" at least because "inf" is info command
+	if strings.HasPrefix(InferiorsCommand, s[0]) {
+		return Command{Type: InferiorsCommand, Args: s[1:]}, nil
+	}
+
+	if strings.HasPrefix(ListCommand, s[0]) {
+		return Command{Type: ListCommand, Args: s[1:]}, nil
+	}
+
+	if strings.HasPrefix(PrintCommand, s[0]) {
+		if len(s) <= 1 {
+			return Command{}, errors.New("print command must have a variable or an address")
+		}
+
+		return Command{Type: PrintCommand, Args: s[1:]}, nil
+	}
+
 	return Command{Type: UnknownCommand}, nil
 }
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	SkipPackagesConfig    = "skip-packages"
+	SourceContextConfig   = "source-context"
+	SourceHighlightConfig = "source-highlight"
+	SubstitutePathConfig  = "substitute-path"
+	FollowForkModeConfig  = "follow-fork-mode"
+	DetachOnForkConfig    = "detach-on-fork"
+)
+
+type Config struct {
+	// functions in these packages are never stepped into by stepin command
+	skipPackages []string
+	// the number of lines printed before and after the current line
+	sourceContext int
+	// if true, source code is colored by go/scanner
+	sourceHighlight bool
+	// rules to find source files whose paths in debug information don't exist on this machine
+	substitutePaths []substitutePath
+	// the process which the debugger follows after fork, which is "parent" or "child"
+	followForkMode string
+	// if true, the process which is not followed after fork is detached, otherwise it is kept as an inferior
+	detachOnFork bool
+
+	// buildMode is passed to go build as -buildmode (e.g. pie)
+	buildMode string
+	// trimpath is passed to go build as -trimpath
+	trimpath bool
+	// if aslr is true, address space layout randomization is not disabled for the debuggee
+	aslr bool
+	// args are command line arguments of the debuggee, which are replaced by restart command
+	args []string
+}
+
+func NewConfig() *Config {
+	return &Config{
+		skipPackages:   []string{"runtime"},
+		sourceContext:  defaultSourceContext,
+		followForkMode: "parent",
+		detachOnFork:   true,
+	}
+}
+
+func (c *Config) Set(key string, values []string) error {
+	switch key {
+	case SkipPackagesConfig:
+		c.skipPackages = values
+		return nil
+	case SourceContextConfig:
+		if len(values) != 1 {
+			return fmt.Errorf("%s takes 1 value", key)
+		}
+
+		n, err := strconv.Atoi(values[0])
+		if err != nil || n < 0 {
+			return fmt.Errorf("%s must be non-negative number: %s", key, values[0])
+		}
+		c.sourceContext = n
+		return nil
+	case SourceHighlightConfig:
+		if len(values) != 1 || (values[0] != "on" && values[0] != "off") {
+			return fmt.Errorf("%s must be on or off", key)
+		}
+		c.sourceHighlight = values[0] == "on"
+		return nil
+	case SubstitutePathConfig:
+		return c.setSubstitutePath(values)
+	case FollowForkModeConfig:
+		if len(values) != 1 || (values[0] != "parent" && values[0] != "child") {
+			return fmt.Errorf("%s must be parent or child", key)
+		}
+		c.followForkMode = values[0]
+		return nil
+	case DetachOnForkConfig:
+		if len(values) != 1 || (values[0] != "on" && values[0] != "off") {
+			return fmt.Errorf("%s must be on or off", key)
+		}
+		c.detachOnFork = values[0] == "on"
+		return nil
+	}
+
+	return fmt.Errorf("unknown config key '%s' is given", key)
+}
+
+func (c *Config) Print(w io.Writer) {
+	fmt.Fprintf(w, "%s: %s\n", SkipPackagesConfig, strings.Join(c.skipPackages, " "))
+	fmt.Fprintf(w, "%s: %d\n", SourceContextConfig, c.sourceContext)
+
+	highlight := "off"
+	if c.sourceHighlight {
+		highlight = "on"
+	}
+	fmt.Fprintf(w, "%s: %s\n", SourceHighlightConfig, highlight)
+	fmt.Fprintf(w, "%s: %s\n", FollowForkModeConfig, c.followForkMode)
+
+	detach := "off"
+	if c.detachOnFork {
+		detach = "on"
+	}
+	fmt.Fprintf(w, "%s: %s\n", DetachOnForkConfig, detach)
+
+	for _, rule := range c.substitutePaths {
+		fmt.Fprintf(w, "%s: %s -> %s\n", SubstitutePathConfig, rule.from, rule.to)
+	}
+}
+
+// setSubstitutePath adds the rule "from to", or removes the rule of "from" if only from is given.
+func (c *Config) setSubstitutePath(values []string) error {
+	if len(values) == 0 || len(values) > 2 {
+		return fmt.Errorf("%s takes <from> [<to>]", SubstitutePathConfig)
+	}
+
+	from := values[0]
+	c.substitutePaths = slices.DeleteFunc(c.substitutePaths, func(rule substitutePath) bool {
+		return rule.from == from
+	})
+
+	if len(values) == 2 {
+		c.substitutePaths = append(c.substitutePaths, substitutePath{from: from, to: values[1]})
+	}
+
+	return nil
+}
@@ -0,0 +1,701 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ksrnnb/godbg/frame"
+	"github.com/ksrnnb/godbg/logger"
+	"github.com/ksrnnb/godbg/proc"
+)
+
+// dapDefaultThreadID is the thread id before the go runtime starts goroutines.
+const dapDefaultThreadID = 1
+
+// dapRequest, dapResponse and dapEvent are messages of the Debug Adapter Protocol.
+// @see https://microsoft.github.io/debug-adapter-protocol/specification
+type dapRequest struct {
+	Seq       int             `json:"seq"`
+	Type      string          `json:"type"`
+	Command   string          `json:"command"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+type dapResponse struct {
+	Seq        int    `json:"seq"`
+	Type       string `json:"type"`
+	RequestSeq int    `json:"request_seq"`
+	Success    bool   `json:"success"`
+	Command    string `json:"command"`
+	Message    string `json:"message,omitempty"`
+	Body       any    `json:"body,omitempty"`
+}
+
+type dapEvent struct {
+	Seq   int    `json:"seq"`
+	Type  string `json:"type"`
+	Event string `json:"event"`
+	Body  any    `json:"body,omitempty"`
+}
+
+type dapSource struct {
+	Name string `json:"name,omitempty"`
+	Path string `json:"path,omitempty"`
+}
+
+type dapBreakpoint struct {
+	Verified bool   `json:"verified"`
+	Line     int    `json:"line,omitempty"`
+	Message  string `json:"message,omitempty"`
+}
+
+type dapStackFrame struct {
+	ID     int        `json:"id"`
+	Name   string     `json:"name"`
+	Source *dapSource `json:"source,omitempty"`
+	Line   int        `json:"line"`
+	Column int        `json:"column"`
+}
+
+type dapVariable struct {
+	Name               string `json:"name"`
+	Value              string `json:"value"`
+	Type               string `json:"type,omitempty"`
+	VariablesReference int    `json:"variablesReference"`
+}
+
+// launch arguments correspond to the flags of the command line.
+type dapLaunchArguments struct {
+	Program     string   `json:"program"`
+	Args        []string `json:"args"`
+	BuildMode   string   `json:"buildMode"`
+	Trimpath    bool     `json:"trimpath"`
+	ASLR        bool     `json:"aslr"`
+	StopOnEntry bool     `json:"stopOnEntry"`
+}
+
+type dapAttachArguments struct {
+	ProcessID   int  `json:"processId"`
+	StopOnEntry bool `json:"stopOnEntry"`
+}
+
+// terminateDebuggee is nil if the client doesn't specify it.
+type dapDisconnectArguments struct {
+	TerminateDebuggee *bool `json:"terminateDebuggee"`
+}
+
+// dapFrame is a frame returned by stackTrace request, which is referred by scopes and variables requests.
+type dapFrame struct {
+	stackFrame
+	regs frame.Registers
+}
+
+// dapSession serves requests of a client on a connection. requests are served on the goroutine which calls serve,
+// which traces the process, and pause is handled by the goroutine reading requests while the process runs.
+type dapSession struct {
+	reader *bufio.Reader
+	logger *slog.Logger
+	// out is where the debugger prints, which must not be the writer of the protocol
+	out io.Writer
+	// err is why reading requests has stopped, or nil at EOF
+	err error
+
+	// mu guards writer and seq, which are used by both goroutines
+	mu     sync.Mutex
+	writer io.Writer
+	seq    int
+
+	d *Debugger
+	// debugger is d shared with the goroutine reading requests, which interrupts the running process
+	debugger    atomic.Pointer[Debugger]
+	stopOnEntry bool
+	// addresses of breakpoints set by setBreakpoints request for each source path
+	breakpoints map[string][]uint64
+	// frames of stackTrace requests since the process stopped, and frame id is index + 1
+	frames []dapFrame
+	// true after exited and terminated events are sent
+	exited bool
+}
+
+// runDAPServer serves the Debug Adapter Protocol on stdin and stdout, or on the TCP address if it is given.
+func runDAPServer(addr string) error {
+	if addr == "" {
+		// stdout is used by the protocol, so that outputs of the debugger, the logger and the debuggee go to stderr
+		out := os.Stdout
+		os.Stdout = os.Stderr
+		return newDAPSession(os.Stdin, out, logger.NewLogger()).serve()
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+
+	fmt.Printf("DAP server listening at %s\n", listener.Addr())
+
+	conn, err := listener.Accept()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return newDAPSession(conn, conn, logger.NewLogger()).serve()
+}
+
+func newDAPSession(r io.Reader, w io.Writer, logger *slog.Logger) *dapSession {
+	return &dapSession{
+		reader:      bufio.NewReader(r),
+		writer:      w,
+		logger:      logger,
+		out:         os.Stdout,
+		breakpoints: make(map[string][]uint64),
+	}
+}
+
+func (s *dapSession) serve() error {
+	requests := make(chan dapRequest, 64)
+	go s.readRequests(requests)
+
+	for req := range requests {
+		body, err := s.handleRequest(req)
+		if err != nil {
+			s.sendResponse(req, nil, err)
+			continue
+		}
+
+		s.sendResponse(req, body, nil)
+
+		if err := s.afterResponse(req); err != nil {
+			return err
+		}
+
+		if req.Command == "disconnect" {
+			return nil
+		}
+	}
+
+	return s.err
+}
+
+// readRequests reads requests in background, and closes requests when the connection is closed.
+// pause is handled here because the process runs on the goroutine serving the other requests,
+// and disconnect interrupts the running process so that it is served.
+func (s *dapSession) readRequests(requests chan<- dapRequest) {
+	defer close(requests)
+
+	for {
+		req, err := s.readRequest()
+		if errors.Is(err, io.EOF) {
+			return
+		}
+		if err != nil {
+			s.err = err
+			return
+		}
+
+		s.logger.Debug("DAP request", "command", req.Command, "seq", req.Seq)
+
+		switch req.Command {
+		case "pause":
+			s.sendResponse(req, nil, s.interrupt())
+			continue
+		case "disconnect":
+			if err := s.interrupt(); err != nil {
+				s.logger.Debug("failed to interrupt before disconnect", "error", err)
+			}
+		}
+
+		requests <- req
+	}
+}
+
+// interrupt stops the running process, and the stopped event is sent by the request which resumed it.
+// it does nothing if the process is not running or not started yet.
+func (s *dapSession) interrupt() error {
+	d := s.debugger.Load()
+	if d == nil {
+		return nil
+	}
+
+	return d.interrupt()
+}
+
+// readRequest reads a message which has Content-Length header and JSON body.
+func (s *dapSession) readRequest() (dapRequest, error) {
+	header, err := textproto.NewReader(s.reader).ReadMIMEHeader()
+	if err != nil {
+		return dapRequest{}, err
+	}
+
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return dapRequest{}, fmt.Errorf("invalid Content-Length: %s", err)
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(s.reader, data); err != nil {
+		return dapRequest{}, err
+	}
+
+	var req dapRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return dapRequest{}, fmt.Errorf("failed to parse request: %s", err)
+	}
+
+	return req, nil
+}
+
+func (s *dapSession) send(message any) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		s.logger.Error("failed to marshal DAP message", "error", err)
+		return
+	}
+
+	if _, err := fmt.Fprintf(s.writer, "Content-Length: %d\r\n\r\n%s", len(data), data); err != nil {
+		s.logger.Error("failed to send DAP message", "error", err)
+	}
+}
+
+func (s *dapSession) sendResponse(req dapRequest, body any, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seq++
+	res := dapResponse{Seq: s.seq, Type: "response", RequestSeq: req.Seq, Success: err == nil, Command: req.Command, Body: body}
+	if err != nil {
+		res.Message = err.Error()
+	}
+
+	s.send(res)
+}
+
+func (s *dapSession) sendEvent(event string, body any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seq++
+	s.send(dapEvent{Seq: s.seq, Type: "event", Event: event, Body: body})
+}
+
+func (s *dapSession) handleRequest(req dapRequest) (any, error) {
+	if s.d == nil {
+		switch req.Command {
+		case "initialize", "launch", "attach", "disconnect":
+		default:
+			return nil, fmt.Errorf("%s request before launch or attach", req.Command)
+		}
+	}
+
+	switch req.Command {
+	case "initialize":
+		return map[string]any{"supportsConfigurationDoneRequest": true, "supportTerminateDebuggee": true}, nil
+	case "launch":
+		return nil, s.launch(req.Arguments)
+	case "attach":
+		return nil, s.attach(req.Arguments)
+	case "setBreakpoints":
+		return s.setBreakpoints(req.Arguments)
+	case "setExceptionBreakpoints":
+		// panics are not supported yet
+		return map[string]any{"breakpoints": []dapBreakpoint{}}, nil
+	case "configurationDone":
+		return nil, nil
+	// the process is resumed after the response, and stopped event is sent when it stops
+	case "continue":
+		return map[string]any{"allThreadsContinued": true}, nil
+	case "next", "stepIn", "stepOut":
+		return nil, nil
+	case "threads":
+		return s.threads()
+	case "stackTrace":
+		return s.stackTrace(req.Arguments)
+	case "scopes":
+		return s.scopes(req.Arguments)
+	case "variables":
+		return s.variables(req.Arguments)
+	case "disconnect":
+		return nil, nil
+	}
+
+	return nil, fmt.Errorf("%s request is not supported", req.Command)
+}
+
+// afterResponse sends events which must follow the response of the request.
+func (s *dapSession) afterResponse(req dapRequest) error {
+	switch req.Command {
+	case "launch", "attach":
+		if s.d != nil {
+			s.sendEvent("initialized", nil)
+		}
+	case "configurationDone":
+		if s.stopOnEntry {
+			s.sendStopped("entry")
+			return nil
+		}
+
+		s.resume(req.Command, s.d.continueInstruction)
+	case "continue":
+		s.resume(req.Command, s.d.continueInstruction)
+	case "next":
+		s.resume(req.Command, s.d.handleNextCommand)
+	case "stepIn":
+		s.resume(req.Command, s.d.handleStepInCommand)
+	case "stepOut":
+		s.resume(req.Command, s.d.handleStepOutCommand)
+	case "disconnect":
+		if s.d != nil {
+			return s.disconnect(req.Arguments)
+		}
+	}
+
+	return nil
+}
+
+func (s *dapSession) launch(arguments json.RawMessage) error {
+	var args dapLaunchArguments
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return err
+	}
+
+	if args.Program == "" {
+		return errors.New("program must be given")
+	}
+
+	config := NewConfig()
+	config.buildMode = args.BuildMode
+	config.trimpath = args.Trimpath
+	config.aslr = args.ASLR
+	config.args = args.Args
+
+	d, err := NewDebugger(args.Program, config, s.logger)
+	if err != nil {
+		return err
+	}
+
+	s.stopOnEntry = args.StopOnEntry
+	return s.start(d)
+}
+
+func (s *dapSession) attach(arguments json.RawMessage) error {
+	var args dapAttachArguments
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return err
+	}
+
+	if args.ProcessID == 0 {
+		return errors.New("processId must be given")
+	}
+
+	d, err := AttachDebugger(args.ProcessID, NewConfig(), s.logger)
+	if err != nil {
+		return err
+	}
+
+	s.stopOnEntry = args.StopOnEntry
+	return s.start(d)
+}
+
+// start waits until the process stops after launch or attach.
+func (s *dapSession) start(d *Debugger) error {
+	d.suppressSourceCode = true
+	d.out = s.out
+
+	s.d = d
+	s.debugger.Store(d)
+	return nil
+}
+
+// disconnect kills the process if terminateDebuggee is true, and detaches it otherwise.
+// the launched process is killed and the attached process is detached by default.
+func (s *dapSession) disconnect(arguments json.RawMessage) error {
+	var args dapDisconnectArguments
+	if len(arguments) > 0 {
+		if err := json.Unmarshal(arguments, &args); err != nil {
+			return err
+		}
+	}
+
+	// the binary of the attached process is not built by the debugger
+	terminate := s.d.builtBinaryPath != ""
+	if args.TerminateDebuggee != nil {
+		terminate = *args.TerminateDebuggee
+	}
+
+	if terminate {
+		if err := s.d.killInferiors(); err != nil {
+			return err
+		}
+	}
+
+	return s.d.quit()
+}
+
+// resume runs the process by run for the request, and sends stopped event when it stops.
+// frames of the last stop become invalid, and the failure of run is sent as output event.
+// the exit of the process or a signal during run is reported by events instead of an error.
+func (s *dapSession) resume(command string, run func() error) {
+	s.frames = nil
+
+	exited := s.d.target.Exited()
+	if err := run(); err != nil && !isReportedStop(err, exited) {
+		s.sendEvent("output", map[string]any{"category": "stderr", "output": fmt.Sprintf("failed to %s: %s\n", command, err)})
+	}
+
+	s.sendStopped("")
+}
+
+// sendStopped sends stopped event with reason, or breakpoint or step by the current pc if reason is empty.
+func (s *dapSession) sendStopped(reason string) {
+	if s.d.target.Exited() {
+		s.sendExited()
+		return
+	}
+
+	body := map[string]any{"threadId": s.currentThreadID(), "allThreadsStopped": true}
+	switch stop := s.d.target.LastStop(); {
+	case reason != "":
+		// the reason given by the caller is kept
+	case stop.Kind == proc.StopSignal:
+		reason = "exception"
+		body["text"] = stop.String()
+	case stop.Kind == proc.StopInterrupted:
+		reason = "pause"
+	}
+
+	if reason == "" {
+		reason = "step"
+		if pc, err := s.d.getPC(); err == nil {
+			if s.d.hasUserBreakpoint(pc) {
+				reason = "breakpoint"
+			}
+		}
+	}
+
+	body["reason"] = reason
+	s.sendEvent("stopped", body)
+}
+
+// sendExited sends exited and terminated events once. the exit code of the process killed by a signal
+// is 128 + the signal number as shells do.
+func (s *dapSession) sendExited() {
+	if s.exited {
+		return
+	}
+	s.exited = true
+
+	reason := s.d.target.LastStop()
+	code := reason.Status
+	if reason.Kind == proc.StopKilled {
+		code = 128 + int(reason.Signal)
+	}
+
+	s.sendEvent("exited", map[string]any{"exitCode": code})
+	s.sendEvent("terminated", nil)
+}
+
+func (s *dapSession) currentThreadID() int {
+	if id, ok := s.d.currentGoroutineID(); ok {
+		return int(id)
+	}
+
+	return dapDefaultThreadID
+}
+
+func (s *dapSession) setBreakpoints(arguments json.RawMessage) (any, error) {
+	var args struct {
+		Source      dapSource `json:"source"`
+		Breakpoints []struct {
+			Line int `json:"line"`
+		} `json:"breakpoints"`
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, err
+	}
+
+	// breakpoints of the source are replaced by the request
+	for _, addr := range s.breakpoints[args.Source.Path] {
+		s.d.removeBreakpoint(addr)
+	}
+	s.breakpoints[args.Source.Path] = nil
+
+	breakpoints := make([]dapBreakpoint, 0, len(args.Breakpoints))
+	filename, err := s.d.findSourceFile(args.Source.Path)
+	for _, b := range args.Breakpoints {
+		if err != nil {
+			breakpoints = append(breakpoints, dapBreakpoint{Line: b.Line, Message: err.Error()})
+			continue
+		}
+
+		addr, err := s.d.lineAddress(filename, b.Line)
+		if err != nil {
+			breakpoints = append(breakpoints, dapBreakpoint{Line: b.Line, Message: err.Error()})
+			continue
+		}
+
+		if err := s.d.setUserBreakpoint(addr, fmt.Sprintf("%s:%d", filename, b.Line)); err != nil {
+			breakpoints = append(breakpoints, dapBreakpoint{Line: b.Line, Message: err.Error()})
+			continue
+		}
+		s.breakpoints[args.Source.Path] = append(s.breakpoints[args.Source.Path], addr)
+		breakpoints = append(breakpoints, dapBreakpoint{Verified: true, Line: b.Line})
+	}
+
+	return map[string]any{"breakpoints": breakpoints}, nil
+}
+
+// threads returns goroutines as threads.
+func (s *dapSession) threads() (any, error) {
+	type thread struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	}
+
+	current := s.currentThreadID()
+	threads := []thread{}
+	hasCurrent := false
+
+	// goroutines can't be read before the runtime is initialized
+	goroutines, err := s.d.goroutines()
+	if err != nil {
+		s.logger.Debug("failed to read goroutines", "error", err)
+	}
+
+	for _, g := range goroutines {
+		threads = append(threads, thread{ID: int(g.id), Name: fmt.Sprintf("goroutine %d", g.id)})
+		if int(g.id) == current {
+			hasCurrent = true
+		}
+	}
+
+	if !hasCurrent {
+		threads = append(threads, thread{ID: current, Name: "main thread"})
+	}
+
+	return map[string]any{"threads": threads}, nil
+}
+
+func (s *dapSession) stackTrace(arguments json.RawMessage) (any, error) {
+	var args struct {
+		ThreadID   int `json:"threadId"`
+		StartFrame int `json:"startFrame"`
+		Levels     int `json:"levels"`
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, err
+	}
+
+	frames, regs, err := s.goroutineFrames(args.ThreadID)
+	if err != nil {
+		return nil, err
+	}
+
+	stackFrames := []dapStackFrame{}
+	for i, f := range frames {
+		if i < args.StartFrame || (args.Levels > 0 && i >= args.StartFrame+args.Levels) {
+			continue
+		}
+
+		// registers of the top frame are the thread's, and the others are recovered from the stack
+		var r frame.Registers = frameRegisters{pc: f.pc, sp: f.sp, bp: f.bp}
+		if i == 0 && regs != nil {
+			r = regs
+		}
+		s.frames = append(s.frames, dapFrame{stackFrame: f, regs: r})
+
+		path, ok := s.d.resolveSourcePath(f.filename)
+		if !ok {
+			path = f.filename
+		}
+
+		stackFrames = append(stackFrames, dapStackFrame{
+			ID:     len(s.frames),
+			Name:   f.funcname,
+			Source: &dapSource{Name: filepath.Base(path), Path: path},
+			Line:   f.line,
+			Column: 1,
+		})
+	}
+
+	return map[string]any{"stackFrames": stackFrames, "totalFrames": len(frames)}, nil
+}
+
+// goroutineFrames walks frames of the goroutine of the thread id.
+// registers are returned if the goroutine is running on the stopped thread.
+func (s *dapSession) goroutineFrames(threadID int) ([]stackFrame, frame.Registers, error) {
+	if threadID == s.currentThreadID() {
+		frames, err := s.d.currentStackFrames()
+		return frames, s.d.registerClient, err
+	}
+
+	frames, err := s.d.goroutineStackFrames(uint64(threadID))
+	return frames, nil, err
+}
+
+func (s *dapSession) frame(id int) (dapFrame, error) {
+	if id <= 0 || id > len(s.frames) {
+		return dapFrame{}, fmt.Errorf("frame %d is not found", id)
+	}
+
+	return s.frames[id-1], nil
+}
+
+func (s *dapSession) scopes(arguments json.RawMessage) (any, error) {
+	var args struct {
+		FrameID int `json:"frameId"`
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.frame(args.FrameID); err != nil {
+		return nil, err
+	}
+
+	// variables reference of the scope is the frame id
+	scopes := []map[string]any{{"name": "Locals", "variablesReference": args.FrameID, "expensive": false}}
+	return map[string]any{"scopes": scopes}, nil
+}
+
+func (s *dapSession) variables(arguments json.RawMessage) (any, error) {
+	var args struct {
+		VariablesReference int `json:"variablesReference"`
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, err
+	}
+
+	f, err := s.frame(args.VariablesReference)
+	if err != nil {
+		return nil, err
+	}
+
+	variables, err := s.d.symTableForPC(f.pc).GetVariables(f.pc, f.regs, s.d.readMemoryBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []dapVariable{}
+	for _, v := range variables {
+		value, err := s.d.readVariable(v, f.regs)
+		if err != nil {
+			value = fmt.Sprintf("<%s>", err)
+		}
+
+		result = append(result, dapVariable{Name: v.Name, Value: value, Type: v.Type})
+	}
+
+	return map[string]any{"variables": result}, nil
+}
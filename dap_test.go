@@ -0,0 +1,352 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ksrnnb/godbg/logger"
+)
+
+// dapMessage is a response or an event received by dapClient.
+type dapMessage struct {
+	Seq        int             `json:"seq"`
+	Type       string          `json:"type"`
+	RequestSeq int             `json:"request_seq"`
+	Success    bool            `json:"success"`
+	Command    string          `json:"command"`
+	Message    string          `json:"message"`
+	Event      string          `json:"event"`
+	Body       json.RawMessage `json:"body"`
+}
+
+// dapClient sends requests to the session, and keeps events received while it waits for responses.
+type dapClient struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+	seq    int
+	events []dapMessage
+}
+
+func (c *dapClient) read() dapMessage {
+	c.t.Helper()
+
+	c.conn.SetReadDeadline(time.Now().Add(30 * time.Second))
+	header, err := textproto.NewReader(c.reader).ReadMIMEHeader()
+	if err != nil {
+		c.t.Fatalf("failed to read header: %s", err)
+	}
+
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		c.t.Fatalf("invalid Content-Length: %s", err)
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, data); err != nil {
+		c.t.Fatalf("failed to read message: %s", err)
+	}
+
+	var msg dapMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		c.t.Fatalf("failed to parse message: %s", err)
+	}
+
+	return msg
+}
+
+// request sends the request and returns the body of the successful response.
+func (c *dapClient) request(command string, arguments any, body any) {
+	c.t.Helper()
+
+	c.seq++
+	data, err := json.Marshal(map[string]any{"seq": c.seq, "type": "request", "command": command, "arguments": arguments})
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if _, err := fmt.Fprintf(c.conn, "Content-Length: %d\r\n\r\n%s", len(data), data); err != nil {
+		c.t.Fatalf("failed to send %s request: %s", command, err)
+	}
+
+	for {
+		msg := c.read()
+		if msg.Type == "event" {
+			c.events = append(c.events, msg)
+			continue
+		}
+
+		if msg.RequestSeq != c.seq {
+			c.t.Fatalf("unexpected response %+v", msg)
+		}
+		if !msg.Success {
+			c.t.Fatalf("%s request failed: %s", command, msg.Message)
+		}
+		if body != nil {
+			if err := json.Unmarshal(msg.Body, body); err != nil {
+				c.t.Fatalf("failed to parse body of %s response: %s", command, err)
+			}
+		}
+		return
+	}
+}
+
+// waitEvent returns the body of the event, skipping the other events.
+func (c *dapClient) waitEvent(event string, body any) {
+	c.t.Helper()
+
+	for {
+		var msg dapMessage
+		if len(c.events) > 0 {
+			msg, c.events = c.events[0], c.events[1:]
+		} else {
+			msg = c.read()
+		}
+
+		if msg.Type != "event" {
+			c.t.Fatalf("unexpected response %+v while waiting for %s event", msg, event)
+		}
+		if msg.Event != event {
+			continue
+		}
+		if body != nil {
+			if err := json.Unmarshal(msg.Body, body); err != nil {
+				c.t.Fatalf("failed to parse body of %s event: %s", event, err)
+			}
+		}
+		return
+	}
+}
+
+// startDAPSession serves a session over TCP, and returns the client and the channel receiving the result of serve.
+// the debugger prints to out.
+func startDAPSession(t *testing.T, out io.Writer) (*dapClient, *dapSession, <-chan error) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	// the session traces the process on its own goroutine
+	s := newDAPSession(nil, io.Discard, logger.NewLogger())
+	s.out = out
+	served := make(chan error, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			served <- err
+			return
+		}
+		defer conn.Close()
+		s.reader = bufio.NewReader(conn)
+		s.writer = conn
+		served <- s.serve()
+	}()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return &dapClient{t: t, conn: conn, reader: bufio.NewReader(conn)}, s, served
+}
+
+// launchHello launches cmd/hello with breakpoints at lines of main.go, and waits until it stops at the first one.
+func (c *dapClient) launchHello(lines ...int) (threadID int) {
+	c.t.Helper()
+
+	c.request("initialize", map[string]any{"adapterID": "godbg"}, nil)
+	c.request("launch", map[string]any{"program": "./cmd/hello"}, nil)
+	c.waitEvent("initialized", nil)
+
+	source, err := filepath.Abs("cmd/hello/main.go")
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	var requested []map[string]int
+	for _, line := range lines {
+		requested = append(requested, map[string]int{"line": line})
+	}
+	var breakpoints struct {
+		Breakpoints []dapBreakpoint `json:"breakpoints"`
+	}
+	c.request("setBreakpoints", map[string]any{"source": dapSource{Path: source}, "breakpoints": requested}, &breakpoints)
+	for _, bp := range breakpoints.Breakpoints {
+		if !bp.Verified {
+			c.t.Fatalf("unexpected breakpoints %+v", breakpoints)
+		}
+	}
+
+	c.request("configurationDone", nil, nil)
+	return c.waitStopped("breakpoint", lines[0])
+}
+
+// waitStopped waits for stopped event with reason, and checks the line of the top frame.
+func (c *dapClient) waitStopped(reason string, line int) (threadID int) {
+	c.t.Helper()
+
+	var stopped struct {
+		Reason   string `json:"reason"`
+		ThreadID int    `json:"threadId"`
+	}
+	c.waitEvent("stopped", &stopped)
+	if stopped.Reason != reason {
+		c.t.Fatalf("expected stop by %s, but got %+v", reason, stopped)
+	}
+
+	frames := c.stackTrace(stopped.ThreadID)
+	if frames[0].Line != line {
+		c.t.Fatalf("expected stop at line %d, but got %+v", line, frames[0])
+	}
+
+	return stopped.ThreadID
+}
+
+func (c *dapClient) stackTrace(threadID int) []dapStackFrame {
+	c.t.Helper()
+
+	var stackTrace struct {
+		StackFrames []dapStackFrame `json:"stackFrames"`
+	}
+	c.request("stackTrace", map[string]any{"threadId": threadID}, &stackTrace)
+	if len(stackTrace.StackFrames) == 0 {
+		c.t.Fatal("no stack frames are returned")
+	}
+
+	return stackTrace.StackFrames
+}
+
+// TestDAPSession debugs cmd/hello through a session over TCP, from launch until disconnect.
+func TestDAPSession(t *testing.T) {
+	c, _, served := startDAPSession(t, io.Discard)
+	threadID := c.launchHello(10)
+
+	frames := c.stackTrace(threadID)
+	if frames[0].Name != "main.main" {
+		t.Fatalf("unexpected stack frames %+v", frames)
+	}
+
+	var scopes struct {
+		Scopes []struct {
+			VariablesReference int `json:"variablesReference"`
+		} `json:"scopes"`
+	}
+	c.request("scopes", map[string]any{"frameId": frames[0].ID}, &scopes)
+	if len(scopes.Scopes) == 0 {
+		t.Fatal("no scopes are returned")
+	}
+
+	var variables struct {
+		Variables []dapVariable `json:"variables"`
+	}
+	c.request("variables", map[string]any{"variablesReference": scopes.Scopes[0].VariablesReference}, &variables)
+	values := make(map[string]string)
+	for _, v := range variables.Variables {
+		values[v.Name] = v.Value
+	}
+	if values["a"] != "3" || values["b"] != "5" || values["c"] != "8" {
+		t.Fatalf("unexpected variables %+v", variables)
+	}
+
+	c.request("continue", map[string]any{"threadId": threadID}, nil)
+	var exited struct {
+		ExitCode int `json:"exitCode"`
+	}
+	c.waitEvent("exited", &exited)
+	if exited.ExitCode != 0 {
+		t.Fatalf("expected exit code 0, but got %d", exited.ExitCode)
+	}
+
+	c.request("disconnect", nil, nil)
+	if err := <-served; err != nil {
+		t.Fatalf("failed to serve: %s", err)
+	}
+}
+
+// TestDAPStepInAndContinue steps into fmt.Printf, which stops at the prologue end by a temporary breakpoint,
+// and continues to the next breakpoint. the source must not be printed to the output of the debugger.
+func TestDAPStepInAndContinue(t *testing.T) {
+	var out bytes.Buffer
+	c, _, served := startDAPSession(t, &out)
+	threadID := c.launchHello(10, 11)
+
+	c.request("stepIn", map[string]any{"threadId": threadID}, nil)
+	var stopped struct {
+		Reason string `json:"reason"`
+	}
+	c.waitEvent("stopped", &stopped)
+	if frames := c.stackTrace(threadID); frames[0].Name != "fmt.Printf" {
+		t.Fatalf("expected stop in fmt.Printf, but got %+v", frames[0])
+	}
+
+	c.request("continue", map[string]any{"threadId": threadID}, nil)
+	c.waitStopped("breakpoint", 11)
+
+	c.request("disconnect", nil, nil)
+	if err := <-served; err != nil {
+		t.Fatalf("failed to serve: %s", err)
+	}
+
+	for _, source := range []string{"fmt.Printf(", "printHello()", "func Printf("} {
+		if strings.Contains(out.String(), source) {
+			t.Fatalf("source is printed by the debugger: %q", out.String())
+		}
+	}
+}
+
+// TestDAPDisconnect checks that the launched process is killed by default, and detached if terminateDebuggee is false.
+func TestDAPDisconnect(t *testing.T) {
+	tests := []struct {
+		name      string
+		arguments any
+		killed    bool
+	}{
+		{name: "default", arguments: nil, killed: true},
+		{name: "terminate", arguments: map[string]any{"terminateDebuggee": true}, killed: true},
+		{name: "detach", arguments: map[string]any{"terminateDebuggee": false}, killed: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, s, served := startDAPSession(t, io.Discard)
+			c.launchHello(10)
+
+			c.request("disconnect", tt.arguments, nil)
+			if err := <-served; err != nil {
+				t.Fatalf("failed to serve: %s", err)
+			}
+
+			pid := s.d.target.Pid()
+			if tt.killed {
+				// the killed process has been waited by the debugger
+				if err := syscall.Kill(pid, 0); !errors.Is(err, syscall.ESRCH) {
+					t.Fatalf("expected process %d to be killed, but got %v", pid, err)
+				}
+				return
+			}
+
+			// the detached process runs until the end
+			var ws syscall.WaitStatus
+			if _, err := syscall.Wait4(pid, &ws, 0, nil); err != nil {
+				t.Fatalf("failed to wait process %d: %s", pid, err)
+			}
+			if !ws.Exited() || ws.ExitStatus() != 0 {
+				t.Fatalf("expected the exit with status 0, but got %v", ws)
+			}
+		})
+	}
+}
@@ -1,111 +1,261 @@
 package main
 
 import (
-	"encoding/binary"
+	"debug/dwarf"
+	"debug/gosym"
+	"errors"
 	"fmt"
-	"log"
+	"io"
 	"log/slog"
 	"os"
-	"os/exec"
-	"runtime"
+	"slices"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"syscall"
-	"unsafe"
 
-	sys "golang.org/x/sys/unix"
+	"github.com/ksrnnb/godbg/proc"
+	"golang.org/x/arch/x86/x86asm"
 )
 
 type Debugger struct {
-	pid               int
-	offset            uint64
-	breakpoints       map[uint64]*Breakpoint
+	target            *proc.Target
 	registerClient    RegisterClient
 	debuggeePath      string
 	symTable          *SymbolTable
 	logger            *slog.Logger
 	debugeeBinaryPath string
+	config            *Config
+	// where outputs of commands are written
+	out io.Writer
+
+	// if true, source code is not printed when breakpoint is hit
+	suppressSourceCode bool
+	// called with how the process terminates when it exits or is killed by a signal
+	onExit func(reason proc.StopReason)
+
+	// binary built by the debugger, which is removed when it quits, or empty for the attached process
+	builtBinaryPath string
+	// processes debugged by the debugger, and the selected one whose states are the fields of Debugger
+	inferiors      []*inferior
+	inferior       *inferior
+	nextInferiorID int
+
+	// shared objects loaded by the dynamic loader
+	libraries []*Library
+	// address of breakpoint at _dl_debug_state, or 0 if the debuggee is statically linked
+	loaderBreakpoint uint64
+	// functions of breakpoints which are set when libraries containing them are loaded
+	pendingBreakpoints []string
+	// locations of user breakpoints by address (e.g. main.main or /path/to/main.go:12),
+	// which are resolved again when the process restarts
+	breakpointLocations map[uint64]string
+	// policies of signals changed by handle command, which are kept after restart
+	signalPolicies map[syscall.Signal]proc.SignalPolicy
+	// system calls caught by catch command, or nil
+	syscallCatch *syscallCatch
+
+	// the process which interrupt stops, which is read on other goroutines
+	interruptTarget atomic.Pointer[proc.Target]
+
+	// where list command continues from
+	listPosition listPosition
+	// GOROOT, module cache and the main module, which are read when source is not found
+	goEnv *goEnvironment
+	// offsets of fields of runtime.g, which are read when goroutines are listed
+	gLayout *gLayout
 }
 
 const MainFunctionSymbol = "main.main"
 
-const (
-	// you can see signal code by "cat /usr/include/asm-generic/siginfo.h"
-	SignalCodeTrapBreakpoint = 1
-	SignalCodeTrapTrace      = 2
-
-	SignalCodeKernel = 0x80
-)
-
-func NewDebugger(debuggeePath string, logger *slog.Logger) (*Debugger, error) {
-	target, err := buildDebuggeeProgram(debuggeePath)
+func NewDebugger(debuggeePath string, config *Config, logger *slog.Logger) (*Debugger, error) {
+	target, err := buildDebuggeeProgram(debuggeePath, config)
 	if err != nil {
 		return nil, err
 	}
 
-	pid, err := executeDebuggeeProcess(target)
+	t, err := proc.Launch(target, config.args, config.aslr)
 	if err != nil {
 		return nil, err
 	}
 
-	symTable, err := NewSymbolTable(target)
+	return newDebugger(t, debuggeePath, config, logger)
+}
+
+// AttachDebugger attaches to the running process of pid.
+func AttachDebugger(pid int, config *Config, logger *slog.Logger) (*Debugger, error) {
+	t, err := proc.Attach(pid)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Debugger{
-		pid:               pid,
-		breakpoints:       make(map[uint64]*Breakpoint),
-		registerClient:    NewRegisterClient(pid),
-		debuggeePath:      debuggeePath,
-		symTable:          symTable,
-		logger:            logger,
-		debugeeBinaryPath: target,
-	}, nil
+	return newDebugger(t, t.Path(), config, logger)
+}
+
+func newDebugger(t *proc.Target, debuggeePath string, config *Config, logger *slog.Logger) (*Debugger, error) {
+	d := &Debugger{
+		debuggeePath:   debuggeePath,
+		logger:         logger,
+		config:         config,
+		out:            os.Stdout,
+		signalPolicies: make(map[syscall.Signal]proc.SignalPolicy),
+	}
+
+	if err := d.load(t); err != nil {
+		return nil, err
+	}
+
+	// the binary of the attached process is not built by the debugger
+	if !t.Attached() {
+		d.builtBinaryPath = t.Path()
+	}
+	d.resetInferiors()
+
+	return d, nil
+}
+
+// load reads symbols of the process which has stopped, and forgets states of the previous process.
+func (d *Debugger) load(t *proc.Target) error {
+	if err := d.loadSymbols(t); err != nil {
+		return err
+	}
+
+	if err := d.watchDynamicLoader(); err != nil {
+		return fmt.Errorf("failed to watch dynamic loader: %s", err)
+	}
+
+	return nil
+}
+
+// loadSymbols reads symbols of the process like load, but no breakpoint is set.
+func (d *Debugger) loadSymbols(t *proc.Target) error {
+	symTable, err := NewSymbolTable(t.Path(), d.logger)
+	if err != nil {
+		return err
+	}
+
+	// position independent binary is loaded at a random address (or a fixed address if ASLR is disabled)
+	if symTable.IsPIE() {
+		entry, err := readAuxv(t.Pid(), auxvTypeEntry)
+		if err != nil {
+			symTable.Close()
+			return fmt.Errorf("failed to get load address: %s", err)
+		}
+		symTable.SetLoadBias(entry - symTable.Entry())
+	}
+
+	d.setTarget(t, symTable)
+	return nil
+}
+
+// setTarget selects t with its symbol table, and resets states of the program which is debugged before.
+func (d *Debugger) setTarget(t *proc.Target, symTable *SymbolTable) {
+	d.applySignalPolicies(t)
+	d.applySyscallCatch(t)
+
+	d.target = t
+	d.registerClient = NewRegisterClient(t)
+	d.interruptTarget.Store(t)
+	d.symTable = symTable
+	d.debugeeBinaryPath = t.Path()
+	d.breakpointLocations = make(map[uint64]string)
+	d.libraries = nil
+	d.loaderBreakpoint = 0
+	d.pendingBreakpoints = nil
+	d.listPosition = listPosition{}
+	d.gLayout = nil
 }
 
 // TODO: stragety pattern
 func (d *Debugger) HandleCommand(cmd Command) error {
+	// the exit of the process or a signal during the command is reported by handleStop instead of an error
+	exited := d.target.Exited()
+	failed := func(err error) bool {
+		return err != nil && !isReportedStop(err, exited)
+	}
+
 	switch cmd.Type {
 	case ContinueCommand:
-		if err := d.handleContinueCommand(); err != nil {
-			fmt.Printf("failed to continue: %s\n", err)
-			return d.quit()
+		if err := d.handleContinueCommand(); failed(err) {
+			fmt.Fprintf(d.out, "failed to continue: %s\n", err)
 		}
 	case QuitCommand:
-		if err := d.quit(); err != nil {
-			return err
-		}
+		return errQuit
 	case BreakCommand:
-		if err := d.handleBreakCommand(cmd.Args); err != nil {
-			fmt.Printf("failed to handle break command: %s\n", err)
+		if err := d.handleBreakCommand(cmd.Args); failed(err) {
+			fmt.Fprintf(d.out, "failed to handle break command: %s\n", err)
 		}
 	case RegisterCommand:
-		if err := d.handleRegisterCommand(cmd); err != nil {
-			fmt.Printf("faield to handle register command: %s\n", err)
+		if err := d.handleRegisterCommand(cmd); failed(err) {
+			fmt.Fprintf(d.out, "faield to handle register command: %s\n", err)
 		}
 	case SingleStepInstructionCommand:
-		if err := d.handleSingleStepInstructionCommand(); err != nil {
-			fmt.Printf("failed to handle single step instruction: %s\n", err)
+		if err := d.handleSingleStepInstructionCommand(); failed(err) {
+			fmt.Fprintf(d.out, "failed to handle single step instruction: %s\n", err)
+		}
+	case NextInstructionCommand:
+		if err := d.handleNextInstructionCommand(); failed(err) {
+			fmt.Fprintf(d.out, "failed to handle next instruction command: %s\n", err)
 		}
 	case StepOutCommand:
-		if err := d.handleStepOutCommand(); err != nil {
-			fmt.Printf("failed to handle step out command: %s\n", err)
+		if err := d.handleStepOutCommand(); failed(err) {
+			fmt.Fprintf(d.out, "failed to handle step out command: %s\n", err)
 		}
 	case StepInCommand:
-		if err := d.handleStepInCommand(); err != nil {
-			fmt.Printf("failed to handle step in comand: %s\n", err)
+		if err := d.handleStepInCommand(); failed(err) {
+			fmt.Fprintf(d.out, "failed to handle step in comand: %s\n", err)
 		}
 	case NextCommand:
-		if err := d.handleNextCommand(); err != nil {
-			fmt.Printf("failed to handle next command: %s\n", err)
+		if err := d.handleNextCommand(); failed(err) {
+			fmt.Fprintf(d.out, "failed to handle next command: %s\n", err)
 		}
 	case BackTraceCommand:
-		if err := d.handleBacktraceCommand(); err != nil {
-			fmt.Printf("failed to handle backtrace command: %s\n", err)
+		if err := d.handleBacktraceCommand(); failed(err) {
+			fmt.Fprintf(d.out, "failed to handle backtrace command: %s\n", err)
 		}
 	case VariablesCommand:
-		if err := d.handleVariableCommand(); err != nil {
-			fmt.Printf("failed to handle backtrace command: %s\n", err)
+		if err := d.handleVariableCommand(); failed(err) {
+			fmt.Fprintf(d.out, "failed to handle backtrace command: %s\n", err)
+		}
+	case PrintCommand:
+		if err := d.handlePrintCommand(cmd.Args); failed(err) {
+			fmt.Fprintf(d.out, "failed to handle print command: %s\n", err)
+		}
+	case DisassembleCommand:
+		if err := d.handleDisassembleCommand(cmd.Args); failed(err) {
+			fmt.Fprintf(d.out, "failed to handle disassemble command: %s\n", err)
+		}
+	case ExamineCommand:
+		if err := d.handleExamineCommand(cmd); failed(err) {
+			fmt.Fprintf(d.out, "failed to handle examine command: %s\n", err)
+		}
+	case InfoCommand:
+		if err := d.handleInfoCommand(cmd.Args); failed(err) {
+			fmt.Fprintf(d.out, "failed to handle info command: %s\n", err)
+		}
+	case ConfigCommand:
+		if err := d.handleConfigCommand(cmd.Args); failed(err) {
+			fmt.Fprintf(d.out, "failed to handle config command: %s\n", err)
+		}
+	case ListCommand:
+		if err := d.handleListCommand(cmd.Args); failed(err) {
+			fmt.Fprintf(d.out, "failed to handle list command: %s\n", err)
+		}
+	case HandleSignalCommand:
+		if err := d.handleSignalCommand(cmd.Args); failed(err) {
+			fmt.Fprintf(d.out, "failed to handle handle command: %s\n", err)
+		}
+	case RestartCommand:
+		if err := d.handleRestartCommand(cmd.Args); failed(err) {
+			fmt.Fprintf(d.out, "failed to handle restart command: %s\n", err)
+		}
+	case CatchCommand:
+		if err := d.handleCatchCommand(cmd.Args); failed(err) {
+			fmt.Fprintf(d.out, "failed to handle catch command: %s\n", err)
+		}
+	case InferiorsCommand:
+		if err := d.handleInferiorsCommand(cmd.Args); failed(err) {
+			fmt.Fprintf(d.out, "failed to handle inferiors command: %s\n", err)
 		}
 	default:
 		return nil
@@ -114,293 +264,384 @@ func (d *Debugger) HandleCommand(cmd Command) error {
 	return nil
 }
 
-func (d *Debugger) WaitSignal() (syscall.Signal, error) {
-	var ws sys.WaitStatus
-	_, err := sys.Wait4(d.pid, &ws, sys.WALL, nil)
-	if err != nil {
-		return 0, fmt.Errorf("failed to wait pid %d", d.pid)
+// handleStop handles the stop of the process after it is resumed.
+// the debugger doesn't quit when the process exits, so that symbols and sources can be still inspected.
+func (d *Debugger) handleStop(reason proc.StopReason) error {
+	d.logger.Debug("process stopped", "reason", reason.String())
+
+	// signals which don't stop are printed by notifySignal
+	switch {
+	case reason.Kind == proc.StopSignal || reason.Kind == proc.StopInterrupted || reason.Exited():
+		fmt.Fprintf(d.out, "process %d %s\n", d.target.Pid(), reason)
+	case reason.Kind == proc.StopThreadExited:
+		fmt.Fprintf(d.out, "%s, and thread %d is selected\n", reason, d.target.Tid())
+	case reason.Kind == proc.StopSyscall:
+		d.printSyscall(reason.Syscall)
+	}
+
+	if reason.Exited() && d.onExit != nil {
+		d.onExit(reason)
+	}
+
+	switch reason.Kind {
+	case proc.StopInterrupted:
+		d.printThreads()
+		return errStopped
+	case proc.StopSignal, proc.StopThreadExited, proc.StopSyscall:
+		return errStopped
+	case proc.StopFork, proc.StopExec:
+		// stepping is aborted because the followed process may be another one
+		if err := d.followProcess(reason); err != nil {
+			return err
+		}
+		return errStopped
 	}
+	return nil
+}
 
-	if ws.Exited() {
-		if err := d.quit(); err != nil {
-			fmt.Printf("failed to handle quit: %s\n", err)
-		}
+// errStopped aborts the command which resumes the process when a signal, an interrupt, a system call, fork or exec stops it.
+// errQuit is returned by HandleCommand for quit command, and the caller quits the debugger.
+var errQuit = errors.New("quit")
 
-		fmt.Println("process exited")
-		os.Exit(0)
-	}
+var errStopped = errors.New("process is stopped by a signal, an interrupt, a system call, fork or exec")
 
-	if ws.Signaled() {
-		d.logger.Debug("Process received signal", "signal", ws.Signal())
-		return ws.Signal(), nil
+// interrupt stops the running process. it is called on a goroutine other than the one tracing the process.
+func (d *Debugger) interrupt() error {
+	t := d.interruptTarget.Load()
+	if t == nil {
+		return nil
 	}
 
-	if ws.Stopped() {
-		d.logger.Debug("Process stopped with signal", "signal", ws.StopSignal(), "cause", ws.TrapCause())
-		if err := d.handleStopSignal(); err != nil {
-			return ws.StopSignal(), err
-		}
-		return ws.StopSignal(), nil
-	}
+	return t.Interrupt()
+}
 
-	return 0, nil
+// isReportedStop returns true if err is caused by the stop or the exit of the process, which handleStop has reported.
+// exited is true if the process had exited before the command, and then the command fails as usual.
+func isReportedStop(err error, exited bool) bool {
+	return errors.Is(err, errStopped) || (!exited && errors.Is(err, proc.ErrExited))
 }
 
-func (d *Debugger) handleStopSignal() error {
-	var sigInfo sys.Siginfo
-	_, _, errno := syscall.Syscall6(uintptr(syscall.SYS_PTRACE), uintptr(sys.PTRACE_GETSIGINFO), uintptr(d.pid), 0, uintptr(unsafe.Pointer(&sigInfo)), 0, 0)
+func (d *Debugger) getPC() (uint64, error) {
+	return d.target.PC()
+}
 
-	if errno != 0 {
-		err := sys.Errno(errno)
-		return fmt.Errorf("failed to get siginfo: %s", err)
-	}
+func (d *Debugger) setPC(pc uint64) error {
+	return d.target.SetPC(pc)
+}
 
-	d.logger.Debug("stop by signal", "number", sigInfo.Signo, "code", sigInfo.Code)
+// setBreakpoint sets temporary breakpoint for stepping.
+func (d *Debugger) setBreakpoint(addr uint64) error {
+	d.logger.Debug("set breakpoint", "address", fmt.Sprintf("%0x", addr))
+	return d.target.SetBreakpoint(addr)
+}
 
-	switch sigInfo.Code {
-	case SignalCodeTrapTrace:
-		// When sigle step is called, sig_code will be TRAP_TRACE
-	case SignalCodeTrapBreakpoint, SignalCodeKernel:
-		// When breakpoint is hit, SI_KERNEL or TRAP_BRKPT signal code is sent
-		if err := d.handleHitBreakpoint(); err != nil {
-			return err
-		}
+// setUserBreakpoint sets breakpoint requested by users, which is shown in source listing.
+// location is where users request it, and the breakpoint is set when the process restarts if it has exited.
+func (d *Debugger) setUserBreakpoint(addr uint64, location string) error {
+	if d.target.Exited() {
+		d.breakpointLocations[addr] = location
+		fmt.Fprintf(d.out, "breakpoint at %s is set when the process restarts\n", location)
+		return nil
+	}
+
+	if err := d.target.SetUserBreakpoint(addr); err != nil {
+		return err
 	}
 
+	d.breakpointLocations[addr] = location
 	return nil
 }
 
-func (d *Debugger) handleHitBreakpoint() error {
-	pc, err := d.getPC()
+// setBreakpointAtFunction returns the address of the breakpoint, or 0 if the breakpoint is pending.
+func (d *Debugger) setBreakpointAtFunction(funcname string) (uint64, error) {
+	st, fn, err := d.lookupFunc(funcname)
 	if err != nil {
-		return err
-	}
+		// function may be in a library which will be loaded later
+		if d.loaderBreakpoint == 0 {
+			return 0, err
+		}
 
-	// when INT3 instruction is executed, pc is icremented 1.
-	newPC := pc - 1
-	if err := d.setPC(newPC); err != nil {
-		return err
+		d.pendingBreakpoints = append(d.pendingBreakpoints, funcname)
+		fmt.Fprintf(d.out, "breakpoint at %s is pending until a library containing it is loaded\n", funcname)
+		return 0, nil
 	}
 
-	d.logger.Debug("hit breakpoint", "address", fmt.Sprintf("%0x", newPC))
+	peAddr, err := st.GetPrologueEndAddress(fn)
+	if err != nil {
+		return 0, err
+	}
 
-	return d.printSourceCode()
+	return peAddr, d.setUserBreakpoint(peAddr, funcname)
 }
 
-func (d *Debugger) getPC() (uint64, error) {
-	return d.registerClient.GetRegisterValue(Rip)
-}
+func (d *Debugger) setBreakpointAtLine(filename string, line int) (uint64, error) {
+	addr, err := d.lineAddress(filename, line)
+	if err != nil {
+		return 0, err
+	}
 
-func (d *Debugger) setPC(pc uint64) error {
-	return d.registerClient.SetRegisterValue(Rip, pc)
+	return addr, d.setUserBreakpoint(addr, fmt.Sprintf("%s:%d", filename, line))
 }
 
-func (d *Debugger) setBreakpoint(addr uint64) {
-	bp := NewBreakpoint(d.pid, addr)
-	bp.Enable()
+// lineAddress returns the address of the line in the executable or libraries.
+func (d *Debugger) lineAddress(filename string, line int) (addr uint64, err error) {
+	for _, st := range d.symbolTables() {
+		if addr, err = st.GetNewStatementAddrByLine(filename, line); err == nil {
+			return addr, nil
+		}
+	}
 
-	d.logger.Debug("set breakpoint", "address", fmt.Sprintf("%0x", addr))
-	d.breakpoints[addr] = bp
+	return 0, err
 }
 
-func (d *Debugger) setBreakpointAtFunction(funcname string) error {
-	fn, err := d.symTable.LookupFunc(funcname)
-	if err != nil {
-		return err
+func (d *Debugger) removeBreakpoint(addr uint64) {
+	delete(d.breakpointLocations, addr)
+	if err := d.target.RemoveBreakpoint(addr); err != nil {
+		d.logger.Debug("failed to remove breakpoint", "address", fmt.Sprintf("%0x", addr), "error", err)
 	}
+}
 
-	peAddr, err := d.symTable.GetPrologueEndAddress(fn)
-	if err != nil {
-		return err
-	}
+// hasBreakpoint returns true if breakpoint is set at addr.
+func (d *Debugger) hasBreakpoint(addr uint64) bool {
+	_, ok := d.target.Breakpoint(addr)
+	return ok
+}
 
-	d.setBreakpoint(peAddr)
-	return nil
+// hasUserBreakpoint returns true if breakpoint requested by users is set at addr.
+func (d *Debugger) hasUserBreakpoint(addr uint64) bool {
+	bp, ok := d.target.Breakpoint(addr)
+	return ok && bp.IsUser()
 }
 
-func (d *Debugger) setBreakpointAtLine(filename string, line int) error {
-	addr, err := d.symTable.GetNewStatementAddrByLine(filename, line)
+func (d *Debugger) singleStepInstruction() error {
+	reason, err := d.target.StepInstruction()
 	if err != nil {
 		return err
 	}
 
-	d.setBreakpoint(addr)
-
-	return nil
+	return d.handleStop(reason)
 }
 
-func (d *Debugger) removeBreakpoint(addr uint64) {
-	bp, ok := d.breakpoints[addr]
-	if ok {
-		// breakpoint must be disabled before delete it from map
-		bp.Disable()
-	}
-
-	delete(d.breakpoints, addr)
+func (d *Debugger) handleContinueCommand() error {
+	return d.continueInstruction()
 }
 
-func (d *Debugger) singleStepInstruction() error {
-	pc, err := d.getPC()
+func (d *Debugger) continueInstruction() error {
+	reason, err := d.target.Continue()
 	if err != nil {
 		return err
 	}
 
-	_, ok := d.breakpoints[pc]
-	if ok {
-		return d.stepOverBreakpointIfNeeded()
+	// system calls caught by "catch syscall nostop" are printed, and fork and exec are followed without stopping.
+	// it loops instead of recursion because a program calls many system calls
+	for {
+		if reason.Kind == proc.StopSyscall && d.syscallCatch != nil && !d.syscallCatch.stop {
+			d.printSyscall(reason.Syscall)
+		} else if reason.Kind == proc.StopFork || reason.Kind == proc.StopExec {
+			if err := d.followProcess(reason); err != nil {
+				return err
+			}
+		} else {
+			break
+		}
+
+		if reason, err = d.target.Continue(); err != nil {
+			return err
+		}
 	}
 
-	// if breakpoint is not exist,
-	if err := sys.PtraceSingleStep(d.pid); err != nil {
-		return err
+	// breakpoint for the dynamic loader is not for users
+	if reason.Kind == proc.StopBreakpoint && d.loaderBreakpoint != 0 && reason.Addr == d.loaderBreakpoint {
+		// dynamic loader has loaded or unloaded shared objects
+		if err := d.syncLibraries(); err != nil {
+			fmt.Fprintf(d.out, "failed to read shared libraries: %s\n", err)
+		}
+		return d.continueInstruction()
 	}
 
-	sig, err := d.WaitSignal()
-	if err != nil {
+	if err := d.handleStop(reason); err != nil {
 		return err
 	}
 
-	if sig == sys.SIGURG {
-		return d.singleStepInstruction()
+	if reason.Kind == proc.StopBreakpoint && !d.suppressSourceCode {
+		return d.printSourceCode()
 	}
 
 	return nil
 }
 
-func (d *Debugger) stepOverBreakpointIfNeeded() error {
-	pc, err := d.getPC()
+func (d *Debugger) handleBreakCommand(args []string) error {
+	_, err := d.setBreakpointAtLocation(args)
+	return err
+}
+
+// setBreakpointAtLocation sets breakpoint at an address, a line or a function given to break command.
+// it returns the address of the breakpoint, or 0 if the breakpoint is pending.
+func (d *Debugger) setBreakpointAtLocation(args []string) (uint64, error) {
+	addr, err := strconv.ParseUint(args[0], 16, 64)
 	if err != nil {
-		return err
-	}
+		// break with filename and line number, or line relative to the current line
+		filename, line, ok, err := d.lineLocation(args)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			return d.setBreakpointAtLine(filename, line)
+		}
 
-	bp, ok := d.breakpoints[pc]
-	if !ok {
-		d.logger.Debug("break point is not found", "address", fmt.Sprintf("0x%x", pc))
-		return nil
+		// break by function
+		return d.setBreakpointAtFunction(args[0])
 	}
 
-	if !bp.IsEnabled() {
-		d.logger.Debug("break point is not enabled", "address", fmt.Sprintf("0x%x", pc))
-		return nil
-	}
+	return addr, d.setUserBreakpoint(addr, fmt.Sprintf("%x", addr))
+}
 
-	// handle breakpoint from here
-	if err := bp.Disable(); err != nil {
-		return err
+// clearBreakpoint removes the breakpoint set by users at addr.
+func (d *Debugger) clearBreakpoint(addr uint64) error {
+	if _, ok := d.breakpointLocations[addr]; !ok {
+		return fmt.Errorf("breakpoint at 0x%x is not found", addr)
 	}
 
-	sig := 0
-	for {
-		err := ptraceSingleStep(d.pid, sig)
-		if err != nil {
+	delete(d.breakpointLocations, addr)
+	return d.target.RemoveBreakpoint(addr)
+}
+
+func (d *Debugger) handleRegisterCommand(cmd Command) error {
+	switch cmd.SubType {
+	case DumpSubCommand:
+		if err := d.registerClient.DumpRegisters(d.out); err != nil {
 			return err
 		}
 
-		s, err := d.WaitSignal()
+		// dump x87, SSE and AVX registers too
+		if slices.Contains(cmd.Args, "-all") {
+			return d.registerClient.DumpFPRegisters(d.out)
+		}
+		return nil
+	case GetSubCommand:
+		return d.getRegister(cmd.Args)
+	case SetSubCommand:
+		return d.setRegister(cmd.Args)
+	}
+
+	return fmt.Errorf("unexptected sub command %s is given", cmd.SubType)
+}
+
+// getRegister prints register value. args are register name and optional format of vector register.
+func (d *Debugger) getRegister(args []string) error {
+	name := args[0]
+
+	if !isFPRegister(name) {
+		v, err := d.registerClient.GetRegisterValue(registerByName(name))
 		if err != nil {
 			return err
 		}
 
-		willBreak := false
-		switch s {
-		case sys.SIGTRAP:
-			willBreak = true
-		case sys.SIGILL, sys.SIGBUS, sys.SIGFPE, sys.SIGSEGV, sys.SIGSTKFLT:
-			sig = int(s)
-		}
+		fmt.Fprintf(d.out, "%s: 0x%x\n", name, v)
+		return nil
+	}
 
-		if willBreak {
-			break
-		}
+	fp, err := d.registerClient.GetFPRegisters()
+	if err != nil {
+		return err
 	}
 
-	if err := bp.Enable(); err != nil {
+	b, err := fp.Get(name)
+	if err != nil {
 		return err
 	}
 
+	format := ""
+	if len(args) > 1 {
+		format = args[1]
+	}
+
+	fmt.Fprintf(d.out, "%s: %s\n", name, formatFPRegister(name, b, format))
 	return nil
 }
 
-func (d *Debugger) handleContinueCommand() error {
-	return d.continueInstruction()
-}
+// setRegister sets register value. args are register name, value and optional format of vector register.
+func (d *Debugger) setRegister(args []string) error {
+	if len(args) < 2 {
+		return errors.New("register value must be given")
+	}
+	name := args[0]
 
-func (d *Debugger) continueInstruction() error {
-	if err := d.stepOverBreakpointIfNeeded(); err != nil {
-		return err
+	if !isFPRegister(name) {
+		v, err := strconv.ParseUint(args[1], 0, 64)
+		if err != nil {
+			return err
+		}
+
+		return d.registerClient.SetRegisterValue(registerByName(name), v)
 	}
 
-	pc, err := d.getPC()
+	fp, err := d.registerClient.GetFPRegisters()
 	if err != nil {
 		return err
 	}
 
-	// if breakpoint is hit after step over breakpoint, it doesn't exec ptrace cont
-	_, ok := d.breakpoints[pc]
-	if ok {
-		d.printSourceCode()
-		return nil
+	current, err := fp.Get(name)
+	if err != nil {
+		return err
 	}
 
-	if err := syscall.PtraceCont(d.pid, 0); err != nil {
-		d.logger.Error("failed to cont", "error", err)
-		return err
+	format := ""
+	if len(args) > 2 {
+		format = args[2]
 	}
 
-	sig, err := d.WaitSignal()
+	b, err := parseFPRegisterValue(name, current, args[1], format)
 	if err != nil {
 		return err
 	}
 
-	if sig == sys.SIGURG {
-		return d.continueInstruction()
+	if err := fp.Set(name, b); err != nil {
+		return err
 	}
 
-	return nil
+	return d.registerClient.SetFPRegisters(fp)
 }
 
-func (d *Debugger) handleBreakCommand(args []string) error {
-	addr, err := strconv.ParseUint(args[0], 16, 64)
-	if err != nil {
-		// break with filename and line number when the length of arguments is 2
-		if len(args) == 2 {
-			line, err := strconv.Atoi(args[1])
-			if err != nil {
-				return fmt.Errorf("line number must be number: %s", err)
-			}
+func (d *Debugger) handleSingleStepInstructionCommand() error {
+	if err := d.singleStepInstruction(); err != nil {
+		return err
+	}
 
-			return d.setBreakpointAtLine(args[0], line)
-		}
+	return d.printSourceCode()
+}
 
-		// break by function
-		return d.setBreakpointAtFunction(args[0])
+func (d *Debugger) handleNextInstructionCommand() error {
+	pc, err := d.getPC()
+	if err != nil {
+		return err
 	}
 
-	d.setBreakpoint(addr)
-	return nil
-}
+	inst, err := d.readInstruction(pc)
+	if err != nil {
+		return err
+	}
 
-func (d *Debugger) handleRegisterCommand(cmd Command) error {
-	switch cmd.SubType {
-	case DumpSubCommand:
-		if err := d.registerClient.DumpRegisters(); err != nil {
+	// step over function call by setting breakpoint just after CALL instruction
+	if inst.Op == x86asm.CALL {
+		if err := d.continueToAddress(pc + uint64(inst.Len)); err != nil {
+			return err
+		}
+	} else {
+		if err := d.singleStepInstruction(); err != nil {
 			return err
 		}
-		return nil
 	}
 
-	return fmt.Errorf("unexptected sub command %s is given", cmd.SubType)
+	return d.printSourceCode()
 }
 
-func (d *Debugger) handleSingleStepInstructionCommand() error {
-	if err := d.singleStepInstruction(); err != nil {
+func (d *Debugger) handleStepOutCommand() error {
+	pc, err := d.getPC()
+	if err != nil {
 		return err
 	}
 
-	return d.printSourceCode()
-}
-
-func (d *Debugger) handleStepOutCommand() error {
 	rbp, err := d.registerClient.GetRegisterValue(Rbp)
 	if err != nil {
 		return fmt.Errorf("faield to read register in step out command: %s", err)
@@ -412,18 +653,63 @@ func (d *Debugger) handleStepOutCommand() error {
 		return err
 	}
 
-	_, ok := d.breakpoints[returnAddress]
-	if !ok {
-		d.setBreakpoint(returnAddress)
+	// names and types of return values are read in the frame of callee, and values are read from
+	// result registers after returning because locations of results are not evaluated before the RET
+	returnValues, err := d.symTableForPC(pc).GetReturnValues(pc, d.registerClient, d.readMemoryBytes)
+	if err != nil {
+		d.logger.Debug("failed to get return values", "error", err)
 	}
 
-	if err := d.continueInstruction(); err != nil {
-		return err
+	ok := d.hasBreakpoint(returnAddress)
+	if !ok {
+		if err := d.setBreakpoint(returnAddress); err != nil {
+			return err
+		}
 	}
 
+	// the temporary breakpoint is removed even if a signal or an interrupt stops the process
+	err = d.continueInstruction()
 	if !ok {
 		d.removeBreakpoint(returnAddress)
 	}
+	if err != nil {
+		return err
+	}
+
+	newPC, err := d.getPC()
+	if err != nil {
+		return err
+	}
+
+	// another breakpoint is hit before returning from function
+	if newPC != returnAddress {
+		return nil
+	}
+
+	if fn := d.symTableForPC(pc).PCToFunc(pc); fn != nil && len(returnValues) > 0 {
+		fmt.Fprintf(d.out, "%s returned:\n", fn.Name)
+	}
+
+	types := make([]dwarf.Type, len(returnValues))
+	for i, v := range returnValues {
+		types[i] = v.dwarfType
+	}
+
+	for i, pieces := range assignResults(types) {
+		v := returnValues[i]
+		if pieces == nil {
+			// the result on the stack may be overwritten by the caller
+			fmt.Fprintf(d.out, "  %s %s = unavailable\n", v.Name, v.Type)
+			continue
+		}
+
+		value, err := d.readVariable(Variable{Name: v.Name, Type: v.Type, Pieces: pieces, dwarfType: v.dwarfType}, d.registerClient)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(d.out, "  %s %s = %s\n", v.Name, v.Type, value)
+	}
 
 	return nil
 }
@@ -434,7 +720,7 @@ func (d *Debugger) handleStepInCommand() error {
 		return err
 	}
 
-	filename, line, _ := d.symTable.PCToLine(pc)
+	filename, line, _ := d.symTableForPC(pc).PCToLine(pc)
 
 	if err := d.stepIn(filename, line); err != nil {
 		return err
@@ -449,12 +735,13 @@ func (d *Debugger) handleNextCommand() error {
 		return err
 	}
 
-	startLine, endLine, err := d.symTable.GetCurrentFuncStartToEndLine(pc)
+	st := d.symTableForPC(pc)
+	startLine, endLine, err := st.GetCurrentFuncStartToEndLine(pc)
 	if err != nil {
 		return err
 	}
 
-	filename, currentLine, _ := d.symTable.PCToLine(pc)
+	filename, currentLine, _ := st.PCToLine(pc)
 
 	var deletingBreakpointAddresses []uint64
 	for l := startLine; l <= endLine; l++ {
@@ -462,17 +749,18 @@ func (d *Debugger) handleNextCommand() error {
 			continue
 		}
 
-		addr, err := d.symTable.GetNewStatementAddrByLine(filename, l)
+		addr, err := st.GetNewStatementAddrByLine(filename, l)
 		if err != nil {
 			continue
 		}
 
-		_, ok := d.breakpoints[addr]
-		if ok {
+		if d.hasBreakpoint(addr) {
 			continue
 		}
 
-		d.setBreakpoint(addr)
+		if err := d.setBreakpoint(addr); err != nil {
+			continue
+		}
 		deletingBreakpointAddresses = append(deletingBreakpointAddresses, addr)
 	}
 
@@ -481,219 +769,284 @@ func (d *Debugger) handleNextCommand() error {
 		return err
 	}
 
-	returnAddr, err := d.readMemory(rbp)
+	// return address is just above the saved rbp
+	returnAddr, err := d.readMemory(rbp + 8)
 	if err != nil {
 		return err
 	}
 
-	etextAddr := d.symTable.GetRuntimeETextAddress()
-
-	if returnAddr != 0 && returnAddr <= etextAddr {
-		_, ok := d.breakpoints[returnAddr]
-		if !ok {
-			fmt.Printf("set breakpoint at RBP (return address) %x\n", returnAddr)
-			d.setBreakpoint(returnAddr)
+	// return address must be in text, which may be relocated
+	if returnAddr != 0 && d.symTableForPC(returnAddr).PCToFunc(returnAddr) != nil {
+		if !d.hasBreakpoint(returnAddr) && d.setBreakpoint(returnAddr) == nil {
+			d.logger.Debug("set breakpoint at return address", "address", fmt.Sprintf("%x", returnAddr))
 			deletingBreakpointAddresses = append(deletingBreakpointAddresses, returnAddr)
 		}
 	}
 
-	if err := d.continueInstruction(); err != nil {
-		return fmt.Errorf("failed to continue in next %s", err)
-	}
-
+	// temporary breakpoints are removed even if a signal or an interrupt stops the process
+	err = d.continueInstruction()
 	for _, addr := range deletingBreakpointAddresses {
 		d.removeBreakpoint(addr)
 	}
+	if errors.Is(err, errStopped) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to continue in next %s", err)
+	}
 
 	return nil
 }
 
 func (d *Debugger) handleBacktraceCommand() error {
-	frameNumber := 1
-	output := func(pc uint64) {
-		funcname, filename, line := d.symTable.GetFuncInfo(pc)
-		fmt.Printf("frame#%d\t0x%x\t%s\t%s:%d\n", frameNumber, pc, funcname, filename, line)
-		frameNumber++
-	}
-
-	currentPC, err := d.getPC()
+	frames, err := d.currentStackFrames()
 	if err != nil {
 		return err
 	}
 
-	output(currentPC)
+	for i, f := range frames {
+		fmt.Fprintf(d.out, "frame#%d\t0x%x\t%s\t%s:%d\n", i+1, f.pc, f.funcname, f.filename, f.line)
+	}
 
-	framePointer, err := d.registerClient.GetRegisterValue(Rbp)
+	return nil
+}
+
+func (d *Debugger) handleVariableCommand() error {
+	pc, err := d.getPC()
 	if err != nil {
 		return err
 	}
 
-	returnAddress, err := d.readMemory(framePointer + 8)
+	variables, err := d.symTableForPC(pc).GetVariables(pc, d.registerClient, d.readMemoryBytes)
 	if err != nil {
 		return err
 	}
 
-	// TODO: back trace has some bugs
-	//       some function isn't show in backtrace...
-	for {
-		funcname, _, _ := d.symTable.GetFuncInfo(currentPC)
-		if funcname == MainFunctionSymbol {
-			break
-		}
-
-		currentPC = returnAddress
-		output(currentPC)
-
-		framePointer, err = d.readMemory(framePointer)
+	// a variable which can't be read doesn't hide the others
+	for _, variable := range variables {
+		v, err := d.readVariable(variable, d.registerClient)
 		if err != nil {
-			return fmt.Errorf("faield to get frame pointer: %s", err)
+			v = fmt.Sprintf("<%s>", err)
 		}
 
-		returnAddress, err = d.readMemory(framePointer + 8)
-		if err != nil {
-			return fmt.Errorf("faield to get return address: %s", err)
-		}
+		fmt.Fprintf(d.out, "variable %s: %v\n", variable.Name, v)
 	}
 
 	return nil
 }
 
-func (d *Debugger) handleVariableCommand() error {
-	pc, err := d.getPC()
+// handlePrintCommand prints the variable of the current function, or the value of an address expression.
+func (d *Debugger) handlePrintCommand(args []string) error {
+	expr := strings.Join(args, " ")
+	typ, value, err := d.evalExpression(expr)
 	if err != nil {
 		return err
 	}
 
-	rsp, err := d.registerClient.GetRegisterValue(Rsp)
-	if err != nil {
-		return err
-	}
+	fmt.Fprintf(d.out, "%s %s = %s\n", expr, typ, value)
+	return nil
+}
 
-	variables, err := d.symTable.GetVariables(pc, rsp)
+// evalExpression evaluates a variable of the current function, or an address expression of x command.
+func (d *Debugger) evalExpression(expr string) (typ string, value string, err error) {
+	pc, err := d.getPC()
 	if err != nil {
-		return err
+		return "", "", err
 	}
 
-	for _, variable := range variables {
-		v, err := d.readInt(variable.Address)
-		if err != nil {
-			return err
+	variables, err := d.symTableForPC(pc).GetVariables(pc, d.registerClient, d.readMemoryBytes)
+	if err == nil {
+		for _, v := range variables {
+			if v.Name != expr {
+				continue
+			}
+
+			value, err := d.readVariable(v, d.registerClient)
+			if err != nil {
+				return "", "", err
+			}
+
+			return v.Type, value, nil
 		}
+	}
 
-		fmt.Printf("variable %s: %v\n", variable.Name, v)
+	addr, err := d.evalAddress(expr)
+	if err != nil {
+		return "", "", fmt.Errorf("%s is neither a variable nor an address: %s", expr, err)
 	}
 
-	return nil
+	return "uintptr", fmt.Sprintf("0x%x", addr), nil
 }
 
-func (d *Debugger) quit() error {
-	if err := os.Remove(d.debugeeBinaryPath); err != nil {
-		return err
+func (d *Debugger) handleConfigCommand(args []string) error {
+	if len(args) == 0 {
+		d.config.Print(d.out)
+		return nil
 	}
 
-	for _, bp := range d.breakpoints {
-		if err := bp.Disable(); err != nil {
-			// if failed to disable breakpoint, child process already completed.
-			break
+	return d.config.Set(args[0], args[1:])
+}
+
+func (d *Debugger) quit() error {
+	if d.builtBinaryPath != "" {
+		if err := os.Remove(d.builtBinaryPath); err != nil {
+			return err
 		}
 	}
 
 	// ignore error because if failed to detach, child process already completed.
-	syscall.PtraceDetach(d.pid)
-
-	os.Exit(0)
+	d.saveInferior()
+	for _, inf := range d.inferiors {
+		inf.target.Detach()
+		inf.close()
+	}
 
 	return nil
 }
 
 func (d *Debugger) stepIn(filename string, line int) error {
+	for {
+		pc, err := d.getPC()
+		if err != nil {
+			return err
+		}
+
+		f, l, _ := d.symTableForPC(pc).PCToLine(pc)
+		if f != filename || l != line {
+			return nil
+		}
+
+		inst, err := d.readInstruction(pc)
+		if err == nil && inst.Op == x86asm.CALL {
+			stepped, err := d.stepIntoCall()
+			if err != nil {
+				return err
+			}
+
+			if stepped {
+				return nil
+			}
+			continue
+		}
+
+		if err := d.singleStepInstruction(); err != nil {
+			return err
+		}
+	}
+}
+
+// stepIntoCall executes CALL instruction at current pc and stops at prologue end of callee.
+// if callee should be skipped, it returns to caller and stepped is false.
+func (d *Debugger) stepIntoCall() (stepped bool, err error) {
+	if err := d.singleStepInstruction(); err != nil {
+		return false, err
+	}
+
 	pc, err := d.getPC()
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	for f, l, _ := d.symTable.PCToLine(pc); f == filename && l == line; f, l, _ = d.symTable.PCToLine(pc) {
-		d.singleStepInstruction()
-		pc, err = d.getPC()
+	st := d.symTableForPC(pc)
+	fn := st.PCToFunc(pc)
+	if fn == nil || d.shouldSkipFunction(fn) {
+		rsp, err := d.registerClient.GetRegisterValue(Rsp)
 		if err != nil {
-			return err
+			return false, err
+		}
+
+		// return address is on the top of stack just after CALL instruction
+		returnAddress, err := d.readMemory(rsp)
+		if err != nil {
+			return false, err
 		}
+
+		return false, d.continueToAddress(returnAddress)
 	}
 
-	return nil
-}
+	d.logger.Debug("step into function", "function", fn.Name)
 
-func (d *Debugger) readMemory(addr uint64) (uint64, error) {
-	// data is 8 byte to store uint64 value
-	data := make([]byte, 8)
-	_, err := sys.PtracePeekData(d.pid, uintptr(addr), data)
+	peAddr, err := st.GetPrologueEndAddress(fn)
 	if err != nil {
-		return 0, fmt.Errorf("failed to readMemory: %s", err)
+		// stop at function entry if prologue end is not found
+		return true, nil
 	}
 
-	return binary.LittleEndian.Uint64(data), nil
+	return true, d.continueToAddress(peAddr)
 }
 
-func (d *Debugger) readInt(addr uint64) (int, error) {
-	// data is 8 byte to store uint64 value
-	data := make([]byte, 8)
-	_, err := sys.PtracePeekData(d.pid, uintptr(addr), data)
-	if err != nil {
-		return 0, fmt.Errorf("failed to readMemory: %s", err)
+func (d *Debugger) shouldSkipFunction(fn *gosym.Func) bool {
+	if strings.HasPrefix(fn.Name, "runtime.morestack") || fn.Name == "runtime.deferreturn" {
+		return true
 	}
 
-	return int(binary.LittleEndian.Uint64(data)), nil
+	// wrapper functions generated by compiler
+	if filename, _, _ := d.symTableForPC(fn.Entry).PCToLine(fn.Entry); filename == "<autogenerated>" {
+		return true
+	}
+
+	return slices.Contains(d.config.skipPackages, fn.PackageName())
 }
 
-func (d *Debugger) printSourceCode() error {
-	pc, err := d.getPC()
-	if err != nil {
-		return err
+// continueToAddress sets temporary breakpoint at addr and continues without printing source code.
+func (d *Debugger) continueToAddress(addr uint64) error {
+	ok := d.hasBreakpoint(addr)
+	if !ok {
+		if err := d.setBreakpoint(addr); err != nil {
+			return err
+		}
 	}
 
-	filename, line, _ := d.symTable.PCToLine(pc)
+	// callers like the API server may suppress source code for the whole request
+	prev := d.suppressSourceCode
+	d.suppressSourceCode = true
+	err := d.continueInstruction()
+	d.suppressSourceCode = prev
 
-	f, err := os.Open(filename)
-	if err != nil {
-		return err
+	if !ok {
+		d.removeBreakpoint(addr)
 	}
-	defer f.Close()
-
-	printSourceCode(f, line)
 
-	return nil
+	return err
 }
 
-func executeDebuggeeProcess(debuggeePath string) (pid int, err error) {
-	// lock os thread prevent go runtime changes thread id
-	runtime.LockOSThread()
+func (d *Debugger) readMemory(addr uint64) (uint64, error) {
+	v, err := d.target.ReadWord(addr)
+	if err != nil {
+		return 0, fmt.Errorf("%s (%s)", err, d.explainAddress(addr))
+	}
 
-	cmd := exec.Command(debuggeePath)
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	return v, nil
+}
 
-	cmd.SysProcAttr = &syscall.SysProcAttr{
-		Ptrace: true,
+// readMemoryBytes reads memory of debuggee, and breakpoint instructions are
+// replaced with original instructions.
+func (d *Debugger) readMemoryBytes(addr uint64, size int) ([]byte, error) {
+	data, err := d.target.ReadMemory(addr, size)
+	if err != nil {
+		return nil, fmt.Errorf("%s (%s)", err, d.explainAddress(addr))
 	}
 
-	// set personality not to randomize address
-	// this code is based on delve(https://github.com/go-delve/delve/tree/v1.22.1).
-	// Copyright (c) 2014 Derek Parker
-	// MIT LICENSE: https://github.com/go-delve/delve/blob/v1.22.1/LICENSE
-	var personalityGetPersonality uintptr = 0xffffffff // argument to pass to personality syscall to get the current personality
-	var _ADDR_NO_RANDOMIZE uintptr = 0x0040000         // ADDR_NO_RANDOMIZE linux constant
+	return data, nil
+}
 
-	oldPersonality, _, err := syscall.Syscall(sys.SYS_PERSONALITY, personalityGetPersonality, 0, 0)
-	if err == syscall.Errno(0) {
-		newPersonality := oldPersonality | _ADDR_NO_RANDOMIZE
-		syscall.Syscall(sys.SYS_PERSONALITY, newPersonality, 0, 0)
-		defer syscall.Syscall(sys.SYS_PERSONALITY, oldPersonality, 0, 0)
+func (d *Debugger) printSourceCode() error {
+	if d.suppressSourceCode {
+		return nil
 	}
 
-	if err := cmd.Start(); err != nil {
-		log.Fatalf("failed to start command: %s", err)
+	pc, err := d.getPC()
+	if err != nil {
+		return err
+	}
+
+	filename, line, _ := d.symTableForPC(pc).PCToLine(pc)
+	// the program not built by Go has no lines
+	if filename == "" {
+		fmt.Fprintf(d.out, "stopped at 0x%x\n", pc)
+		return nil
 	}
+	context := d.config.sourceContext
 
-	return cmd.Process.Pid, nil
+	return d.listSource(filename, line-context, line+context)
 }
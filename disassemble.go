@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/arch/x86/x86asm"
+)
+
+// handleDisassembleCommand disassembles instructions in memory of the process,
+// or in the file if the process has exited, where a function or addresses must be given.
+func (d *Debugger) handleDisassembleCommand(args []string) error {
+	var pc uint64
+	if !d.target.Exited() {
+		var err error
+		if pc, err = d.getPC(); err != nil {
+			return err
+		}
+	} else if len(args) == 0 {
+		return errors.New("the process is not running, so that a function or addresses must be given")
+	}
+
+	start, end, err := d.disassembleRange(pc, args)
+	if err != nil {
+		return err
+	}
+
+	return d.disassemble(start, end, pc)
+}
+
+// disassembleRange returns the address range from arguments.
+// no argument means current function, one argument means function name or address in the function,
+// and two arguments means start address and end address.
+func (d *Debugger) disassembleRange(pc uint64, args []string) (start uint64, end uint64, err error) {
+	switch len(args) {
+	case 0:
+		fn := d.symTableForPC(pc).PCToFunc(pc)
+		if fn == nil {
+			return 0, 0, fmt.Errorf("no function is found for pc 0x%x", pc)
+		}
+		return fn.Entry, fn.End, nil
+	case 1:
+		addr, err := parseAddress(args[0])
+		if err != nil {
+			_, fn, err := d.lookupFunc(args[0])
+			if err != nil {
+				return 0, 0, err
+			}
+			return fn.Entry, fn.End, nil
+		}
+
+		fn := d.symTableForPC(addr).PCToFunc(addr)
+		if fn == nil {
+			return 0, 0, fmt.Errorf("no function is found for address 0x%x", addr)
+		}
+		return fn.Entry, fn.End, nil
+	case 2:
+		start, err := parseAddress(args[0])
+		if err != nil {
+			return 0, 0, err
+		}
+
+		end, err := parseAddress(args[1])
+		if err != nil {
+			return 0, 0, err
+		}
+
+		if start >= end {
+			return 0, 0, errors.New("start address must be less than end address")
+		}
+		return start, end, nil
+	}
+
+	return 0, 0, errors.New("disassemble command takes at most 2 arguments")
+}
+
+func (d *Debugger) disassemble(start uint64, end uint64, pc uint64) error {
+	code, err := d.readCode(start, int(end-start))
+	if err != nil {
+		return err
+	}
+
+	symname := func(addr uint64) (string, uint64) {
+		fn := d.symTableForPC(addr).PCToFunc(addr)
+		if fn == nil {
+			return "", 0
+		}
+		return fn.Name, fn.Entry
+	}
+
+	for addr := start; addr < start+uint64(len(code)); {
+		offset := addr - start
+
+		marker := "  "
+		if addr == pc {
+			marker = "=>"
+		}
+
+		filename, line, _ := d.symTableForPC(addr).PCToLine(addr)
+		location := fmt.Sprintf("%s:%d", filepath.Base(filename), line)
+
+		inst, err := x86asm.Decode(code[offset:], 64)
+		if err != nil {
+			fmt.Fprintf(d.out, "%s 0x%x\t%s\t?\n", marker, addr, location)
+			addr++
+			continue
+		}
+
+		fmt.Fprintf(d.out, "%s 0x%x\t%s\t%x\t%s\n", marker, addr, location, code[offset:offset+uint64(inst.Len)], x86asm.GoSyntax(inst, addr, symname))
+		addr += uint64(inst.Len)
+	}
+
+	return nil
+}
+
+// readCode reads instructions from memory of the process, where breakpoint instructions are replaced with original instructions,
+// or from the binary if the process has exited.
+func (d *Debugger) readCode(addr uint64, size int) ([]byte, error) {
+	if !d.target.Exited() {
+		return d.readMemoryBytes(addr, size)
+	}
+
+	return d.symTableForPC(addr).ReadCode(addr, size)
+}
+
+// parseAddress parses hexadecimal address with or without 0x prefix.
+func parseAddress(s string) (uint64, error) {
+	return strconv.ParseUint(strings.TrimPrefix(s, "0x"), 16, 64)
+}
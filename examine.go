@@ -0,0 +1,270 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/arch/x86/x86asm"
+)
+
+const (
+	examineFormatHex         = 'x'
+	examineFormatDecimal     = 'd'
+	examineFormatUnsigned    = 'u'
+	examineFormatChar        = 'c'
+	examineFormatString      = 's'
+	examineFormatInstruction = 'i'
+)
+
+// the number of bytes printed in one line of hexdump
+const examineBytesPerLine = 16
+
+// the maximum length of string read by x/s
+const examineMaxStringLength = 256
+
+// the maximum number of bytes examined at once, so that a large count doesn't exhaust memory of the debugger
+const examineMaxBytes = 4 << 20
+
+type examineFormat struct {
+	count  int
+	format byte
+	size   int
+}
+
+// parseExamineFormat parses format like "4xg" (count, format and size).
+func parseExamineFormat(s string) (examineFormat, error) {
+	f := examineFormat{count: 1, format: examineFormatHex, size: 8}
+
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+
+	if i > 0 {
+		count, err := strconv.Atoi(s[:i])
+		if err != nil {
+			return f, err
+		}
+		f.count = count
+	}
+
+	for _, c := range []byte(s[i:]) {
+		switch c {
+		case examineFormatHex, examineFormatDecimal, examineFormatUnsigned, examineFormatChar, examineFormatString, examineFormatInstruction:
+			f.format = c
+		case 'b':
+			f.size = 1
+		case 'h':
+			f.size = 2
+		case 'w':
+			f.size = 4
+		case 'g':
+			f.size = 8
+		default:
+			return f, fmt.Errorf("unknown format '%c' is given", c)
+		}
+	}
+
+	if f.format == examineFormatChar {
+		f.size = 1
+	}
+
+	if f.count <= 0 {
+		return f, errors.New("count must be positive")
+	}
+	if f.count > examineMaxBytes/f.size {
+		return f, fmt.Errorf("%d units of %d bytes exceed %d bytes", f.count, f.size, examineMaxBytes)
+	}
+
+	return f, nil
+}
+
+func (d *Debugger) handleExamineCommand(cmd Command) error {
+	if len(cmd.Args) == 0 {
+		return errors.New("address must be given")
+	}
+
+	f, err := parseExamineFormat(cmd.SubType)
+	if err != nil {
+		return err
+	}
+
+	addr, err := d.evalAddress(strings.Join(cmd.Args, ""))
+	if err != nil {
+		return err
+	}
+
+	switch f.format {
+	case examineFormatString:
+		return d.examineString(addr, f.count)
+	case examineFormatInstruction:
+		return d.examineInstruction(addr, f.count)
+	}
+
+	data, err := d.readMemoryBytes(addr, f.count*f.size)
+	if err != nil {
+		return err
+	}
+
+	if len(data) < f.count*f.size {
+		fmt.Fprintf(d.out, "only %d bytes are readable\n", len(data))
+	}
+
+	for offset := 0; offset < len(data); offset += examineBytesPerLine {
+		line := data[offset:min(offset+examineBytesPerLine, len(data))]
+
+		var values []string
+		for i := 0; i+f.size <= len(line); i += f.size {
+			values = append(values, formatExamineValue(line[i:i+f.size], f.format))
+		}
+
+		fmt.Fprintf(d.out, "0x%x%s:\t%s\t|%s|\n", addr+uint64(offset), d.symbolAnnotation(addr+uint64(offset)), strings.Join(values, " "), printableASCII(line))
+	}
+
+	return nil
+}
+
+func (d *Debugger) examineString(addr uint64, count int) error {
+	for i := 0; i < count; i++ {
+		data, err := d.readMemoryBytes(addr, examineMaxStringLength)
+		if err != nil {
+			return err
+		}
+
+		n := len(data)
+		for j, b := range data {
+			if b == 0 {
+				n = j
+				break
+			}
+		}
+
+		fmt.Fprintf(d.out, "0x%x%s:\t%q\n", addr, d.symbolAnnotation(addr), data[:n])
+
+		// skip null character
+		addr += uint64(n) + 1
+	}
+
+	return nil
+}
+
+func (d *Debugger) examineInstruction(addr uint64, count int) error {
+	pc, err := d.getPC()
+	if err != nil {
+		return err
+	}
+
+	symname := func(addr uint64) (string, uint64) {
+		name, offset, ok := d.symTableForPC(addr).LookupSymbolByAddr(addr)
+		if !ok {
+			return "", 0
+		}
+		return name, addr - offset
+	}
+
+	for i := 0; i < count; i++ {
+		inst, err := d.readInstruction(addr)
+		if err != nil {
+			return err
+		}
+
+		marker := "  "
+		if addr == pc {
+			marker = "=>"
+		}
+
+		fmt.Fprintf(d.out, "%s 0x%x%s:\t%s\n", marker, addr, d.symbolAnnotation(addr), x86asm.GoSyntax(inst, addr, symname))
+		addr += uint64(inst.Len)
+	}
+
+	return nil
+}
+
+// evalAddress evaluates address expression like "0xc000012345", "$rsp+8" or "main.main".
+func (d *Debugger) evalAddress(expr string) (uint64, error) {
+	base := expr
+	var offset int64
+
+	if i := strings.LastIndexAny(expr, "+-"); i > 0 {
+		n, err := strconv.ParseInt(expr[i+1:], 0, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid offset %s: %s", expr[i+1:], err)
+		}
+
+		base = expr[:i]
+		offset = n
+		if expr[i] == '-' {
+			offset = -n
+		}
+	}
+
+	var addr uint64
+	switch {
+	case strings.HasPrefix(base, "$"):
+		v, err := d.registerClient.GetRegisterValue(registerByName(base[1:]))
+		if err != nil {
+			return 0, err
+		}
+		addr = v
+	default:
+		v, err := parseAddress(base)
+		if err != nil {
+			v, err = d.lookupSymbolByName(base)
+			if err != nil {
+				return 0, err
+			}
+		}
+		addr = v
+	}
+
+	return uint64(int64(addr) + offset), nil
+}
+
+// symbolAnnotation returns string like " <main.main+12>" if addr is in function or global variable.
+func (d *Debugger) symbolAnnotation(addr uint64) string {
+	name, offset, ok := d.symTableForPC(addr).LookupSymbolByAddr(addr)
+	if !ok {
+		return ""
+	}
+
+	if offset == 0 {
+		return fmt.Sprintf(" <%s>", name)
+	}
+
+	return fmt.Sprintf(" <%s+%d>", name, offset)
+}
+
+func formatExamineValue(data []byte, format byte) string {
+	var v uint64
+	for i := len(data) - 1; i >= 0; i-- {
+		v = v<<8 | uint64(data[i])
+	}
+
+	switch format {
+	case examineFormatDecimal:
+		// sign extension
+		shift := 64 - 8*len(data)
+		return strconv.FormatInt(int64(v<<shift)>>shift, 10)
+	case examineFormatUnsigned:
+		return strconv.FormatUint(v, 10)
+	case examineFormatChar:
+		return fmt.Sprintf("%d %q", v, rune(v))
+	}
+
+	return fmt.Sprintf("0x%0*x", 2*len(data), v)
+}
+
+func printableASCII(data []byte) string {
+	b := make([]byte, len(data))
+	for i, c := range data {
+		if c >= 0x20 && c < 0x7f {
+			b[i] = c
+		} else {
+			b[i] = '.'
+		}
+	}
+
+	return string(b)
+}
@@ -0,0 +1,33 @@
+package main
+
+import "testing"
+
+func TestParseExamineFormat(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    examineFormat
+		wantErr bool
+	}{
+		{s: "", want: examineFormat{count: 1, format: examineFormatHex, size: 8}},
+		{s: "4xw", want: examineFormat{count: 4, format: examineFormatHex, size: 4}},
+		{s: "16c", want: examineFormat{count: 16, format: examineFormatChar, size: 1}},
+		{s: "524288xg", want: examineFormat{count: 524288, format: examineFormatHex, size: 8}},
+		{s: "524289xg", wantErr: true},
+		{s: "100000000000xg", wantErr: true},
+		{s: "0x", wantErr: true},
+		{s: "4q", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseExamineFormat(tt.s)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseExamineFormat(%q) = %+v, want error", tt.s, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseExamineFormat(%q) = %+v, %v, want %+v", tt.s, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,514 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	sys "golang.org/x/sys/unix"
+)
+
+const (
+	// NT_X86_XSTATE is defined in linux/elf.h
+	ntX86XState = 0x202
+
+	// size of FXSAVE area which is returned by PTRACE_GETFPREGS
+	fxsaveSize = 512
+	// XSAVE area is larger than FXSAVE area when AVX-512 is supported, and much larger when AMX is supported.
+	xsaveInitialSize = 4096
+	xsaveMaxSize     = 1 << 20
+
+	// offsets in FXSAVE area
+	// @see Intel SDM Vol.1 10.5.1 FXSAVE Area
+	fxsaveFCWOffset   = 0
+	fxsaveFSWOffset   = 2
+	fxsaveFTWOffset   = 4
+	fxsaveFOPOffset   = 6
+	fxsaveFIPOffset   = 8
+	fxsaveFDPOffset   = 16
+	fxsaveMXCSROffset = 24
+	fxsaveSTOffset    = 32
+	fxsaveXMMOffset   = 160
+
+	// offsets in XSAVE area (standard format)
+	// @see Intel SDM Vol.1 13.4 XSAVE Area
+	xsaveHeaderOffset = 512
+	xsaveAVXOffset    = 576
+	// XSTATE_BV bits for x87, SSE and AVX state
+	xstateX87 = 1 << 0
+	xstateSSE = 1 << 1
+	xstateAVX = 1 << 2
+)
+
+const (
+	numXMMRegisters = 16
+	numSTRegisters  = 8
+)
+
+// FPRegisters is x87, SSE and AVX registers in XSAVE (or FXSAVE) area.
+type FPRegisters struct {
+	data []byte
+}
+
+func (c RegisterClient) GetFPRegisters() (*FPRegisters, error) {
+	// XSAVE area is truncated to the buffer, but the whole area is needed to set registers.
+	// so that the buffer is grown until the area fits in it.
+	for size := xsaveInitialSize; ; size *= 2 {
+		data := make([]byte, size)
+		iov := sys.Iovec{Base: &data[0]}
+		iov.SetLen(len(data))
+
+		_, _, errno := sys.Syscall6(sys.SYS_PTRACE, sys.PTRACE_GETREGSET, uintptr(c.threadID()), ntX86XState, uintptr(unsafe.Pointer(&iov)), 0, 0)
+		if errno != 0 {
+			break
+		}
+		if int(iov.Len) < size || size >= xsaveMaxSize {
+			return &FPRegisters{data: data[:iov.Len]}, nil
+		}
+	}
+
+	// fall back to FXSAVE area if XSAVE is not supported
+	data := make([]byte, fxsaveSize)
+	_, _, errno := sys.Syscall6(sys.SYS_PTRACE, sys.PTRACE_GETFPREGS, uintptr(c.threadID()), 0, uintptr(unsafe.Pointer(&data[0])), 0, 0)
+	if errno != 0 {
+		return nil, fmt.Errorf("failed to get fp registers for thread %d: %s", c.threadID(), sys.Errno(errno))
+	}
+
+	return &FPRegisters{data: data}, nil
+}
+
+func (c RegisterClient) SetFPRegisters(fp *FPRegisters) error {
+	if len(fp.data) == fxsaveSize {
+		_, _, errno := sys.Syscall6(sys.SYS_PTRACE, sys.PTRACE_SETFPREGS, uintptr(c.threadID()), 0, uintptr(unsafe.Pointer(&fp.data[0])), 0, 0)
+		if errno != 0 {
+			return fmt.Errorf("failed to set fp registers for thread %d: %s", c.threadID(), sys.Errno(errno))
+		}
+		return nil
+	}
+
+	iov := sys.Iovec{Base: &fp.data[0]}
+	iov.SetLen(len(fp.data))
+	_, _, errno := sys.Syscall6(sys.SYS_PTRACE, sys.PTRACE_SETREGSET, uintptr(c.threadID()), ntX86XState, uintptr(unsafe.Pointer(&iov)), 0, 0)
+	if errno != 0 {
+		return fmt.Errorf("failed to set fp registers for thread %d: %s", c.threadID(), sys.Errno(errno))
+	}
+
+	return nil
+}
+
+func (c RegisterClient) DumpFPRegisters(w io.Writer) error {
+	fp, err := c.GetFPRegisters()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range fp.Names() {
+		b, err := fp.Get(name)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(w, "%s: %s\n", name, formatFPRegister(name, b, ""))
+	}
+
+	return nil
+}
+
+// HasAVX returns true if upper halves of YMM registers are available.
+func (fp *FPRegisters) HasAVX() bool {
+	return len(fp.data) >= xsaveAVXOffset+numXMMRegisters*16
+}
+
+func (fp *FPRegisters) Names() []string {
+	names := []string{"fcw", "fsw", "ftw", "fop", "mxcsr"}
+	for i := 0; i < numSTRegisters; i++ {
+		names = append(names, fmt.Sprintf("st%d", i))
+	}
+
+	prefix := "x"
+	if fp.HasAVX() {
+		prefix = "y"
+	}
+	for i := 0; i < numXMMRegisters; i++ {
+		names = append(names, fmt.Sprintf("%s%d", prefix, i))
+	}
+
+	return names
+}
+
+// Get returns raw bytes of the register in little endian.
+func (fp *FPRegisters) Get(name string) ([]byte, error) {
+	kind, n, err := parseFPRegisterName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	switch kind {
+	case "y":
+		if !fp.HasAVX() {
+			return nil, fmt.Errorf("AVX registers are not supported")
+		}
+
+		b := slices.Clone(fp.data[fxsaveXMMOffset+16*n : fxsaveXMMOffset+16*(n+1)])
+		// upper halves are zero when XSTATE_BV doesn't have AVX bit (initial state)
+		if binary.LittleEndian.Uint64(fp.data[xsaveHeaderOffset:])&xstateAVX == 0 {
+			return append(b, make([]byte, 16)...), nil
+		}
+		return append(b, fp.data[xsaveAVXOffset+16*n:xsaveAVXOffset+16*(n+1)]...), nil
+	}
+
+	offset, size := fpRegisterLocation(kind, n)
+	return slices.Clone(fp.data[offset : offset+size]), nil
+}
+
+// Set sets raw bytes of the register in little endian.
+func (fp *FPRegisters) Set(name string, value []byte) error {
+	kind, n, err := parseFPRegisterName(name)
+	if err != nil {
+		return err
+	}
+
+	if kind == "y" {
+		if !fp.HasAVX() {
+			return fmt.Errorf("AVX registers are not supported")
+		}
+		if len(value) != 32 {
+			return fmt.Errorf("%s must be 32 bytes", name)
+		}
+
+		copy(fp.data[fxsaveXMMOffset+16*n:], value[:16])
+		copy(fp.data[xsaveAVXOffset+16*n:], value[16:])
+		binary.LittleEndian.PutUint64(fp.data[xsaveHeaderOffset:], binary.LittleEndian.Uint64(fp.data[xsaveHeaderOffset:])|xstateSSE|xstateAVX)
+		return nil
+	}
+
+	offset, size := fpRegisterLocation(kind, n)
+	if len(value) != size {
+		return fmt.Errorf("%s must be %d bytes", name, size)
+	}
+	copy(fp.data[offset:offset+size], value)
+
+	// registers in initial state are not set unless XSTATE_BV has the bit
+	if len(fp.data) > fxsaveSize {
+		bit := uint64(xstateX87)
+		if kind == "x" || kind == "mxcsr" {
+			bit = xstateSSE
+		}
+		binary.LittleEndian.PutUint64(fp.data[xsaveHeaderOffset:], binary.LittleEndian.Uint64(fp.data[xsaveHeaderOffset:])|bit)
+	}
+
+	return nil
+}
+
+func fpRegisterLocation(kind string, n int) (offset int, size int) {
+	switch kind {
+	case "fcw":
+		return fxsaveFCWOffset, 2
+	case "fsw":
+		return fxsaveFSWOffset, 2
+	case "ftw":
+		return fxsaveFTWOffset, 1
+	case "fop":
+		return fxsaveFOPOffset, 2
+	case "mxcsr":
+		return fxsaveMXCSROffset, 4
+	case "st":
+		// 80 bit extended precision in 16 bytes
+		return fxsaveSTOffset + 16*n, 10
+	}
+
+	// x
+	return fxsaveXMMOffset + 16*n, 16
+}
+
+// parseFPRegisterName parses names like "x0", "xmm0", "y15", "ymm15", "st7" and "mxcsr".
+func parseFPRegisterName(name string) (kind string, n int, err error) {
+	name = strings.ToLower(name)
+	switch name {
+	case "fcw", "fsw", "ftw", "fop", "mxcsr":
+		return name, 0, nil
+	}
+
+	// "xmm" and "ymm" must be checked before "x" and "y"
+	for _, prefix := range []string{"xmm", "ymm", "st", "x", "y"} {
+		num, ok := strings.CutPrefix(name, prefix)
+		if !ok {
+			continue
+		}
+
+		n, err := strconv.Atoi(num)
+		if err != nil {
+			break
+		}
+
+		kind = prefix[:1]
+		limit := numXMMRegisters
+		if prefix == "st" {
+			kind = prefix
+			limit = numSTRegisters
+		}
+		if n < 0 || n >= limit {
+			return "", 0, fmt.Errorf("register number of %s is out of range", name)
+		}
+
+		return kind, n, nil
+	}
+
+	return "", 0, fmt.Errorf("unknown register %s", name)
+}
+
+func isFPRegister(name string) bool {
+	_, _, err := parseFPRegisterName(name)
+	return err == nil
+}
+
+// formatFPRegister formats register value as hex, float, double or vector of lanes.
+// format is one of "", "hex", "f32", "f64", "i8", "i16", "i32", "i64", "u8", "u16", "u32" and "u64".
+func formatFPRegister(name string, b []byte, format string) string {
+	kind, _, _ := parseFPRegisterName(name)
+
+	if kind == "st" {
+		return fmt.Sprintf("%g (raw 0x%s)", float80ToFloat64(b), hexBigEndian(b))
+	}
+
+	if kind != "x" && kind != "y" {
+		return "0x" + hexBigEndian(b)
+	}
+
+	switch format {
+	case "":
+		return fmt.Sprintf("0x%s f32 %s f64 %s", hexBigEndian(b), formatLanes(b, "f32"), formatLanes(b, "f64"))
+	case "hex":
+		return "0x" + hexBigEndian(b)
+	}
+
+	return formatLanes(b, format)
+}
+
+func formatLanes(b []byte, format string) string {
+	size := laneSize(format)
+	if size == 0 {
+		return fmt.Sprintf("unknown format %s", format)
+	}
+
+	var lanes []string
+	for i := 0; i+size <= len(b); i += size {
+		lane := b[i : i+size]
+		var s string
+		switch format {
+		case "f32":
+			s = fmt.Sprintf("%g", math.Float32frombits(binary.LittleEndian.Uint32(lane)))
+		case "f64":
+			s = fmt.Sprintf("%g", math.Float64frombits(binary.LittleEndian.Uint64(lane)))
+		case "i8", "i16", "i32", "i64":
+			shift := 64 - 8*size
+			s = strconv.FormatInt(int64(leUint(lane)<<shift)>>shift, 10)
+		default:
+			s = strconv.FormatUint(leUint(lane), 10)
+		}
+		lanes = append(lanes, s)
+	}
+
+	return "[" + strings.Join(lanes, " ") + "]"
+}
+
+// parseFPRegisterValue parses value for the register.
+// vector registers accept hex (e.g. 0x3ff8000000000000) or comma separated lanes (e.g. 1.5,2.5)
+// which are written from the lowest lane. other lanes keep current value.
+func parseFPRegisterValue(name string, current []byte, value string, format string) ([]byte, error) {
+	kind, _, err := parseFPRegisterName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	b := slices.Clone(current)
+
+	if strings.HasPrefix(value, "0x") {
+		s := strings.TrimPrefix(value, "0x")
+		if len(s)%2 == 1 {
+			s = "0" + s
+		}
+
+		v, err := hex.DecodeString(s)
+		if err != nil {
+			return nil, err
+		}
+		if len(v) > len(b) {
+			return nil, fmt.Errorf("value is too large for %s", name)
+		}
+
+		clear(b)
+		// hex is big endian
+		for i := range v {
+			b[i] = v[len(v)-1-i]
+		}
+		return b, nil
+	}
+
+	if kind == "st" {
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, err
+		}
+		return float64ToFloat80(f), nil
+	}
+
+	if kind != "x" && kind != "y" {
+		v, err := strconv.ParseUint(value, 0, 8*len(b))
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range b {
+			b[i] = byte(v >> (8 * i))
+		}
+		return b, nil
+	}
+
+	if format == "" {
+		format = "f64"
+	}
+	size := laneSize(format)
+	if size == 0 {
+		return nil, fmt.Errorf("unknown format %s", format)
+	}
+
+	for i, s := range strings.Split(value, ",") {
+		if (i+1)*size > len(b) {
+			return nil, fmt.Errorf("too many lanes for %s", name)
+		}
+
+		lane := b[i*size : (i+1)*size]
+		switch format {
+		case "f32":
+			f, err := strconv.ParseFloat(s, 32)
+			if err != nil {
+				return nil, err
+			}
+			binary.LittleEndian.PutUint32(lane, math.Float32bits(float32(f)))
+		case "f64":
+			f, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return nil, err
+			}
+			binary.LittleEndian.PutUint64(lane, math.Float64bits(f))
+		case "i8", "i16", "i32", "i64":
+			v, err := strconv.ParseInt(s, 0, 8*size)
+			if err != nil {
+				return nil, err
+			}
+			for j := range lane {
+				lane[j] = byte(v >> (8 * j))
+			}
+		default:
+			v, err := strconv.ParseUint(s, 0, 8*size)
+			if err != nil {
+				return nil, err
+			}
+			for j := range lane {
+				lane[j] = byte(v >> (8 * j))
+			}
+		}
+	}
+
+	return b, nil
+}
+
+func laneSize(format string) int {
+	switch format {
+	case "i8", "u8":
+		return 1
+	case "i16", "u16":
+		return 2
+	case "f32", "i32", "u32":
+		return 4
+	case "f64", "i64", "u64":
+		return 8
+	}
+
+	return 0
+}
+
+// leUint reads little endian unsigned integer up to 8 bytes.
+func leUint(b []byte) uint64 {
+	var v uint64
+	for i := len(b) - 1; i >= 0; i-- {
+		v = v<<8 | uint64(b[i])
+	}
+	return v
+}
+
+func hexBigEndian(b []byte) string {
+	r := slices.Clone(b)
+	slices.Reverse(r)
+	return hex.EncodeToString(r)
+}
+
+// float80ToFloat64 converts x87 80 bit extended precision to float64.
+// 80 bit format: 1 bit sign, 15 bit exponent and 64 bit mantissa with explicit integer bit.
+func float80ToFloat64(b []byte) float64 {
+	mantissa := binary.LittleEndian.Uint64(b[0:8])
+	se := binary.LittleEndian.Uint16(b[8:10])
+	sign := se >> 15
+	exponent := int(se & 0x7fff)
+
+	var f float64
+	switch {
+	case exponent == 0:
+		// denormal and pseudo-denormal (integer bit is set) values have the exponent of 1 without bias,
+		// and they are smaller than the smallest float64 denormal unless mantissa is 0
+		f = math.Ldexp(float64(mantissa), 1-16383-63)
+	case exponent == 0x7fff:
+		// integer bit is ignored
+		if mantissa<<1 == 0 {
+			f = math.Inf(1)
+		} else {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(float64(mantissa), exponent-16383-63)
+	}
+
+	if sign == 1 {
+		f = -f
+	}
+	return f
+}
+
+// float64ToFloat80 converts float64 to x87 80 bit extended precision.
+func float64ToFloat80(f float64) []byte {
+	b := make([]byte, 10)
+
+	var sign uint16
+	if math.Signbit(f) {
+		sign = 1 << 15
+		f = -f
+	}
+
+	var mantissa uint64
+	var exponent uint16
+	switch {
+	case f == 0:
+	case math.IsInf(f, 0):
+		mantissa = 1 << 63
+		exponent = 0x7fff
+	case math.IsNaN(f):
+		mantissa = 0xc000000000000000
+		exponent = 0x7fff
+	default:
+		// f = frac * 2^exp, 0.5 <= frac < 1
+		frac, exp := math.Frexp(f)
+		mantissa = uint64(math.Ldexp(frac, 64))
+		exponent = uint16(exp - 1 + 16383)
+	}
+
+	binary.LittleEndian.PutUint64(b[0:8], mantissa)
+	binary.LittleEndian.PutUint16(b[8:10], sign|exponent)
+	return b
+}
@@ -0,0 +1,192 @@
+package frame
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/ksrnnb/godbg/decoder"
+)
+
+// location list entry kinds in .debug_loclists.
+// @see DWARF Debugging Information Format Version 5, 7.7.3 Location List Expressions
+const (
+	DW_LLE_end_of_list      = 0x00
+	DW_LLE_base_addressx    = 0x01
+	DW_LLE_startx_endx      = 0x02
+	DW_LLE_startx_length    = 0x03
+	DW_LLE_offset_pair      = 0x04
+	DW_LLE_default_location = 0x05
+	DW_LLE_base_address     = 0x06
+	DW_LLE_start_end        = 0x07
+	DW_LLE_start_length     = 0x08
+)
+
+// LocationLists finds location expressions in .debug_loc (DWARF 4) and .debug_loclists (DWARF 5).
+type LocationLists struct {
+	debugLoc      []byte
+	debugLoclists []byte
+	debugAddr     []byte
+}
+
+// LocationListUnit is attributes of compile unit which are needed to read location lists.
+type LocationListUnit struct {
+	Version int
+	// DW_AT_low_pc of compile unit
+	BaseAddress uint64
+	// DW_AT_addr_base
+	AddrBase uint64
+	// DW_AT_loclists_base
+	LoclistsBase uint64
+}
+
+func NewLocationLists(debugLoc, debugLoclists, debugAddr []byte) *LocationLists {
+	return &LocationLists{debugLoc: debugLoc, debugLoclists: debugLoclists, debugAddr: debugAddr}
+}
+
+// FindByOffset returns the location expression for pc in the list at offset.
+// nil is returned if the location is not available at pc.
+func (ll *LocationLists) FindByOffset(unit LocationListUnit, offset uint64, pc uint64) ([]byte, error) {
+	if unit.Version >= 5 {
+		return ll.findInLoclists(unit, offset, pc)
+	}
+
+	return ll.findInLoc(unit, offset, pc)
+}
+
+// FindByIndex returns the location expression for pc in the list of DW_FORM_loclistx index.
+func (ll *LocationLists) FindByIndex(unit LocationListUnit, index uint64, pc uint64) ([]byte, error) {
+	// offsets table follows the header, and offsets are relative to the loclists base
+	pos := unit.LoclistsBase + 4*index
+	if pos+4 > uint64(len(ll.debugLoclists)) {
+		return nil, fmt.Errorf("location list index %d is out of range", index)
+	}
+
+	offset := uint64(binary.LittleEndian.Uint32(ll.debugLoclists[pos:]))
+	return ll.findInLoclists(unit, unit.LoclistsBase+offset, pc)
+}
+
+func (ll *LocationLists) findInLoc(unit LocationListUnit, offset uint64, pc uint64) ([]byte, error) {
+	if offset >= uint64(len(ll.debugLoc)) {
+		return nil, fmt.Errorf("location list offset 0x%x is out of .debug_loc", offset)
+	}
+
+	buf := bytes.NewBuffer(ll.debugLoc[offset:])
+	base := unit.BaseAddress
+
+	for buf.Len() >= 16 {
+		begin := binary.LittleEndian.Uint64(buf.Next(8))
+		end := binary.LittleEndian.Uint64(buf.Next(8))
+
+		// end of list entry
+		if begin == 0 && end == 0 {
+			return nil, nil
+		}
+
+		// base address selection entry
+		if begin == ^uint64(0) {
+			base = end
+			continue
+		}
+
+		if buf.Len() < 2 {
+			break
+		}
+		length := binary.LittleEndian.Uint16(buf.Next(2))
+		expr := buf.Next(int(length))
+
+		if base+begin <= pc && pc < base+end {
+			return expr, nil
+		}
+	}
+
+	return nil, errors.New("unexpected end of .debug_loc")
+}
+
+func (ll *LocationLists) findInLoclists(unit LocationListUnit, offset uint64, pc uint64) ([]byte, error) {
+	if offset >= uint64(len(ll.debugLoclists)) {
+		return nil, fmt.Errorf("location list offset 0x%x is out of .debug_loclists", offset)
+	}
+
+	buf := bytes.NewBuffer(ll.debugLoclists[offset:])
+	base := unit.BaseAddress
+
+	readExpr := func() []byte {
+		length, _ := decoder.DecodeULEB128(buf)
+		return buf.Next(int(length))
+	}
+
+	for buf.Len() > 0 {
+		kind, _ := buf.ReadByte()
+
+		var begin, end uint64
+		switch kind {
+		case DW_LLE_end_of_list:
+			return nil, nil
+		case DW_LLE_base_addressx:
+			idx, _ := decoder.DecodeULEB128(buf)
+			addr, err := ll.Address(unit, idx)
+			if err != nil {
+				return nil, err
+			}
+			base = addr
+			continue
+		case DW_LLE_startx_endx:
+			startIdx, _ := decoder.DecodeULEB128(buf)
+			endIdx, _ := decoder.DecodeULEB128(buf)
+
+			var err error
+			if begin, err = ll.Address(unit, startIdx); err != nil {
+				return nil, err
+			}
+			if end, err = ll.Address(unit, endIdx); err != nil {
+				return nil, err
+			}
+		case DW_LLE_startx_length:
+			startIdx, _ := decoder.DecodeULEB128(buf)
+			length, _ := decoder.DecodeULEB128(buf)
+
+			var err error
+			if begin, err = ll.Address(unit, startIdx); err != nil {
+				return nil, err
+			}
+			end = begin + length
+		case DW_LLE_offset_pair:
+			b, _ := decoder.DecodeULEB128(buf)
+			e, _ := decoder.DecodeULEB128(buf)
+			begin, end = base+b, base+e
+		case DW_LLE_default_location:
+			return readExpr(), nil
+		case DW_LLE_base_address:
+			base = binary.LittleEndian.Uint64(buf.Next(8))
+			continue
+		case DW_LLE_start_end:
+			begin = binary.LittleEndian.Uint64(buf.Next(8))
+			end = binary.LittleEndian.Uint64(buf.Next(8))
+		case DW_LLE_start_length:
+			begin = binary.LittleEndian.Uint64(buf.Next(8))
+			length, _ := decoder.DecodeULEB128(buf)
+			end = begin + length
+		default:
+			return nil, fmt.Errorf("unknown location list entry kind 0x%x", kind)
+		}
+
+		expr := readExpr()
+		if begin <= pc && pc < end {
+			return expr, nil
+		}
+	}
+
+	return nil, errors.New("unexpected end of .debug_loclists")
+}
+
+// Address returns the address at index in .debug_addr of the unit.
+func (ll *LocationLists) Address(unit LocationListUnit, index uint64) (uint64, error) {
+	pos := unit.AddrBase + 8*index
+	if pos+8 > uint64(len(ll.debugAddr)) {
+		return 0, fmt.Errorf("address index %d is out of .debug_addr", index)
+	}
+
+	return binary.LittleEndian.Uint64(ll.debugAddr[pos:]), nil
+}
@@ -13,89 +13,763 @@ import (
 	"github.com/ksrnnb/godbg/decoder"
 )
 
+// DWARF expression opcodes.
+// @see DWARF Debugging Information Format Version 5, 7.7.1 DWARF Expressions
 const (
-	DW_OP_addr           = 0x3
-	DW_OP_call_frame_cfa = 0x9c
-	DW_OP_plus           = 0x22
-	DW_OP_consts         = 0x11
-	DW_OP_plus_uconsts   = 0x23
-	DW_OP_fbreg          = 0x91
+	DW_OP_addr                 = 0x03
+	DW_OP_deref                = 0x06
+	DW_OP_const1u              = 0x08
+	DW_OP_const1s              = 0x09
+	DW_OP_const2u              = 0x0a
+	DW_OP_const2s              = 0x0b
+	DW_OP_const4u              = 0x0c
+	DW_OP_const4s              = 0x0d
+	DW_OP_const8u              = 0x0e
+	DW_OP_const8s              = 0x0f
+	DW_OP_constu               = 0x10
+	DW_OP_consts               = 0x11
+	DW_OP_dup                  = 0x12
+	DW_OP_drop                 = 0x13
+	DW_OP_over                 = 0x14
+	DW_OP_pick                 = 0x15
+	DW_OP_swap                 = 0x16
+	DW_OP_rot                  = 0x17
+	DW_OP_xderef               = 0x18
+	DW_OP_abs                  = 0x19
+	DW_OP_and                  = 0x1a
+	DW_OP_div                  = 0x1b
+	DW_OP_minus                = 0x1c
+	DW_OP_mod                  = 0x1d
+	DW_OP_mul                  = 0x1e
+	DW_OP_neg                  = 0x1f
+	DW_OP_not                  = 0x20
+	DW_OP_or                   = 0x21
+	DW_OP_plus                 = 0x22
+	DW_OP_plus_uconsts         = 0x23
+	DW_OP_shl                  = 0x24
+	DW_OP_shr                  = 0x25
+	DW_OP_shra                 = 0x26
+	DW_OP_xor                  = 0x27
+	DW_OP_bra                  = 0x28
+	DW_OP_eq                   = 0x29
+	DW_OP_ge                   = 0x2a
+	DW_OP_gt                   = 0x2b
+	DW_OP_le                   = 0x2c
+	DW_OP_lt                   = 0x2d
+	DW_OP_ne                   = 0x2e
+	DW_OP_skip                 = 0x2f
+	DW_OP_lit0                 = 0x30
+	DW_OP_lit31                = 0x4f
+	DW_OP_reg0                 = 0x50
+	DW_OP_reg31                = 0x6f
+	DW_OP_breg0                = 0x70
+	DW_OP_breg31               = 0x8f
+	DW_OP_regx                 = 0x90
+	DW_OP_fbreg                = 0x91
+	DW_OP_bregx                = 0x92
+	DW_OP_piece                = 0x93
+	DW_OP_deref_size           = 0x94
+	DW_OP_xderef_size          = 0x95
+	DW_OP_nop                  = 0x96
+	DW_OP_push_object_address  = 0x97
+	DW_OP_call2                = 0x98
+	DW_OP_call4                = 0x99
+	DW_OP_call_ref             = 0x9a
+	DW_OP_form_tls_address     = 0x9b
+	DW_OP_call_frame_cfa       = 0x9c
+	DW_OP_bit_piece            = 0x9d
+	DW_OP_implicit_value       = 0x9e
+	DW_OP_stack_value          = 0x9f
+	DW_OP_implicit_pointer     = 0xa0
+	DW_OP_addrx                = 0xa1
+	DW_OP_constx               = 0xa2
+	DW_OP_entry_value          = 0xa3
+	DW_OP_const_type           = 0xa4
+	DW_OP_regval_type          = 0xa5
+	DW_OP_deref_type           = 0xa6
+	DW_OP_xderef_type          = 0xa7
+	DW_OP_convert              = 0xa8
+	DW_OP_reinterpret          = 0xa9
+	DW_OP_GNU_push_tls_address = 0xe0
+	DW_OP_GNU_implicit_pointer = 0xf2
+	DW_OP_GNU_entry_value      = 0xf3
+	DW_OP_GNU_addr_index       = 0xfb
+	DW_OP_GNU_const_index      = 0xfc
 )
 
-type stackfn func(*bytes.Buffer, []int64, int64) ([]int64, error)
+// names of operations which are not supported, e.g. because they need the debugging information entries
+// or the thread local storage of the target.
+var unsupportedOps = map[byte]string{
+	DW_OP_push_object_address:  "DW_OP_push_object_address",
+	DW_OP_call2:                "DW_OP_call2",
+	DW_OP_call4:                "DW_OP_call4",
+	DW_OP_call_ref:             "DW_OP_call_ref",
+	DW_OP_form_tls_address:     "DW_OP_form_tls_address",
+	DW_OP_const_type:           "DW_OP_const_type",
+	DW_OP_regval_type:          "DW_OP_regval_type",
+	DW_OP_deref_type:           "DW_OP_deref_type",
+	DW_OP_xderef_type:          "DW_OP_xderef_type",
+	DW_OP_convert:              "DW_OP_convert",
+	DW_OP_reinterpret:          "DW_OP_reinterpret",
+	DW_OP_GNU_push_tls_address: "DW_OP_GNU_push_tls_address",
+}
+
+// size of pointer on amd64
+const ptrSize = 8
+
+// Registers provides register values of the target by DWARF register number.
+type Registers interface {
+	// DwarfRegister returns the value of the register in little endian.
+	DwarfRegister(regnum uint64) ([]byte, error)
+}
+
+// MemoryReader reads size bytes from addr of the target.
+type MemoryReader func(addr uint64, size int) ([]byte, error)
+
+type PieceKind int
+
+const (
+	// the piece is in memory at Addr
+	AddrPiece PieceKind = iota
+	// the piece is in register RegNum
+	RegPiece
+	// the piece is not in the target but its value is Value
+	ImmPiece
+	// the piece is optimized out
+	OptimizedOutPiece
+)
+
+// Piece is a part of variable which may be located in different places.
+type Piece struct {
+	Kind PieceKind
+	// size in bytes. 0 means the whole variable.
+	Size int
+	// Offset is the byte offset of the piece in the register or Value, given by DW_OP_bit_piece
+	Offset int
+	Addr   uint64
+	RegNum uint64
+	Value  []byte
+}
+
+type EvalContext struct {
+	CFA int64
+	// FrameBase returns the value of DW_AT_frame_base of the function. it is called only when DW_OP_fbreg is executed.
+	FrameBase func() (int64, error)
+	// Address returns the value at index in .debug_addr of the unit, which is used by DW_OP_addrx and DW_OP_constx.
+	Address    func(index uint64) (uint64, error)
+	Regs       Registers
+	ReadMemory MemoryReader
+}
+
+type opcontext struct {
+	EvalContext
+
+	instructions []byte
+	buf          *bytes.Buffer
+	stack        []int64
+	pieces       []Piece
+
+	// location of the current piece given by DW_OP_reg*, DW_OP_stack_value or DW_OP_implicit_value
+	location *Piece
+}
+
+type stackfn func(*opcontext) error
 
 var oplut = map[byte]stackfn{
-	DW_OP_call_frame_cfa: callframecfa,
-	DW_OP_plus:           plus,
-	DW_OP_consts:         consts,
-	DW_OP_addr:           addr,
-	DW_OP_plus_uconsts:   plusuconsts,
-	DW_OP_fbreg:          framebase,
+	DW_OP_addr:                 addr,
+	DW_OP_deref:                deref,
+	DW_OP_const1u:              constnu(1),
+	DW_OP_const1s:              constns(1),
+	DW_OP_const2u:              constnu(2),
+	DW_OP_const2s:              constns(2),
+	DW_OP_const4u:              constnu(4),
+	DW_OP_const4s:              constns(4),
+	DW_OP_const8u:              constnu(8),
+	DW_OP_const8s:              constns(8),
+	DW_OP_constu:               constu,
+	DW_OP_consts:               consts,
+	DW_OP_dup:                  dup,
+	DW_OP_drop:                 drop,
+	DW_OP_over:                 over,
+	DW_OP_pick:                 pick,
+	DW_OP_swap:                 swap,
+	DW_OP_rot:                  rot,
+	DW_OP_abs:                  abs,
+	DW_OP_and:                  binaryop(func(a, b int64) int64 { return a & b }),
+	DW_OP_div:                  div,
+	DW_OP_minus:                binaryop(func(a, b int64) int64 { return a - b }),
+	DW_OP_mod:                  mod,
+	DW_OP_mul:                  binaryop(func(a, b int64) int64 { return a * b }),
+	DW_OP_neg:                  unaryop(func(a int64) int64 { return -a }),
+	DW_OP_not:                  unaryop(func(a int64) int64 { return ^a }),
+	DW_OP_or:                   binaryop(func(a, b int64) int64 { return a | b }),
+	DW_OP_plus:                 plus,
+	DW_OP_plus_uconsts:         plusuconsts,
+	DW_OP_shl:                  binaryop(func(a, b int64) int64 { return a << uint64(b) }),
+	DW_OP_shr:                  binaryop(func(a, b int64) int64 { return int64(uint64(a) >> uint64(b)) }),
+	DW_OP_shra:                 binaryop(func(a, b int64) int64 { return a >> uint64(b) }),
+	DW_OP_xor:                  binaryop(func(a, b int64) int64 { return a ^ b }),
+	DW_OP_bra:                  bra,
+	DW_OP_eq:                   compareop(func(a, b int64) bool { return a == b }),
+	DW_OP_ge:                   compareop(func(a, b int64) bool { return a >= b }),
+	DW_OP_gt:                   compareop(func(a, b int64) bool { return a > b }),
+	DW_OP_le:                   compareop(func(a, b int64) bool { return a <= b }),
+	DW_OP_lt:                   compareop(func(a, b int64) bool { return a < b }),
+	DW_OP_ne:                   compareop(func(a, b int64) bool { return a != b }),
+	DW_OP_skip:                 skip,
+	DW_OP_regx:                 regx,
+	DW_OP_fbreg:                framebase,
+	DW_OP_bregx:                bregx,
+	DW_OP_piece:                piece,
+	DW_OP_bit_piece:            bitpiece,
+	DW_OP_deref_size:           derefsize,
+	DW_OP_xderef:               xderef,
+	DW_OP_xderef_size:          xderefsize,
+	DW_OP_addrx:                addrx,
+	DW_OP_constx:               addrx,
+	DW_OP_GNU_addr_index:       addrx,
+	DW_OP_GNU_const_index:      addrx,
+	DW_OP_nop:                  nop,
+	DW_OP_call_frame_cfa:       callframecfa,
+	DW_OP_implicit_value:       implicitvalue,
+	DW_OP_stack_value:          stackvalue,
+	DW_OP_implicit_pointer:     optimizedout,
+	DW_OP_GNU_implicit_pointer: optimizedout,
+	DW_OP_entry_value:          optimizedout,
+	DW_OP_GNU_entry_value:      optimizedout,
 }
 
-var framebaseAddr int64
+func init() {
+	for op := DW_OP_lit0; op <= DW_OP_lit31; op++ {
+		oplut[byte(op)] = literal(int64(op - DW_OP_lit0))
+	}
+
+	for op := DW_OP_reg0; op <= DW_OP_reg31; op++ {
+		oplut[byte(op)] = reg(uint64(op - DW_OP_reg0))
+	}
+
+	for op := DW_OP_breg0; op <= DW_OP_breg31; op++ {
+		oplut[byte(op)] = breg(uint64(op - DW_OP_breg0))
+	}
+}
 
-func ExecuteStackProgram(cfa int64, instructions []byte) (int64, error) {
-	// TODO: calculate framebase
-	//       we can assume framebase is cfa becasue DW_TAG_subprogram's DW_AT_frame_base is 0x9c.
-	framebaseAddr = cfa
-	stack := make([]int64, 0, 3)
-	buf := bytes.NewBuffer(instructions)
+// ExecuteStackProgram evaluates DWARF expression.
+// If the location is a memory address, it is returned as addr and pieces is nil.
+// Otherwise pieces describe where each part of the variable is.
+// An empty expression means the variable is optimized out.
+func ExecuteStackProgram(ectx EvalContext, instructions []byte) (addr int64, pieces []Piece, err error) {
+	if len(instructions) == 0 {
+		return 0, []Piece{{Kind: OptimizedOutPiece}}, nil
+	}
 
-	for opcode, err := buf.ReadByte(); err == nil; opcode, err = buf.ReadByte() {
+	ctx := &opcontext{
+		EvalContext:  ectx,
+		instructions: instructions,
+		buf:          bytes.NewBuffer(instructions),
+		stack:        make([]int64, 0, 3),
+	}
+
+	for opcode, err := ctx.buf.ReadByte(); err == nil; opcode, err = ctx.buf.ReadByte() {
 		fn, ok := oplut[opcode]
 		if !ok {
-			return 0, fmt.Errorf("invalid instruction %#v", opcode)
+			if name, ok := unsupportedOps[opcode]; ok {
+				return 0, nil, fmt.Errorf("unsupported operation %s", name)
+			}
+			return 0, nil, fmt.Errorf("invalid instruction %#v", opcode)
+		}
+
+		if err := fn(ctx); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	if len(ctx.pieces) > 0 {
+		return 0, ctx.pieces, nil
+	}
+
+	if ctx.location != nil {
+		return 0, []Piece{*ctx.location}, nil
+	}
+
+	if len(ctx.stack) == 0 {
+		return 0, nil, errors.New("empty OP stack")
+	}
+
+	return ctx.stack[len(ctx.stack)-1], nil, nil
+}
+
+func (ctx *opcontext) pop() (int64, error) {
+	if len(ctx.stack) == 0 {
+		return 0, errors.New("OP stack underflow")
+	}
+
+	v := ctx.stack[len(ctx.stack)-1]
+	ctx.stack = ctx.stack[:len(ctx.stack)-1]
+	return v, nil
+}
+
+func (ctx *opcontext) push(v int64) {
+	ctx.stack = append(ctx.stack, v)
+}
+
+func (ctx *opcontext) register(regnum uint64) (int64, error) {
+	if ctx.Regs == nil {
+		return 0, fmt.Errorf("registers are not available to read register %d", regnum)
+	}
+
+	b, err := ctx.Regs.DwarfRegister(regnum)
+	if err != nil {
+		return 0, err
+	}
+
+	var v [8]byte
+	copy(v[:], b)
+	return int64(binary.LittleEndian.Uint64(v[:])), nil
+}
+
+func (ctx *opcontext) readMemory(addr int64, size int) (int64, error) {
+	if ctx.ReadMemory == nil {
+		return 0, fmt.Errorf("memory is not available to read 0x%x", addr)
+	}
+
+	b, err := ctx.ReadMemory(uint64(addr), size)
+	if err != nil {
+		return 0, err
+	}
+	if len(b) < size {
+		return 0, fmt.Errorf("failed to read %d bytes at 0x%x", size, addr)
+	}
+
+	var v [8]byte
+	copy(v[:], b[:size])
+	return int64(binary.LittleEndian.Uint64(v[:])), nil
+}
+
+// jump moves the cursor of instructions by offset from the current position.
+func (ctx *opcontext) jump(offset int16) error {
+	pos := len(ctx.instructions) - ctx.buf.Len() + int(offset)
+	if pos < 0 || pos > len(ctx.instructions) {
+		return fmt.Errorf("invalid branch offset %d", offset)
+	}
+
+	ctx.buf = bytes.NewBuffer(ctx.instructions[pos:])
+	return nil
+}
+
+func callframecfa(ctx *opcontext) error {
+	if ctx.CFA == 0 {
+		return fmt.Errorf("Could not retrieve CFA for current PC")
+	}
+	ctx.push(ctx.CFA)
+	return nil
+}
+
+func addr(ctx *opcontext) error {
+	b := ctx.buf.Next(ptrSize)
+	if len(b) != ptrSize {
+		return errors.New("unexpected end of instructions")
+	}
+
+	ctx.push(int64(binary.LittleEndian.Uint64(b)))
+	return nil
+}
+
+// addrx pushes the address or the constant in .debug_addr, which is given by DW_OP_addrx and DW_OP_constx.
+func addrx(ctx *opcontext) error {
+	index, _ := decoder.DecodeULEB128(ctx.buf)
+	if ctx.Address == nil {
+		return fmt.Errorf("address index %d is not available", index)
+	}
+
+	v, err := ctx.Address(index)
+	if err != nil {
+		return err
+	}
+
+	ctx.push(int64(v))
+	return nil
+}
+
+func deref(ctx *opcontext) error {
+	return derefn(ctx, ptrSize)
+}
+
+func derefsize(ctx *opcontext) error {
+	size, err := ctx.buf.ReadByte()
+	if err != nil {
+		return err
+	}
+	return derefn(ctx, int(size))
+}
+
+// xderef is deref with the address space identifier under the address, which is ignored on linux.
+func xderef(ctx *opcontext) error {
+	return xderefn(ctx, ptrSize)
+}
+
+func xderefsize(ctx *opcontext) error {
+	size, err := ctx.buf.ReadByte()
+	if err != nil {
+		return err
+	}
+	return xderefn(ctx, int(size))
+}
+
+func xderefn(ctx *opcontext, size int) error {
+	if len(ctx.stack) < 2 {
+		return errors.New("OP stack underflow")
+	}
+
+	// drop the address space identifier
+	ctx.stack[len(ctx.stack)-2] = ctx.stack[len(ctx.stack)-1]
+	ctx.stack = ctx.stack[:len(ctx.stack)-1]
+	return derefn(ctx, size)
+}
+
+func derefn(ctx *opcontext, size int) error {
+	addr, err := ctx.pop()
+	if err != nil {
+		return err
+	}
+
+	v, err := ctx.readMemory(addr, size)
+	if err != nil {
+		return err
+	}
+
+	ctx.push(v)
+	return nil
+}
+
+func constnu(n int) stackfn {
+	return func(ctx *opcontext) error {
+		b := ctx.buf.Next(n)
+		if len(b) != n {
+			return errors.New("unexpected end of instructions")
 		}
 
-		stack, err = fn(buf, stack, cfa)
+		var v [8]byte
+		copy(v[:], b)
+		ctx.push(int64(binary.LittleEndian.Uint64(v[:])))
+		return nil
+	}
+}
+
+func constns(n int) stackfn {
+	return func(ctx *opcontext) error {
+		if err := constnu(n)(ctx); err != nil {
+			return err
+		}
+
+		// sign extension
+		shift := 64 - 8*n
+		ctx.stack[len(ctx.stack)-1] = ctx.stack[len(ctx.stack)-1] << shift >> shift
+		return nil
+	}
+}
+
+func constu(ctx *opcontext) error {
+	num, _ := decoder.DecodeULEB128(ctx.buf)
+	ctx.push(int64(num))
+	return nil
+}
+
+func consts(ctx *opcontext) error {
+	num, _ := decoder.DecodeSLEB128(ctx.buf)
+	ctx.push(num)
+	return nil
+}
+
+func literal(n int64) stackfn {
+	return func(ctx *opcontext) error {
+		ctx.push(n)
+		return nil
+	}
+}
+
+func dup(ctx *opcontext) error {
+	if len(ctx.stack) == 0 {
+		return errors.New("OP stack underflow")
+	}
+	ctx.push(ctx.stack[len(ctx.stack)-1])
+	return nil
+}
+
+func drop(ctx *opcontext) error {
+	_, err := ctx.pop()
+	return err
+}
+
+func over(ctx *opcontext) error {
+	if len(ctx.stack) < 2 {
+		return errors.New("OP stack underflow")
+	}
+	ctx.push(ctx.stack[len(ctx.stack)-2])
+	return nil
+}
+
+func pick(ctx *opcontext) error {
+	idx, err := ctx.buf.ReadByte()
+	if err != nil {
+		return err
+	}
+
+	if int(idx) >= len(ctx.stack) {
+		return errors.New("OP stack underflow")
+	}
+	ctx.push(ctx.stack[len(ctx.stack)-1-int(idx)])
+	return nil
+}
+
+func swap(ctx *opcontext) error {
+	slen := len(ctx.stack)
+	if slen < 2 {
+		return errors.New("OP stack underflow")
+	}
+	ctx.stack[slen-1], ctx.stack[slen-2] = ctx.stack[slen-2], ctx.stack[slen-1]
+	return nil
+}
+
+func rot(ctx *opcontext) error {
+	slen := len(ctx.stack)
+	if slen < 3 {
+		return errors.New("OP stack underflow")
+	}
+	// the top entry becomes the third entry
+	ctx.stack[slen-1], ctx.stack[slen-2], ctx.stack[slen-3] = ctx.stack[slen-2], ctx.stack[slen-3], ctx.stack[slen-1]
+	return nil
+}
+
+func abs(ctx *opcontext) error {
+	return unaryop(func(a int64) int64 {
+		if a < 0 {
+			return -a
+		}
+		return a
+	})(ctx)
+}
+
+func unaryop(fn func(a int64) int64) stackfn {
+	return func(ctx *opcontext) error {
+		a, err := ctx.pop()
 		if err != nil {
-			return 0, err
+			return err
 		}
+		ctx.push(fn(a))
+		return nil
 	}
+}
+
+// binaryop pops the top entry b and the second entry a, and pushes fn(a, b).
+func binaryop(fn func(a, b int64) int64) stackfn {
+	return func(ctx *opcontext) error {
+		b, err := ctx.pop()
+		if err != nil {
+			return err
+		}
+
+		a, err := ctx.pop()
+		if err != nil {
+			return err
+		}
 
-	if len(stack) == 0 {
-		return 0, errors.New("empty OP stack")
+		ctx.push(fn(a, b))
+		return nil
 	}
+}
 
-	return stack[len(stack)-1], nil
+func compareop(fn func(a, b int64) bool) stackfn {
+	return binaryop(func(a, b int64) int64 {
+		if fn(a, b) {
+			return 1
+		}
+		return 0
+	})
+}
+
+func div(ctx *opcontext) error {
+	if len(ctx.stack) > 0 && ctx.stack[len(ctx.stack)-1] == 0 {
+		return errors.New("division by zero")
+	}
+	return binaryop(func(a, b int64) int64 { return a / b })(ctx)
 }
 
-func callframecfa(buf *bytes.Buffer, stack []int64, cfa int64) ([]int64, error) {
-	if cfa == 0 {
-		return stack, fmt.Errorf("Could not retrieve CFA for current PC")
+func mod(ctx *opcontext) error {
+	if len(ctx.stack) > 0 && ctx.stack[len(ctx.stack)-1] == 0 {
+		return errors.New("division by zero")
 	}
-	return append(stack, int64(cfa)), nil
+	return binaryop(func(a, b int64) int64 { return int64(uint64(a) % uint64(b)) })(ctx)
 }
 
-func addr(buf *bytes.Buffer, stack []int64, cfa int64) ([]int64, error) {
-	return append(stack, int64(binary.LittleEndian.Uint64(buf.Next(8)))), nil
+func plus(ctx *opcontext) error {
+	return binaryop(func(a, b int64) int64 { return a + b })(ctx)
 }
 
-func plus(buf *bytes.Buffer, stack []int64, cfa int64) ([]int64, error) {
-	var (
-		slen   = len(stack)
-		digits = stack[slen-2 : slen]
-		st     = stack[:slen-2]
-	)
+func plusuconsts(ctx *opcontext) error {
+	slen := len(ctx.stack)
+	if slen == 0 {
+		return errors.New("OP stack underflow")
+	}
 
-	return append(st, digits[0]+digits[1]), nil
+	num, _ := decoder.DecodeULEB128(ctx.buf)
+	ctx.stack[slen-1] = ctx.stack[slen-1] + int64(num)
+	return nil
 }
 
-func plusuconsts(buf *bytes.Buffer, stack []int64, cfa int64) ([]int64, error) {
-	slen := len(stack)
-	num, _ := decoder.DecodeULEB128(buf)
-	stack[slen-1] = stack[slen-1] + int64(num)
-	return stack, nil
+func skip(ctx *opcontext) error {
+	var offset int16
+	if err := binary.Read(ctx.buf, binary.LittleEndian, &offset); err != nil {
+		return err
+	}
+
+	return ctx.jump(offset)
+}
+
+func bra(ctx *opcontext) error {
+	var offset int16
+	if err := binary.Read(ctx.buf, binary.LittleEndian, &offset); err != nil {
+		return err
+	}
+
+	v, err := ctx.pop()
+	if err != nil {
+		return err
+	}
+
+	if v == 0 {
+		return nil
+	}
+
+	return ctx.jump(offset)
+}
+
+func reg(regnum uint64) stackfn {
+	return func(ctx *opcontext) error {
+		ctx.location = &Piece{Kind: RegPiece, RegNum: regnum}
+		return nil
+	}
+}
+
+func regx(ctx *opcontext) error {
+	regnum, _ := decoder.DecodeULEB128(ctx.buf)
+	return reg(regnum)(ctx)
+}
+
+func breg(regnum uint64) stackfn {
+	return func(ctx *opcontext) error {
+		offset, _ := decoder.DecodeSLEB128(ctx.buf)
+
+		v, err := ctx.register(regnum)
+		if err != nil {
+			return err
+		}
+
+		ctx.push(v + offset)
+		return nil
+	}
+}
+
+func bregx(ctx *opcontext) error {
+	regnum, _ := decoder.DecodeULEB128(ctx.buf)
+	return breg(regnum)(ctx)
+}
+
+func framebase(ctx *opcontext) error {
+	if ctx.FrameBase == nil {
+		return errors.New("frame base is not available")
+	}
+
+	base, err := ctx.FrameBase()
+	if err != nil {
+		return err
+	}
+
+	num, _ := decoder.DecodeSLEB128(ctx.buf)
+	ctx.push(base + num)
+	return nil
+}
+
+func piece(ctx *opcontext) error {
+	size, _ := decoder.DecodeULEB128(ctx.buf)
+
+	p := Piece{Kind: OptimizedOutPiece}
+	switch {
+	case ctx.location != nil:
+		p = *ctx.location
+	case len(ctx.stack) > 0:
+		addr, _ := ctx.pop()
+		p = Piece{Kind: AddrPiece, Addr: uint64(addr)}
+	}
+	p.Size = int(size)
+
+	ctx.pieces = append(ctx.pieces, p)
+	ctx.location = nil
+	ctx.stack = ctx.stack[:0]
+	return nil
+}
+
+// bitpiece is piece whose size and offset are in bits. pieces which are not aligned to bytes are not supported.
+func bitpiece(ctx *opcontext) error {
+	size, _ := decoder.DecodeULEB128(ctx.buf)
+	offset, _ := decoder.DecodeULEB128(ctx.buf)
+	if size%8 != 0 || offset%8 != 0 {
+		return fmt.Errorf("unsupported DW_OP_bit_piece of %d bits at bit %d", size, offset)
+	}
+
+	p := Piece{Kind: OptimizedOutPiece}
+	switch {
+	case ctx.location != nil:
+		p = *ctx.location
+		p.Offset = int(offset / 8)
+	case len(ctx.stack) > 0:
+		addr, _ := ctx.pop()
+		p = Piece{Kind: AddrPiece, Addr: uint64(addr) + offset/8}
+	}
+	p.Size = int(size / 8)
+
+	ctx.pieces = append(ctx.pieces, p)
+	ctx.location = nil
+	ctx.stack = ctx.stack[:0]
+	return nil
+}
+
+func nop(ctx *opcontext) error {
+	return nil
 }
 
-func framebase(buf *bytes.Buffer, stack []int64, cfa int64) ([]int64, error) {
-	num, _ := decoder.DecodeSLEB128(buf)
-	stack = append(stack, framebaseAddr+num)
-	return stack, nil
+func implicitvalue(ctx *opcontext) error {
+	size, _ := decoder.DecodeULEB128(ctx.buf)
+	value := ctx.buf.Next(int(size))
+	ctx.location = &Piece{Kind: ImmPiece, Value: bytes.Clone(value)}
+	return nil
 }
 
-func consts(buf *bytes.Buffer, stack []int64, cfa int64) ([]int64, error) {
-	num, _ := decoder.DecodeSLEB128(buf)
-	return append(stack, num), nil
+func stackvalue(ctx *opcontext) error {
+	v, err := ctx.pop()
+	if err != nil {
+		return err
+	}
+
+	value := make([]byte, 8)
+	binary.LittleEndian.PutUint64(value, uint64(v))
+	ctx.location = &Piece{Kind: ImmPiece, Value: value}
+	return nil
+}
+
+// optimizedout handles operations which refer values not available in the target,
+// e.g. implicit pointer and entry value.
+func optimizedout(ctx *opcontext) error {
+	// skip operands
+	switch ctx.instructions[len(ctx.instructions)-ctx.buf.Len()-1] {
+	case DW_OP_implicit_pointer, DW_OP_GNU_implicit_pointer:
+		// reference to debugging information entry and offset
+		ctx.buf.Next(4)
+		decoder.DecodeSLEB128(ctx.buf)
+	case DW_OP_entry_value, DW_OP_GNU_entry_value:
+		size, _ := decoder.DecodeULEB128(ctx.buf)
+		ctx.buf.Next(int(size))
+	}
+
+	ctx.location = &Piece{Kind: OptimizedOutPiece}
+	return nil
 }
@@ -0,0 +1,838 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/ksrnnb/godbg/logger"
+	"github.com/ksrnnb/godbg/proc"
+	sys "golang.org/x/sys/unix"
+)
+
+// gdbPacketSize is the maximum size of packets which gdb sends.
+const gdbPacketSize = 0x4000
+
+// gdbRegister is a register in the target description, and the order of registers is the one of g packet.
+// general registers are read from PtraceRegs, and the others are read from FXSAVE area.
+// @see https://sourceware.org/gdb/current/onlinedocs/gdb.html/i386-Features.html
+type gdbRegister struct {
+	name    string
+	bitsize int
+	typ     string
+	group   string
+	feature string
+
+	// field of PtraceRegs
+	register Register
+	// offset and size in FXSAVE area, which is smaller than bitsize for x87 control registers
+	offset int
+	size   int
+}
+
+var gdbRegisters = func() []gdbRegister {
+	var regs []gdbRegister
+	core := func(name string, bitsize int, typ string, register Register) {
+		regs = append(regs, gdbRegister{name: name, bitsize: bitsize, typ: typ, group: "general", feature: "core", register: register})
+	}
+	fpu := func(name string, bitsize int, typ string, offset, size int) {
+		regs = append(regs, gdbRegister{name: name, bitsize: bitsize, typ: typ, group: "float", feature: "core", offset: offset, size: size})
+	}
+
+	for _, name := range []string{"rax", "rbx", "rcx", "rdx", "rsi", "rdi"} {
+		core(name, 64, "int64", registerByName(name))
+	}
+	core("rbp", 64, "data_ptr", Rbp)
+	core("rsp", 64, "data_ptr", Rsp)
+	for i := 8; i <= 15; i++ {
+		core(fmt.Sprintf("r%d", i), 64, "int64", registerByName(fmt.Sprintf("r%d", i)))
+	}
+	core("rip", 64, "code_ptr", Rip)
+	core("eflags", 32, "int32", Eflags)
+	for _, name := range []string{"cs", "ss", "ds", "es", "fs", "gs"} {
+		core(name, 32, "int32", registerByName(name))
+	}
+
+	for i := 0; i < numSTRegisters; i++ {
+		fpu(fmt.Sprintf("st%d", i), 80, "i387_ext", fxsaveSTOffset+16*i, 10)
+	}
+	fpu("fctrl", 32, "int", fxsaveFCWOffset, 2)
+	fpu("fstat", 32, "int", fxsaveFSWOffset, 2)
+	// FXSAVE area has abridged tag word, which is converted to the full one
+	fpu("ftag", 32, "int", fxsaveFTWOffset, 1)
+	fpu("fiseg", 32, "int", fxsaveFIPOffset+4, 2)
+	fpu("fioff", 32, "int", fxsaveFIPOffset, 4)
+	fpu("foseg", 32, "int", fxsaveFDPOffset+4, 2)
+	fpu("fooff", 32, "int", fxsaveFDPOffset, 4)
+	fpu("fop", 32, "int", fxsaveFOPOffset, 2)
+
+	for i := 0; i < numXMMRegisters; i++ {
+		regs = append(regs, gdbRegister{name: fmt.Sprintf("xmm%d", i), bitsize: 128, typ: "vec128", group: "vector", feature: "sse", offset: fxsaveXMMOffset + 16*i, size: 16})
+	}
+	regs = append(regs, gdbRegister{name: "mxcsr", bitsize: 32, typ: "int", group: "vector", feature: "sse", offset: fxsaveMXCSROffset, size: 4})
+
+	return regs
+}()
+
+// gdbTargetDescription returns target.xml which describes registers of amd64.
+func gdbTargetDescription() string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0"?>
+<!DOCTYPE target SYSTEM "gdb-target.dtd">
+<target version="1.0">
+<architecture>i386:x86-64</architecture>
+<osabi>GNU/Linux</osabi>
+`)
+
+	for _, feature := range []string{"core", "sse"} {
+		fmt.Fprintf(&b, "<feature name=\"org.gnu.gdb.i386.%s\">\n", feature)
+		if feature == "sse" {
+			b.WriteString(`<vector id="v4f" type="ieee_single" count="4"/>
+<vector id="v2d" type="ieee_double" count="2"/>
+<vector id="v16i8" type="int8" count="16"/>
+<vector id="v8i16" type="int16" count="8"/>
+<vector id="v4i32" type="int32" count="4"/>
+<vector id="v2i64" type="int64" count="2"/>
+<union id="vec128">
+<field name="v4_float" type="v4f"/>
+<field name="v2_double" type="v2d"/>
+<field name="v16_int8" type="v16i8"/>
+<field name="v8_int16" type="v8i16"/>
+<field name="v4_int32" type="v4i32"/>
+<field name="v2_int64" type="v2i64"/>
+<field name="uint128" type="uint128"/>
+</union>
+`)
+		}
+
+		for i, r := range gdbRegisters {
+			if r.feature == feature {
+				fmt.Fprintf(&b, "<reg name=\"%s\" bitsize=\"%d\" type=\"%s\" group=\"%s\" regnum=\"%d\"/>\n", r.name, r.bitsize, r.typ, r.group, i)
+			}
+		}
+		b.WriteString("</feature>\n")
+	}
+
+	b.WriteString("</target>\n")
+	return b.String()
+}
+
+// get returns the value of the register in little endian.
+func (r gdbRegister) get(regs *sys.PtraceRegs, fp *FPRegisters) []byte {
+	b := make([]byte, r.bitsize/8)
+	if r.register != "" {
+		v := make([]byte, 8)
+		binary.LittleEndian.PutUint64(v, reflect.ValueOf(regs).Elem().FieldByName(string(r.register)).Uint())
+		copy(b, v)
+		return b
+	}
+
+	if r.name == "ftag" {
+		// each bit of abridged tag is 1 if the register is not empty, and each 2 bits of full tag is 11 if it is empty.
+		// full tag doesn't distinguish valid, zero and special values here
+		abridged := fp.data[r.offset]
+		var full uint16
+		for i := 0; i < numSTRegisters; i++ {
+			if abridged&(1<<i) == 0 {
+				full |= 0b11 << (i * 2)
+			}
+		}
+		binary.LittleEndian.PutUint16(b, full)
+		return b
+	}
+
+	copy(b, fp.data[r.offset:r.offset+r.size])
+	return b
+}
+
+// set sets the value of the register in little endian.
+func (r gdbRegister) set(regs *sys.PtraceRegs, fp *FPRegisters, value []byte) {
+	if r.register != "" {
+		v := make([]byte, 8)
+		copy(v, value)
+		reflect.ValueOf(regs).Elem().FieldByName(string(r.register)).SetUint(binary.LittleEndian.Uint64(v))
+		return
+	}
+
+	if r.name == "ftag" {
+		full := binary.LittleEndian.Uint16(value)
+		var abridged byte
+		for i := 0; i < numSTRegisters; i++ {
+			if (full>>(i*2))&0b11 != 0b11 {
+				abridged |= 1 << i
+			}
+		}
+		fp.data[r.offset] = abridged
+		return
+	}
+
+	copy(fp.data[r.offset:r.offset+r.size], value)
+}
+
+// gdbSignals has numbers of signals in gdb which are different from the ones of linux.
+// @see gdb/include/gdb/signals.def
+var gdbSignals = map[syscall.Signal]int{
+	sys.SIGBUS:    10,
+	sys.SIGUSR1:   30,
+	sys.SIGUSR2:   31,
+	sys.SIGSTKFLT: 143,
+	sys.SIGCHLD:   20,
+	sys.SIGCONT:   19,
+	sys.SIGSTOP:   17,
+	sys.SIGTSTP:   18,
+	sys.SIGTTIN:   21,
+	sys.SIGTTOU:   22,
+	sys.SIGURG:    16,
+	sys.SIGXCPU:   24,
+	sys.SIGXFSZ:   25,
+	sys.SIGVTALRM: 26,
+	sys.SIGPROF:   27,
+	sys.SIGWINCH:  28,
+	sys.SIGIO:     23,
+	sys.SIGPWR:    32,
+	sys.SIGSYS:    12,
+}
+
+func gdbSignal(sig syscall.Signal) int {
+	if n, ok := gdbSignals[sig]; ok {
+		return n
+	}
+	return int(sig)
+}
+
+// hostSignal returns the signal of linux for the number of gdb.
+func hostSignal(n int) syscall.Signal {
+	for sig, m := range gdbSignals {
+		if m == n {
+			return sig
+		}
+	}
+	return syscall.Signal(n)
+}
+
+// gdbServer serves the GDB remote serial protocol on a connection.
+// @see https://sourceware.org/gdb/current/onlinedocs/gdb.html/Remote-Protocol.html
+type gdbServer struct {
+	reader *bufio.Reader
+	writer io.Writer
+	logger *slog.Logger
+	d      *Debugger
+
+	// true after QStartNoAckMode, and packets are not acknowledged
+	noAck bool
+	// true if gdb supports swbreak stop reason
+	swbreak bool
+	// reply of the last stop, which is sent again by ? packet
+	stopReply string
+	// thread whose registers are read and written, which is selected by Hg packet. 0 means the current thread
+	registerThread int
+}
+
+// runGDBServer starts the debuggee and serves the first connection from gdb on the TCP address.
+func runGDBServer(address string, args []string, config *Config) error {
+	if len(args) < 1 {
+		return fmt.Errorf("debuggee path must be given")
+	}
+
+	config.args = args[1:]
+	d, err := NewDebugger(args[0], config, logger.NewLogger())
+	if err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("GDB server listening at %s for %s\n", listener.Addr(), d.debugeeBinaryPath)
+
+	conn, err := listener.Accept()
+	listener.Close()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return newGDBServer(conn, conn, d).serve()
+}
+
+func newGDBServer(r io.Reader, w io.Writer, d *Debugger) *gdbServer {
+	s := &gdbServer{reader: bufio.NewReader(r), writer: w, logger: d.logger, d: d}
+
+	// gdb shows only its own outputs
+	d.suppressSourceCode = true
+	s.stopReply = s.stopReason()
+
+	return s
+}
+
+func (s *gdbServer) serve() error {
+	for {
+		packet, err := s.readPacket()
+		if errors.Is(err, io.EOF) {
+			return s.d.quit()
+		}
+		if err != nil {
+			return err
+		}
+
+		s.logger.Debug("GDB packet", "packet", packet)
+
+		// k packet has no reply
+		if packet == "k" {
+			if err := s.d.target.Kill(); err != nil {
+				return err
+			}
+			return s.d.quit()
+		}
+
+		if err := s.writePacket(s.handlePacket(packet)); errors.Is(err, io.EOF) {
+			return s.d.quit()
+		} else if err != nil {
+			return err
+		}
+
+		switch packet {
+		case "QStartNoAckMode":
+			s.noAck = true
+		case "D":
+			return s.d.quit()
+		}
+	}
+}
+
+// readPacket reads a packet like $data#checksum, and acknowledges it unless no ack mode.
+func (s *gdbServer) readPacket() (string, error) {
+	for {
+		c, err := s.reader.ReadByte()
+		if err != nil {
+			return "", err
+		}
+
+		// acknowledgements of replies are handled in writePacket, and interrupt (0x03) is ignored
+		// because the process is stopped while packets are read
+		if c != '$' {
+			continue
+		}
+
+		data, err := s.reader.ReadString('#')
+		if err != nil {
+			return "", err
+		}
+		data = data[:len(data)-1]
+
+		checksum := make([]byte, 2)
+		if _, err := io.ReadFull(s.reader, checksum); err != nil {
+			return "", err
+		}
+
+		if s.noAck {
+			return data, nil
+		}
+
+		if want, err := strconv.ParseUint(string(checksum), 16, 8); err != nil || byte(want) != gdbChecksum(data) {
+			s.logger.Debug("invalid checksum of GDB packet", "packet", data)
+			if _, err := s.writer.Write([]byte("-")); err != nil {
+				return "", err
+			}
+			continue
+		}
+
+		if _, err := s.writer.Write([]byte("+")); err != nil {
+			return "", err
+		}
+
+		return data, nil
+	}
+}
+
+// writePacket sends data as a packet, and sends it again until it is acknowledged unless no ack mode.
+func (s *gdbServer) writePacket(data string) error {
+	var b strings.Builder
+	for _, c := range []byte(data) {
+		// '*' is escaped because it means run-length encoding
+		switch c {
+		case '$', '#', '}', '*':
+			b.WriteByte('}')
+			c ^= 0x20
+		}
+		b.WriteByte(c)
+	}
+	escaped := b.String()
+
+	packet := fmt.Sprintf("$%s#%02x", escaped, gdbChecksum(escaped))
+	for {
+		if _, err := io.WriteString(s.writer, packet); err != nil {
+			return err
+		}
+
+		if s.noAck {
+			return nil
+		}
+
+		c, err := s.reader.ReadByte()
+		if err != nil {
+			return err
+		}
+		if c != '-' {
+			return nil
+		}
+	}
+}
+
+func gdbChecksum(data string) byte {
+	var sum byte
+	for _, c := range []byte(data) {
+		sum += c
+	}
+	return sum
+}
+
+// handlePacket returns the reply of the packet. empty reply means the packet is not supported.
+func (s *gdbServer) handlePacket(packet string) string {
+	reply, err := s.reply(packet)
+	if err != nil {
+		s.logger.Debug("failed to handle GDB packet", "packet", packet, "error", err)
+		return "E01"
+	}
+
+	return reply
+}
+
+func (s *gdbServer) reply(packet string) (string, error) {
+	if packet == "" {
+		return "", nil
+	}
+
+	args := packet[1:]
+	switch packet[0] {
+	case '?':
+		return s.stopReply, nil
+	case 'g':
+		return s.readRegisters()
+	case 'G':
+		return s.writeRegisters(args)
+	case 'p':
+		return s.readRegister(args)
+	case 'P':
+		return s.writeRegister(args)
+	case 'm':
+		return s.readMemory(args)
+	case 'M':
+		return s.writeMemory(args)
+	// gdb decides whether the signal which stops the process is delivered, and c and s packets deliver no signal
+	case 'c':
+		s.d.target.SetPendingSignal(0)
+		return s.resume(s.d.continueInstruction, args)
+	case 's':
+		s.d.target.SetPendingSignal(0)
+		return s.resume(s.d.singleStepInstruction, args)
+	// C and S packets have "sig;addr"
+	case 'C', 'S':
+		sig, addr, _ := strings.Cut(args, ";")
+		n, err := strconv.ParseUint(sig, 16, 8)
+		if err != nil {
+			return "", err
+		}
+		s.d.target.SetPendingSignal(hostSignal(int(n)))
+
+		if packet[0] == 'C' {
+			return s.resume(s.d.continueInstruction, addr)
+		}
+		return s.resume(s.d.singleStepInstruction, addr)
+	case 'Z', 'z':
+		return s.breakpoint(packet[0] == 'Z', args)
+	case 'H':
+		return s.selectThread(args)
+	case 'T':
+		tid, err := strconv.ParseInt(args, 16, 64)
+		if err != nil {
+			return "", err
+		}
+		if !s.hasThread(int(tid)) {
+			return "", fmt.Errorf("thread %d is not found", tid)
+		}
+		return "OK", nil
+	case 'D':
+		return "OK", nil
+	case 'q', 'Q':
+		return s.query(packet)
+	}
+
+	return "", nil
+}
+
+func (s *gdbServer) query(packet string) (string, error) {
+	switch {
+	case strings.HasPrefix(packet, "qSupported"):
+		s.swbreak = strings.Contains(packet, "swbreak+")
+		return fmt.Sprintf("PacketSize=%x;qXfer:features:read+;qXfer:auxv:read+;qXfer:exec-file:read+;QStartNoAckMode+;swbreak+", gdbPacketSize), nil
+	case packet == "QStartNoAckMode":
+		return "OK", nil
+	case packet == "qAttached":
+		// gdb detaches from the attached process and kills the others when it quits
+		if s.d.target.Attached() {
+			return "1", nil
+		}
+		return "0", nil
+	case packet == "qC":
+		return fmt.Sprintf("QC%x", s.d.target.Tid()), nil
+	case packet == "qfThreadInfo":
+		var tids []string
+		for _, th := range s.d.target.Threads() {
+			tids = append(tids, strconv.FormatInt(int64(th.Tid()), 16))
+		}
+		return "m" + strings.Join(tids, ","), nil
+	case packet == "qsThreadInfo":
+		return "l", nil
+	case strings.HasPrefix(packet, "qXfer:features:read:target.xml:"):
+		return gdbXferReply([]byte(gdbTargetDescription()), strings.TrimPrefix(packet, "qXfer:features:read:target.xml:"))
+	case strings.HasPrefix(packet, "qXfer:auxv:read::"):
+		auxv, err := os.ReadFile(fmt.Sprintf("/proc/%d/auxv", s.d.target.Pid()))
+		if err != nil {
+			return "", err
+		}
+		return gdbXferReply(auxv, strings.TrimPrefix(packet, "qXfer:auxv:read::"))
+	case strings.HasPrefix(packet, "qXfer:exec-file:read:"):
+		// annex is the pid, and the process is only one
+		_, offset, ok := strings.Cut(strings.TrimPrefix(packet, "qXfer:exec-file:read:"), ":")
+		if !ok {
+			return "", fmt.Errorf("invalid packet %s", packet)
+		}
+		path, err := filepath.Abs(s.d.debugeeBinaryPath)
+		if err != nil {
+			return "", err
+		}
+		return gdbXferReply([]byte(path), offset)
+	}
+
+	return "", nil
+}
+
+// gdbXferReply returns the part of data at "offset,length", which starts with 'l' if it is the last part.
+func gdbXferReply(data []byte, args string) (string, error) {
+	offset, length, err := parseGDBAddressLength(args)
+	if err != nil {
+		return "", err
+	}
+
+	if offset >= uint64(len(data)) {
+		return "l", nil
+	}
+
+	end := offset + length
+	if end >= uint64(len(data)) {
+		return "l" + string(data[offset:]), nil
+	}
+
+	return "m" + string(data[offset:end]), nil
+}
+
+// parseGDBAddressLength parses "addr,length" in hex.
+func parseGDBAddressLength(args string) (addr uint64, length uint64, err error) {
+	a, l, ok := strings.Cut(args, ",")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid arguments %s", args)
+	}
+
+	if addr, err = strconv.ParseUint(a, 16, 64); err != nil {
+		return 0, 0, err
+	}
+	if length, err = strconv.ParseUint(l, 16, 64); err != nil {
+		return 0, 0, err
+	}
+
+	return addr, length, nil
+}
+
+// stopReason returns stop reply with the signal and the reason why the process stopped,
+// or the exit status or the signal if the process has terminated.
+func (s *gdbServer) stopReason() string {
+	stop := s.d.target.LastStop()
+	switch stop.Kind {
+	case proc.StopExited:
+		return fmt.Sprintf("W%02x", stop.Status)
+	case proc.StopKilled:
+		return fmt.Sprintf("X%02x", gdbSignal(stop.Signal))
+	}
+
+	sig := stop.Signal
+	// gdb expects SIGINT when the process is interrupted
+	if stop.Kind == proc.StopInterrupted {
+		sig = sys.SIGINT
+	}
+	reply := fmt.Sprintf("T%02xthread:%x;", gdbSignal(sig), s.d.target.Tid())
+
+	switch stop.Kind {
+	case proc.StopWatchpoint:
+		kind := "watch"
+		if stop.Watchpoint.Kind() == proc.WatchAccess {
+			kind = "awatch"
+		}
+		return reply + fmt.Sprintf("%s:%x;", kind, stop.Watchpoint.Addr())
+	case proc.StopBreakpoint:
+		if s.swbreak && s.d.hasUserBreakpoint(stop.Addr) {
+			return reply + "swbreak:;"
+		}
+	}
+
+	return reply
+}
+
+// resume resumes the process from the address if it is given, and returns the stop reply.
+func (s *gdbServer) resume(resume func() error, args string) (string, error) {
+	if args != "" {
+		addr, err := strconv.ParseUint(args, 16, 64)
+		if err != nil {
+			return "", err
+		}
+		if err := s.d.setPC(addr); err != nil {
+			return "", err
+		}
+	}
+
+	// the thread which stops the process is selected after resuming
+	s.registerThread = 0
+
+	exited := s.d.target.Exited()
+	if err := resume(); err != nil && !isReportedStop(err, exited) {
+		return "", err
+	}
+
+	s.stopReply = s.stopReason()
+	return s.stopReply, nil
+}
+
+// selectThread handles H packet like "Hg<tid>". g selects the thread whose registers are read and written,
+// and 0 or -1 selects the current thread. c for resuming is accepted because all threads are resumed.
+func (s *gdbServer) selectThread(args string) (string, error) {
+	if args == "" {
+		return "", errors.New("operation of H packet must be given")
+	}
+
+	op, id := args[0], args[1:]
+	tid, err := strconv.ParseInt(id, 16, 64)
+	if err != nil {
+		return "", err
+	}
+	if tid > 0 && !s.hasThread(int(tid)) {
+		return "", fmt.Errorf("thread %d is not found", tid)
+	}
+
+	if op == 'g' {
+		s.registerThread = max(int(tid), 0)
+	}
+
+	return "OK", nil
+}
+
+// hasThread returns true if the thread of tid is a thread of the process.
+func (s *gdbServer) hasThread(tid int) bool {
+	for _, th := range s.d.target.Threads() {
+		if th.Tid() == tid {
+			return true
+		}
+	}
+
+	return false
+}
+
+// registerClient returns registers of the thread selected by Hg packet.
+func (s *gdbServer) registerClient() RegisterClient {
+	return threadRegisterClient(s.d.target, s.registerThread)
+}
+
+func (s *gdbServer) getRegisters() (*sys.PtraceRegs, *FPRegisters, error) {
+	c := s.registerClient()
+
+	regs := &sys.PtraceRegs{}
+	if err := sys.PtraceGetRegs(c.threadID(), regs); err != nil {
+		return nil, nil, fmt.Errorf("failed to get registers: %s", err)
+	}
+
+	fp, err := c.GetFPRegisters()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return regs, fp, nil
+}
+
+func (s *gdbServer) setRegisters(regs *sys.PtraceRegs, fp *FPRegisters) error {
+	c := s.registerClient()
+	if err := sys.PtraceSetRegs(c.threadID(), regs); err != nil {
+		return fmt.Errorf("failed to set registers: %s", err)
+	}
+
+	return c.SetFPRegisters(fp)
+}
+
+func (s *gdbServer) readRegisters() (string, error) {
+	regs, fp, err := s.getRegisters()
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, r := range gdbRegisters {
+		b.WriteString(hex.EncodeToString(r.get(regs, fp)))
+	}
+
+	return b.String(), nil
+}
+
+func (s *gdbServer) writeRegisters(args string) (string, error) {
+	data, err := hex.DecodeString(args)
+	if err != nil {
+		return "", err
+	}
+
+	regs, fp, err := s.getRegisters()
+	if err != nil {
+		return "", err
+	}
+
+	for _, r := range gdbRegisters {
+		size := r.bitsize / 8
+		if len(data) < size {
+			break
+		}
+		r.set(regs, fp, data[:size])
+		data = data[size:]
+	}
+
+	return "OK", s.setRegisters(regs, fp)
+}
+
+func (s *gdbServer) readRegister(args string) (string, error) {
+	n, err := strconv.ParseUint(args, 16, 64)
+	if err != nil {
+		return "", err
+	}
+	if n >= uint64(len(gdbRegisters)) {
+		return "", fmt.Errorf("register %d is not found", n)
+	}
+
+	regs, fp, err := s.getRegisters()
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(gdbRegisters[n].get(regs, fp)), nil
+}
+
+func (s *gdbServer) writeRegister(args string) (string, error) {
+	num, value, ok := strings.Cut(args, "=")
+	if !ok {
+		return "", fmt.Errorf("invalid arguments %s", args)
+	}
+
+	n, err := strconv.ParseUint(num, 16, 64)
+	if err != nil {
+		return "", err
+	}
+	if n >= uint64(len(gdbRegisters)) {
+		return "", fmt.Errorf("register %d is not found", n)
+	}
+
+	data, err := hex.DecodeString(value)
+	if err != nil {
+		return "", err
+	}
+	if len(data) != gdbRegisters[n].bitsize/8 {
+		return "", fmt.Errorf("%s must be %d bytes", gdbRegisters[n].name, gdbRegisters[n].bitsize/8)
+	}
+
+	regs, fp, err := s.getRegisters()
+	if err != nil {
+		return "", err
+	}
+	gdbRegisters[n].set(regs, fp, data)
+
+	return "OK", s.setRegisters(regs, fp)
+}
+
+func (s *gdbServer) readMemory(args string) (string, error) {
+	addr, length, err := parseGDBAddressLength(args)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := s.d.readMemoryBytes(addr, int(min(length, gdbPacketSize/2)))
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(data), nil
+}
+
+func (s *gdbServer) writeMemory(args string) (string, error) {
+	location, value, ok := strings.Cut(args, ":")
+	if !ok {
+		return "", fmt.Errorf("invalid arguments %s", args)
+	}
+
+	addr, length, err := parseGDBAddressLength(location)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := hex.DecodeString(value)
+	if err != nil {
+		return "", err
+	}
+	if uint64(len(data)) != length {
+		return "", fmt.Errorf("length of data is %d, but %d is given", len(data), length)
+	}
+
+	return "OK", s.d.target.WriteMemory(addr, data)
+}
+
+// breakpoint inserts or removes a breakpoint by "type,addr,kind".
+// type 0 is a software breakpoint, and 2 and 4 are write and access watchpoints. kind is the size of watchpoint.
+func (s *gdbServer) breakpoint(insert bool, args string) (string, error) {
+	typ, location, ok := strings.Cut(args, ",")
+	if !ok {
+		return "", fmt.Errorf("invalid arguments %s", args)
+	}
+
+	// conditions and commands after ';' are not supported
+	location, _, _ = strings.Cut(location, ";")
+	addr, kind, err := parseGDBAddressLength(location)
+	if err != nil {
+		return "", err
+	}
+
+	switch typ {
+	case "0":
+		if insert {
+			return "OK", s.d.setUserBreakpoint(addr, fmt.Sprintf("%x", addr))
+		}
+		return "OK", s.d.clearBreakpoint(addr)
+	case "2", "4":
+		wk := proc.WatchWrite
+		if typ == "4" {
+			wk = proc.WatchAccess
+		}
+
+		if insert {
+			return "OK", s.d.target.SetWatchpoint(addr, int(kind), wk)
+		}
+		return "OK", s.d.target.ClearWatchpoint(addr, int(kind), wk)
+	}
+
+	// hardware breakpoints and read watchpoints are not supported
+	return "", nil
+}
@@ -2,4 +2,7 @@ module github.com/ksrnnb/godbg
 
 go 1.22.4
 
-require golang.org/x/sys v0.22.0 // indirect
+require (
+	golang.org/x/arch v0.14.0
+	golang.org/x/sys v0.22.0
+)
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"debug/dwarf"
+	"fmt"
+)
+
+// _Gdead of runtime, the goroutine is not used.
+// @see https://cs.opensource.google/go/go/+/refs/tags/go1.22.5:src/runtime/runtime2.go;l=81
+const goroutineStatusDead = 6
+
+// goroutine is runtime.g of the debuggee.
+type goroutine struct {
+	id     uint64
+	status uint32
+	// registers saved in g.sched when the goroutine is descheduled
+	pc uint64
+	sp uint64
+	bp uint64
+}
+
+// gLayout is offsets of fields of runtime.g, which depend on the version of go.
+type gLayout struct {
+	goid         int64
+	atomicstatus int64
+	schedSP      int64
+	schedPC      int64
+	schedBP      int64
+}
+
+// readWord reads 8 bytes at addr.
+// readMemory is not used because its error message reads goroutines to explain the address.
+func (d *Debugger) readWord(addr uint64) (uint64, bool) {
+	v, err := d.target.ReadWord(addr)
+	return v, err == nil
+}
+
+// allgs returns addresses of runtime.g in runtime.allgs.
+func (d *Debugger) allgs() []uint64 {
+	allgsAddr, err := d.symTable.LookupSymbolByName("runtime.allgs")
+	if err != nil {
+		return nil
+	}
+
+	// allgs is []*g
+	ptr, ok := d.readWord(allgsAddr)
+	if !ok {
+		return nil
+	}
+
+	length, ok := d.readWord(allgsAddr + 8)
+	if !ok {
+		return nil
+	}
+
+	var gs []uint64
+	for i := uint64(0); i < length; i++ {
+		if g, ok := d.readWord(ptr + 8*i); ok && g != 0 {
+			gs = append(gs, g)
+		}
+	}
+
+	return gs
+}
+
+// runtimeGLayout reads offsets of fields of runtime.g from debug information at the first call.
+func (d *Debugger) runtimeGLayout() (*gLayout, error) {
+	if d.gLayout != nil {
+		return d.gLayout, nil
+	}
+
+	t, err := d.symTable.LookupType("runtime.g")
+	if err != nil {
+		return nil, err
+	}
+
+	goid, _, err := structField(t, "goid")
+	if err != nil {
+		return nil, err
+	}
+
+	status, _, err := structField(t, "atomicstatus")
+	if err != nil {
+		return nil, err
+	}
+
+	sched, schedType, err := structField(t, "sched")
+	if err != nil {
+		return nil, err
+	}
+
+	layout := &gLayout{goid: goid, atomicstatus: status}
+	for name, offset := range map[string]*int64{"sp": &layout.schedSP, "pc": &layout.schedPC, "bp": &layout.schedBP} {
+		o, _, err := structField(schedType, name)
+		if err != nil {
+			return nil, err
+		}
+		*offset = sched + o
+	}
+
+	d.gLayout = layout
+	return layout, nil
+}
+
+// structField returns the offset and the type of the field of struct type t.
+func structField(t dwarf.Type, name string) (int64, dwarf.Type, error) {
+	// go compiler emits named types as typedef of struct
+	for {
+		typedef, ok := t.(*dwarf.TypedefType)
+		if !ok {
+			break
+		}
+		t = typedef.Type
+	}
+
+	s, ok := t.(*dwarf.StructType)
+	if !ok {
+		return 0, nil, fmt.Errorf("%s is not struct", t)
+	}
+
+	for _, f := range s.Field {
+		if f.Name == name {
+			return f.ByteOffset, f.Type, nil
+		}
+	}
+
+	return 0, nil, fmt.Errorf("%s doesn't have field %s", t, name)
+}
+
+// goroutines reads goroutines which are not dead.
+func (d *Debugger) goroutines() ([]goroutine, error) {
+	layout, err := d.runtimeGLayout()
+	if err != nil {
+		return nil, err
+	}
+
+	var goroutines []goroutine
+	for _, g := range d.allgs() {
+		g, ok := d.readGoroutine(g, layout)
+		if !ok || g.status == goroutineStatusDead {
+			continue
+		}
+
+		goroutines = append(goroutines, g)
+	}
+
+	return goroutines, nil
+}
+
+func (d *Debugger) readGoroutine(addr uint64, layout *gLayout) (goroutine, bool) {
+	var g goroutine
+	var ok bool
+	for _, field := range []struct {
+		offset int64
+		value  *uint64
+	}{
+		{layout.goid, &g.id},
+		{layout.schedPC, &g.pc},
+		{layout.schedSP, &g.sp},
+		{layout.schedBP, &g.bp},
+	} {
+		if *field.value, ok = d.readWord(addr + uint64(field.offset)); !ok {
+			return goroutine{}, false
+		}
+	}
+
+	status, ok := d.readWord(addr + uint64(layout.atomicstatus))
+	if !ok {
+		return goroutine{}, false
+	}
+	// atomicstatus is uint32
+	g.status = uint32(status)
+
+	return g, true
+}
+
+// goroutineStackFrames walks frames of the goroutine which is not running from registers saved in g.sched.
+func (d *Debugger) goroutineStackFrames(id uint64) ([]stackFrame, error) {
+	goroutines, err := d.goroutines()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, g := range goroutines {
+		if g.id == id {
+			return d.stackFrames(g.pc, g.sp, g.bp)
+		}
+	}
+
+	return nil, fmt.Errorf("goroutine %d is not found", id)
+}
+
+// currentGoroutineID returns the id of the goroutine running on the current thread.
+// go functions keep the current g in r14 since go 1.17.
+func (d *Debugger) currentGoroutineID() (uint64, bool) {
+	return d.threadGoroutineID(d.registerClient)
+}
+
+// threadGoroutineID returns id of the goroutine which runs on the thread of registers.
+func (d *Debugger) threadGoroutineID(registers RegisterClient) (uint64, bool) {
+	r14, err := registers.GetRegisterValue(R14)
+	if err != nil {
+		return 0, false
+	}
+
+	layout, err := d.runtimeGLayout()
+	if err != nil {
+		return 0, false
+	}
+
+	for _, addr := range d.allgs() {
+		if addr != r14 {
+			continue
+		}
+
+		g, ok := d.readGoroutine(addr, layout)
+		return g.id, ok
+	}
+
+	return 0, false
+}
@@ -2,41 +2,178 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/ksrnnb/godbg/api"
 )
 
+// Handler is the REPL, which is a client of the API server.
 type Handler struct {
-	d *Debugger
+	client *api.Client
 }
 
-func NewHandler(d *Debugger) *Handler {
-	return &Handler{d: d}
+func NewHandler(conn net.Conn) *Handler {
+	h := &Handler{}
+	// the exit of the process is printed in the output of the command which resumes it
+	h.client = api.NewClient(conn, nil)
+	return h
 }
 
 func (h *Handler) Run() error {
-	if _, err := h.d.WaitSignal(); err != nil {
-		return err
-	}
+	// Ctrl-C interrupts the running process instead of terminating the debugger
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+
+	go func() {
+		for range interrupts {
+			if err := h.client.Interrupt(); err != nil && !errors.Is(err, api.ErrClosed) {
+				fmt.Printf("failed to interrupt: %s\n", err)
+			}
+		}
+	}()
 
 	sc := bufio.NewScanner(os.Stdin)
 	fmt.Print("godbg> ")
 
 	for sc.Scan() {
-		s := sc.Text()
-
-		cmd, err := NewCommand(s)
+		output, err := h.handle(sc.Text())
+		if errors.Is(err, api.ErrClosed) {
+			return nil
+		}
 		if err != nil {
-			fmt.Printf("failed to parse command: %s\n", err)
-			continue
+			return err
 		}
 
-		if err := h.d.HandleCommand(cmd); err != nil {
-			return err
+		// the server quits after replying to quit command
+		if cmd, err := NewCommand(sc.Text()); err == nil && cmd.Type == QuitCommand {
+			return nil
 		}
 
+		fmt.Print(output)
 		fmt.Printf("\ngodbg> ")
 	}
 
 	return nil
 }
+
+// steps of the REPL by kinds of step method
+var stepKinds = map[string]string{
+	NextCommand:            api.StepNext,
+	StepInCommand:          api.StepIn,
+	StepOutCommand:         api.StepOut,
+	NextInstructionCommand: api.StepInstruction,
+}
+
+// handle runs the command line and returns what the REPL prints. break, continue, steps, backtrace and print
+// call methods of the API, and the other commands are run by the server as they are.
+func (h *Handler) handle(line string) (string, error) {
+	cmd, err := NewCommand(line)
+	if err != nil {
+		// the server prints the error of parsing
+		return h.client.Command(line)
+	}
+
+	var out strings.Builder
+	switch cmd.Type {
+	case BreakCommand:
+		err = h.createBreakpoint(&out, strings.Join(cmd.Args, " "))
+	case ContinueCommand:
+		err = h.resume(&out, h.client.Continue)
+	case NextCommand, StepInCommand, StepOutCommand, NextInstructionCommand:
+		err = h.resume(&out, func() (api.State, error) { return h.client.Step(stepKinds[cmd.Type]) })
+	case BackTraceCommand:
+		err = h.backtrace(&out)
+	case PrintCommand:
+		err = h.print(&out, strings.Join(cmd.Args, " "))
+	default:
+		return h.client.Command(line)
+	}
+
+	// errors of the method are printed like the server does, and the REPL continues
+	var rpcErr *api.Error
+	if errors.As(err, &rpcErr) {
+		fmt.Fprintf(&out, "failed to handle %s command: %s\n", cmd.Type, rpcErr.Message)
+		return out.String(), nil
+	}
+
+	return out.String(), err
+}
+
+func (h *Handler) createBreakpoint(w io.Writer, location string) error {
+	bp, err := h.client.CreateBreakpoint(location)
+	if err != nil {
+		return err
+	}
+
+	if bp.Addr == 0 {
+		fmt.Fprintf(w, "breakpoint at %s is pending until a library containing it is loaded\n", location)
+		return nil
+	}
+
+	state, err := h.client.State()
+	if err != nil {
+		return err
+	}
+	if state.Exited != nil {
+		fmt.Fprintf(w, "breakpoint at %s is set when the process restarts\n", location)
+	}
+
+	return nil
+}
+
+// resume prints what the server prints while the process runs, and the source where the process stops.
+func (h *Handler) resume(w io.Writer, resume func() (api.State, error)) error {
+	state, err := resume()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprint(w, state.Output)
+	if state.Exited != nil {
+		return nil
+	}
+
+	// the program not built by Go has no lines
+	if state.File == "" {
+		fmt.Fprintf(w, "stopped at 0x%x\n", state.PC)
+		return nil
+	}
+
+	listing, err := h.client.Command(fmt.Sprintf("list %s:%d", state.File, state.Line))
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(w, listing)
+
+	return nil
+}
+
+func (h *Handler) backtrace(w io.Writer) error {
+	frames, err := h.client.Stacktrace(0)
+	if err != nil {
+		return err
+	}
+
+	for i, f := range frames {
+		fmt.Fprintf(w, "frame#%d\t0x%x\t%s\t%s:%d\n", i+1, f.PC, f.Function, f.File, f.Line)
+	}
+
+	return nil
+}
+
+func (h *Handler) print(w io.Writer, expr string) error {
+	v, err := h.client.Eval(expr)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "%s %s = %s\n", v.Name, v.Type, v.Value)
+	return nil
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ksrnnb/godbg/proc"
+)
+
+// inferior is a process debugged by the debugger. states of the selected inferior are the fields of Debugger,
+// and they are saved here while another inferior is selected.
+type inferior struct {
+	id                  int
+	target              *proc.Target
+	symTable            *SymbolTable
+	debugeeBinaryPath   string
+	libraries           []*Library
+	loaderBreakpoint    uint64
+	pendingBreakpoints  []string
+	breakpointLocations map[uint64]string
+	listPosition        listPosition
+	gLayout             *gLayout
+}
+
+// close closes symbol tables of the inferior.
+func (inf *inferior) close() {
+	inf.symTable.Close()
+	for _, l := range inf.libraries {
+		if l.symTable != nil {
+			l.symTable.Close()
+		}
+	}
+}
+
+// resetInferiors makes the loaded process the only inferior.
+func (d *Debugger) resetInferiors() {
+	d.inferior = &inferior{id: 1}
+	d.inferiors = []*inferior{d.inferior}
+	d.nextInferiorID = 2
+	d.saveInferior()
+}
+
+// saveInferior saves states of the selected inferior.
+func (d *Debugger) saveInferior() {
+	*d.inferior = inferior{
+		id:                  d.inferior.id,
+		target:              d.target,
+		symTable:            d.symTable,
+		debugeeBinaryPath:   d.debugeeBinaryPath,
+		libraries:           d.libraries,
+		loaderBreakpoint:    d.loaderBreakpoint,
+		pendingBreakpoints:  d.pendingBreakpoints,
+		breakpointLocations: d.breakpointLocations,
+		listPosition:        d.listPosition,
+		gLayout:             d.gLayout,
+	}
+}
+
+// killInferiors kills processes of all inferiors.
+func (d *Debugger) killInferiors() error {
+	d.saveInferior()
+	for _, inf := range d.inferiors {
+		if err := inf.target.Kill(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// selectInferior saves states of the selected inferior, and restores states of inf.
+func (d *Debugger) selectInferior(inf *inferior) {
+	d.saveInferior()
+
+	d.inferior = inf
+	d.target = inf.target
+	d.registerClient = NewRegisterClient(inf.target)
+	d.interruptTarget.Store(inf.target)
+	d.symTable = inf.symTable
+	d.debugeeBinaryPath = inf.debugeeBinaryPath
+	d.libraries = inf.libraries
+	d.loaderBreakpoint = inf.loaderBreakpoint
+	d.pendingBreakpoints = inf.pendingBreakpoints
+	d.breakpointLocations = inf.breakpointLocations
+	d.listPosition = inf.listPosition
+	d.gLayout = inf.gLayout
+}
+
+// removeInferior forgets inf which is not selected.
+func (d *Debugger) removeInferior(inf *inferior) {
+	inf.close()
+	d.inferiors = slices.DeleteFunc(d.inferiors, func(i *inferior) bool { return i == inf })
+}
+
+// followProcess handles fork or exec of the selected process.
+func (d *Debugger) followProcess(reason proc.StopReason) error {
+	if reason.Kind == proc.StopFork {
+		return d.followFork(reason.Child)
+	}
+
+	return d.followExec()
+}
+
+// followFork handles the child process which the selected process creates. the debugger follows
+// the parent or the child by follow-fork-mode, and the other is detached if detach-on-fork is on,
+// or kept as an inferior which stops until it is selected.
+func (d *Debugger) followFork(child *proc.Target) error {
+	parent := d.inferior
+	followChild := d.config.followForkMode == "child"
+
+	if !followChild && d.config.detachOnFork {
+		fmt.Fprintf(d.out, "process %d forked process %d, which is detached\n", d.target.Pid(), child.Pid())
+		return child.Detach()
+	}
+
+	inf, err := d.addChildInferior(child)
+	if err != nil {
+		child.Detach()
+		return err
+	}
+
+	// temporary breakpoints for stepping are only in the process which is followed
+	if !followChild {
+		d.removeTemporaryBreakpoints(child)
+		fmt.Fprintf(d.out, "process %d forked process %d, which is inferior %d\n", d.target.Pid(), child.Pid(), inf.id)
+		return nil
+	}
+
+	d.removeTemporaryBreakpoints(d.target)
+	d.selectInferior(inf)
+
+	if d.config.detachOnFork {
+		fmt.Fprintf(d.out, "following process %d (inferior %d), and process %d is detached\n", child.Pid(), inf.id, parent.target.Pid())
+		d.removeInferior(parent)
+		return parent.target.Detach()
+	}
+
+	fmt.Fprintf(d.out, "following process %d (inferior %d), and process %d stops as inferior %d\n", child.Pid(), inf.id, parent.target.Pid(), parent.id)
+	return nil
+}
+
+// removeTemporaryBreakpoints removes breakpoints of t which are not requested by users, except the one for the dynamic loader.
+func (d *Debugger) removeTemporaryBreakpoints(t *proc.Target) {
+	for _, bp := range t.Breakpoints() {
+		if bp.IsUser() || bp.Addr() == d.loaderBreakpoint {
+			continue
+		}
+		if err := t.RemoveBreakpoint(bp.Addr()); err != nil {
+			d.logger.Debug("failed to remove breakpoint", "address", fmt.Sprintf("%0x", bp.Addr()), "error", err)
+		}
+	}
+}
+
+// addChildInferior adds the child of the selected process as an inferior without selecting it.
+// the child runs the same program, and breakpoints copied from the parent are inherited.
+// a vfork child has no breakpoints because it shares memory with the parent.
+func (d *Debugger) addChildInferior(child *proc.Target) (*inferior, error) {
+	parent := d.inferior
+	d.saveInferior()
+
+	// symbols are read again, so that each inferior closes its own symbol tables
+	if err := d.loadSymbols(child); err != nil {
+		return nil, err
+	}
+
+	if _, ok := child.Breakpoint(parent.loaderBreakpoint); ok {
+		d.loaderBreakpoint = parent.loaderBreakpoint
+	}
+	if len(parent.libraries) > 0 {
+		if err := d.syncLibraries(); err != nil {
+			fmt.Fprintf(d.out, "failed to read shared libraries: %s\n", err)
+		}
+	}
+	for addr, location := range parent.breakpointLocations {
+		if _, ok := child.Breakpoint(addr); ok {
+			d.breakpointLocations[addr] = location
+		}
+	}
+
+	inf := &inferior{id: d.nextInferiorID}
+	d.nextInferiorID++
+	d.inferiors = append(d.inferiors, inf)
+
+	// states of the child are saved to inf, and the parent is selected again
+	d.inferior = inf
+	d.selectInferior(parent)
+
+	return inf, nil
+}
+
+// followExec reads symbols of the program which the selected process executes, and sets breakpoints
+// of all inferiors again by their locations. the program not built by Go is debugged without symbols,
+// so that the process can be still stopped, detached or killed.
+func (d *Debugger) followExec() error {
+	t := d.target
+
+	d.saveInferior()
+	var locations []string
+	for _, inf := range d.inferiors {
+		locations = append(locations, inf.userBreakpointLocations()...)
+	}
+	slices.Sort(locations)
+	locations = slices.Compact(locations)
+
+	old := *d.inferior
+	if err := d.load(t); err != nil {
+		d.logger.Debug("failed to load executed program", "path", t.Path(), "error", err)
+		d.setTarget(t, newEmptySymbolTable(d.logger))
+		old.close()
+		fmt.Fprintf(d.out, "process %d executed %s, which is not a Go binary, and it is debugged without symbols\n", t.Pid(), t.Path())
+		return nil
+	}
+
+	old.close()
+	fmt.Fprintf(d.out, "process %d executed %s\n", t.Pid(), t.Path())
+	for _, location := range locations {
+		if _, err := d.setBreakpointAtLocation(strings.Fields(location)); err != nil {
+			d.logger.Debug("failed to set breakpoint in executed program", "location", location, "error", err)
+		}
+	}
+
+	return nil
+}
+
+// detachSelectedInferior detaches the selected process, and selects another inferior if it exists.
+// symbols of the last inferior are kept, so that they can be still inspected.
+func (d *Debugger) detachSelectedInferior() error {
+	inf := d.inferior
+	if err := d.target.Detach(); err != nil {
+		return err
+	}
+
+	if len(d.inferiors) == 1 {
+		return nil
+	}
+
+	next := d.inferiors[0]
+	if next == inf {
+		next = d.inferiors[1]
+	}
+	d.selectInferior(next)
+	d.removeInferior(inf)
+	fmt.Fprintf(d.out, "inferior %d (process %d) is selected\n", next.id, next.target.Pid())
+
+	return nil
+}
+
+// handleInferiorsCommand lists inferiors, or selects the inferior like "inferiors 2".
+// "inferiors detach 2" and "inferiors kill 2" detach and kill the inferior which is not selected.
+func (d *Debugger) handleInferiorsCommand(args []string) error {
+	if len(args) == 0 {
+		d.printInferiors()
+		return nil
+	}
+
+	action := ""
+	if args[0] == "detach" || args[0] == "kill" {
+		action, args = args[0], args[1:]
+	}
+	if len(args) != 1 {
+		return errors.New("inferiors command takes [detach|kill] <id>")
+	}
+
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid inferior id %s", args[0])
+	}
+	i := slices.IndexFunc(d.inferiors, func(inf *inferior) bool { return inf.id == id })
+	if i < 0 {
+		return fmt.Errorf("inferior %d is not found", id)
+	}
+	inf := d.inferiors[i]
+
+	switch action {
+	case "":
+		d.selectInferior(inf)
+		fmt.Fprintf(d.out, "inferior %d (process %d) is selected\n", inf.id, inf.target.Pid())
+		return nil
+	case "detach":
+		if inf == d.inferior {
+			return d.detachSelectedInferior()
+		}
+		d.removeInferior(inf)
+		return inf.target.Detach()
+	default:
+		// the selected inferior is kept as the exited process
+		if inf == d.inferior {
+			return d.target.Kill()
+		}
+		d.removeInferior(inf)
+		return inf.target.Kill()
+	}
+}
+
+// printInferiors prints inferiors. the selected inferior is marked by '*'.
+func (d *Debugger) printInferiors() {
+	d.saveInferior()
+
+	w := tabwriter.NewWriter(d.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "  id\tpid\tstate\tprogram")
+	for _, inf := range d.inferiors {
+		mark := " "
+		if inf == d.inferior {
+			mark = "*"
+		}
+
+		state := "stopped"
+		if inf.target.Exited() {
+			state = "exited"
+		}
+
+		fmt.Fprintf(w, "%s %d\t%d\t%s\t%s\n", mark, inf.id, inf.target.Pid(), state, inf.debugeeBinaryPath)
+	}
+	w.Flush()
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+
+	"golang.org/x/arch/x86/x86asm"
+)
+
+// the maximum length of x86-64 instruction is 15 bytes
+const maxInstructionLength = 15
+
+func (d *Debugger) readInstruction(addr uint64) (x86asm.Inst, error) {
+	data, err := d.readMemoryBytes(addr, maxInstructionLength)
+	if err != nil {
+		return x86asm.Inst{}, err
+	}
+
+	inst, err := x86asm.Decode(data, 64)
+	if err != nil {
+		return x86asm.Inst{}, fmt.Errorf("failed to decode instruction at 0x%x: %s", addr, err)
+	}
+
+	return inst, nil
+}
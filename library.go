@@ -0,0 +1,311 @@
+package main
+
+import (
+	"debug/elf"
+	"debug/gosym"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// dynamic loader calls _dl_debug_state whenever shared objects are loaded or unloaded,
+// and the list of loaded shared objects is in r_debug which DT_DEBUG of the executable points to.
+// @see https://sourceware.org/git/?p=glibc.git;a=blob;f=elf/link.h
+const (
+	// AT_BASE in auxiliary vector is the address where the dynamic loader is loaded
+	auxvTypeBase = 7
+
+	dynamicTagNull  = 0
+	dynamicTagDebug = 21
+
+	dlDebugStateSymbol = "_dl_debug_state"
+
+	// r_state of r_debug, which means the list of shared objects is consistent
+	rDebugConsistent = 0
+
+	// offsets of struct r_debug
+	rDebugMapOffset   = 8
+	rDebugStateOffset = 24
+
+	// offsets of struct link_map
+	linkMapAddrOffset = 0
+	linkMapNameOffset = 8
+	linkMapNextOffset = 24
+)
+
+// the maximum length of path of shared object
+const maxLibraryPathLength = 4096
+
+// Library is a shared object loaded by the dynamic loader, including Go plugin.
+type Library struct {
+	Path string
+	// Base is the difference between the address where the library is loaded and link-time address (l_addr).
+	Base uint64
+	// symTable is nil if the library doesn't have Go debug information (e.g. libc)
+	symTable *SymbolTable
+}
+
+// watchDynamicLoader sets breakpoint at _dl_debug_state of the dynamic loader.
+// nothing is done if the debuggee is statically linked.
+func (d *Debugger) watchDynamicLoader() error {
+	base, err := readAuxv(d.target.Pid(), auxvTypeBase)
+	if err != nil || base == 0 {
+		return nil
+	}
+
+	regions, err := readMemoryRegions(d.target.Pid())
+	if err != nil {
+		return err
+	}
+
+	idx := slices.IndexFunc(regions, func(r MemoryRegion) bool { return r.Contains(base) })
+	if idx < 0 {
+		return fmt.Errorf("dynamic loader is not found at 0x%x", base)
+	}
+
+	f, err := elf.Open(regions[idx].Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	symbols, err := f.DynamicSymbols()
+	if err != nil {
+		return err
+	}
+
+	for _, s := range symbols {
+		if s.Name == dlDebugStateSymbol {
+			d.loaderBreakpoint = base + s.Value
+			return d.setBreakpoint(d.loaderBreakpoint)
+		}
+	}
+
+	return fmt.Errorf("%s is not found in %s", dlDebugStateSymbol, regions[idx].Path)
+}
+
+// rDebugAddress returns the address of r_debug from DT_DEBUG in the dynamic section of the executable.
+func (d *Debugger) rDebugAddress() (uint64, error) {
+	addr, ok := d.symTable.DynamicAddress()
+	if !ok {
+		return 0, errors.New("dynamic section is not found")
+	}
+
+	// each entry is a pair of tag and value
+	for ; ; addr += 16 {
+		tag, err := d.readMemory(addr)
+		if err != nil {
+			return 0, err
+		}
+
+		if tag == dynamicTagNull {
+			return 0, errors.New("DT_DEBUG is not found")
+		}
+
+		if tag == dynamicTagDebug {
+			return d.readMemory(addr + 8)
+		}
+	}
+}
+
+// syncLibraries reads the list of shared objects from r_debug,
+// loads symbol tables of new libraries and sets pending breakpoints in them.
+func (d *Debugger) syncLibraries() error {
+	rDebug, err := d.rDebugAddress()
+	if err != nil {
+		return err
+	}
+
+	// r_debug is not initialized yet
+	if rDebug == 0 {
+		return nil
+	}
+
+	state, err := d.readMemory(rDebug + rDebugStateOffset)
+	if err != nil {
+		return err
+	}
+
+	// libraries are being added or removed
+	if uint32(state) != rDebugConsistent {
+		return nil
+	}
+
+	linkMap, err := d.readMemory(rDebug + rDebugMapOffset)
+	if err != nil {
+		return err
+	}
+
+	var libraries []*Library
+	for ; linkMap != 0; linkMap, err = d.readMemory(linkMap + linkMapNextOffset) {
+		if err != nil {
+			return err
+		}
+
+		base, err := d.readMemory(linkMap + linkMapAddrOffset)
+		if err != nil {
+			return err
+		}
+
+		namePtr, err := d.readMemory(linkMap + linkMapNameOffset)
+		if err != nil {
+			return err
+		}
+
+		path, err := d.readCString(namePtr)
+		if err != nil {
+			return err
+		}
+
+		// the first entry is the executable, and vdso has no file
+		if path == "" || path[0] != '/' {
+			continue
+		}
+
+		i := slices.IndexFunc(d.libraries, func(l *Library) bool { return l.Path == path && l.Base == base })
+		if i >= 0 {
+			libraries = append(libraries, d.libraries[i])
+			continue
+		}
+
+		libraries = append(libraries, d.loadLibrary(path, base))
+	}
+
+	for _, l := range d.libraries {
+		if !slices.Contains(libraries, l) {
+			fmt.Fprintf(d.out, "unloaded %s\n", l.Path)
+		}
+	}
+	d.libraries = libraries
+
+	d.resolvePendingBreakpoints()
+
+	return nil
+}
+
+// loadLibrary loads symbol table of the library if it has Go debug information.
+func (d *Debugger) loadLibrary(path string, base uint64) *Library {
+	l := &Library{Path: path, Base: base}
+
+	st, err := NewSymbolTable(path, d.logger)
+	if err != nil {
+		d.logger.Debug("library without debug information", "path", path, "error", err)
+		return l
+	}
+
+	st.SetLoadBias(base)
+	l.symTable = st
+	fmt.Fprintf(d.out, "loaded symbols from %s\n", path)
+
+	return l
+}
+
+func (d *Debugger) printLibraries() {
+	if len(d.libraries) == 0 {
+		fmt.Fprintln(d.out, "no shared libraries are loaded")
+		return
+	}
+
+	for _, l := range d.libraries {
+		symbols := "no"
+		if l.symTable != nil {
+			symbols = "yes"
+		}
+		fmt.Fprintf(d.out, "0x%x	%s	symbols: %s\n", l.Base, l.Path, symbols)
+	}
+
+	if len(d.pendingBreakpoints) > 0 {
+		fmt.Fprintf(d.out, "pending breakpoints: %s\n", strings.Join(d.pendingBreakpoints, " "))
+	}
+}
+
+func (d *Debugger) readCString(addr uint64) (string, error) {
+	var s []byte
+	for len(s) < maxLibraryPathLength {
+		data, err := d.target.ReadMemory(addr+uint64(len(s)), 8)
+		if err != nil {
+			return "", err
+		}
+
+		for _, b := range data {
+			if b == 0 {
+				return string(s), nil
+			}
+			s = append(s, b)
+		}
+	}
+
+	return string(s), nil
+}
+
+// symbolTables returns symbol tables of the executable and libraries.
+func (d *Debugger) symbolTables() []*SymbolTable {
+	tables := []*SymbolTable{d.symTable}
+	for _, l := range d.libraries {
+		if l.symTable != nil {
+			tables = append(tables, l.symTable)
+		}
+	}
+
+	return tables
+}
+
+// symTableForPC returns symbol table of the executable or library which contains pc.
+func (d *Debugger) symTableForPC(pc uint64) *SymbolTable {
+	for _, l := range d.libraries {
+		if l.symTable != nil && l.symTable.ContainsPC(pc) {
+			return l.symTable
+		}
+	}
+
+	return d.symTable
+}
+
+// lookupFunc looks up the function in the executable and libraries.
+func (d *Debugger) lookupFunc(funcname string) (*SymbolTable, *gosym.Func, error) {
+	for _, st := range d.symbolTables() {
+		if fn, err := st.LookupFunc(funcname); err == nil {
+			return st, fn, nil
+		}
+	}
+
+	return nil, nil, fmt.Errorf("failed to look up function: %s", funcname)
+}
+
+// lookupSymbolByName looks up the symbol in the executable and libraries.
+func (d *Debugger) lookupSymbolByName(name string) (uint64, error) {
+	for _, st := range d.symbolTables() {
+		if addr, err := st.LookupSymbolByName(name); err == nil {
+			return addr, nil
+		}
+	}
+
+	return 0, fmt.Errorf("failed to look up symbol: %s", name)
+}
+
+// resolvePendingBreakpoints sets breakpoints whose functions are found in loaded libraries.
+func (d *Debugger) resolvePendingBreakpoints() {
+	var pending []string
+	for _, funcname := range d.pendingBreakpoints {
+		st, fn, err := d.lookupFunc(funcname)
+		if err != nil {
+			pending = append(pending, funcname)
+			continue
+		}
+
+		peAddr, err := st.GetPrologueEndAddress(fn)
+		if err != nil {
+			fmt.Fprintf(d.out, "failed to set pending breakpoint at %s: %s\n", funcname, err)
+			continue
+		}
+
+		if err := d.setUserBreakpoint(peAddr, funcname); err != nil {
+			fmt.Fprintf(d.out, "failed to set pending breakpoint at %s: %s\n", funcname, err)
+			continue
+		}
+		fmt.Fprintf(d.out, "set pending breakpoint at %s (0x%x)\n", funcname, peAddr)
+	}
+
+	d.pendingBreakpoints = pending
+}
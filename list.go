@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// listPosition is where list command without arguments continues from.
+type listPosition struct {
+	filename string
+	// next is the first line of the next page
+	next int
+}
+
+// handleListCommand lists source code around the function, file:line or current pc.
+// list without arguments continues from the last listing.
+func (d *Debugger) handleListCommand(args []string) error {
+	context := d.config.sourceContext
+
+	if len(args) == 0 {
+		if d.listPosition.filename == "" {
+			pc, err := d.getPC()
+			if err != nil {
+				return err
+			}
+
+			filename, line, _ := d.symTableForPC(pc).PCToLine(pc)
+			return d.listSource(filename, line-context, line+context)
+		}
+
+		start := d.listPosition.next
+		return d.listSource(d.listPosition.filename, start, start+2*context)
+	}
+
+	filename, line, err := d.parseListLocation(args)
+	if err != nil {
+		return err
+	}
+
+	return d.listSource(filename, line-context, line+context)
+}
+
+// parseListLocation parses "file:line", "file line" or function name.
+func (d *Debugger) parseListLocation(args []string) (filename string, line int, err error) {
+	filename, line, ok, err := d.lineLocation(args)
+	if err != nil {
+		return "", 0, err
+	}
+	if ok {
+		return filename, line, nil
+	}
+
+	st, fn, err := d.lookupFunc(args[0])
+	if err != nil {
+		return "", 0, err
+	}
+
+	filename, line, _ = st.PCToLine(fn.Entry)
+	return filename, line, nil
+}
+
+// listSource prints lines in [start, end] of the file, and remembers where the next list starts.
+func (d *Debugger) listSource(filename string, start int, end int) error {
+	start = max(start, 1)
+
+	path, ok := d.resolveSourcePath(filename)
+	if !ok {
+		fmt.Fprintf(d.out, "source of %s is not available (config substitute-path <from> <to> tells where it is)\n", filename)
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	listing := sourceListing{
+		start:       start,
+		end:         end,
+		breakpoints: d.breakpointLines(filename),
+		highlight:   d.config.sourceHighlight,
+	}
+
+	if pc, err := d.getPC(); err == nil {
+		if f, l, _ := d.symTableForPC(pc).PCToLine(pc); f == filename {
+			listing.current = l
+		}
+	}
+
+	last := printSourceCode(d.out, f, listing)
+	if last == 0 {
+		return errors.New("no more lines")
+	}
+
+	d.listPosition = listPosition{filename: filename, next: last + 1}
+
+	return nil
+}
+
+// breakpointLines returns lines of breakpoints set by users in the file.
+func (d *Debugger) breakpointLines(filename string) map[int]bool {
+	lines := make(map[int]bool)
+	for _, bp := range d.target.Breakpoints() {
+		if !bp.IsUser() {
+			continue
+		}
+
+		f, l, _ := d.symTableForPC(bp.Addr()).PCToLine(bp.Addr())
+		if f == filename {
+			lines[l] = lines[l] || bp.IsEnabled()
+		}
+	}
+
+	return lines
+}
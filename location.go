@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// moduleVersion matches version of module in paths of module cache (e.g. "@v1.2.3" in github.com/x/y@v1.2.3/file.go)
+var moduleVersion = regexp.MustCompile(`@[^/]+`)
+
+// lineLocation resolves the source line given by "file:line", "file line", "+N" or "-N".
+// filename is the path in debug information, and ok is false if args is not a line location.
+func (d *Debugger) lineLocation(args []string) (filename string, line int, ok bool, err error) {
+	var file string
+	switch {
+	case len(args) == 2:
+		line, err = strconv.Atoi(args[1])
+		if err != nil {
+			return "", 0, false, fmt.Errorf("line number must be number: %s", err)
+		}
+		file = args[0]
+	case len(args) == 1 && (strings.HasPrefix(args[0], "+") || strings.HasPrefix(args[0], "-")):
+		offset, err := strconv.Atoi(args[0])
+		if err != nil {
+			return "", 0, false, fmt.Errorf("line offset must be number: %s", err)
+		}
+
+		pc, err := d.getPC()
+		if err != nil {
+			return "", 0, false, err
+		}
+
+		// relative to the current line
+		filename, line, _ := d.symTableForPC(pc).PCToLine(pc)
+		return filename, line + offset, true, nil
+	case len(args) == 1:
+		i := strings.LastIndex(args[0], ":")
+		if i <= 0 {
+			return "", 0, false, nil
+		}
+
+		line, err = strconv.Atoi(args[0][i+1:])
+		if err != nil {
+			return "", 0, false, nil
+		}
+		file = args[0][:i]
+	default:
+		return "", 0, false, nil
+	}
+
+	filename, err = d.findSourceFile(file)
+	if err != nil {
+		return "", 0, false, err
+	}
+
+	return filename, line, true, nil
+}
+
+// findSourceFile finds the file in debug information by the absolute path, the base name,
+// a suffix of the path or the path qualified by the package (e.g. github.com/x/y/file.go).
+func (d *Debugger) findSourceFile(name string) (string, error) {
+	var files []string
+	for _, st := range d.symbolTables() {
+		f, err := st.Files()
+		if err != nil {
+			return "", err
+		}
+		files = append(files, f...)
+	}
+
+	if slices.Contains(files, name) {
+		return name, nil
+	}
+
+	// package qualified path in the main module is in the module directory
+	env := d.goEnvironment()
+	if rest, ok := cutPathPrefix(name, env.modulePath); ok && env.moduleDir != "" {
+		if path := filepath.Join(env.moduleDir, rest); slices.Contains(files, path) {
+			return path, nil
+		}
+	}
+
+	// local path of the source whose path in debug information is different (e.g. built with -trimpath)
+	if filepath.IsAbs(name) {
+		for _, f := range files {
+			if path, ok := d.resolveSourcePath(f); ok && path == name {
+				return f, nil
+			}
+		}
+	}
+
+	var candidates []string
+	for _, f := range files {
+		if f == name || strings.HasSuffix(f, "/"+name) || strings.HasSuffix(moduleVersion.ReplaceAllString(f, ""), "/"+name) {
+			candidates = append(candidates, f)
+		}
+	}
+	slices.Sort(candidates)
+	candidates = slices.Compact(candidates)
+
+	switch len(candidates) {
+	case 0:
+		return "", fmt.Errorf("no source file matches %s", name)
+	case 1:
+		return candidates[0], nil
+	}
+
+	return "", fmt.Errorf("%s is ambiguous, it matches:\n  %s", name, strings.Join(candidates, "\n  "))
+}
@@ -1,29 +1,154 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
+	"net"
 	"os"
 
 	"github.com/ksrnnb/godbg/logger"
 )
 
 func main() {
-	args := os.Args
-	if len(args) < 2 {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		// godbg dap [-listen addr]
+		case "dap":
+			fs := flag.NewFlagSet("dap", flag.ExitOnError)
+			listen := fs.String("listen", "", "TCP address to serve DAP (stdin and stdout are used by default)")
+			fs.Parse(os.Args[2:])
+
+			if err := runDAPServer(*listen); err != nil {
+				log.Fatalf("failed to run DAP server: %s", err)
+			}
+			return
+		// godbg headless -listen addr [flags] <debuggee path> [args]
+		case "headless":
+			fs := flag.NewFlagSet("headless", flag.ExitOnError)
+			listen := fs.String("listen", "", "address to serve API (unix:<path> or TCP address)")
+			config := debuggeeFlags(fs)
+			fs.Parse(os.Args[2:])
+
+			if *listen == "" {
+				log.Fatalf("-listen must be given")
+			}
+
+			if err := runHeadless(*listen, fs.Args(), config); err != nil {
+				log.Fatalf("failed to run headless server: %s", err)
+			}
+			return
+		// godbg gdbserver -listen addr [flags] <debuggee path> [args]
+		case "gdbserver":
+			fs := flag.NewFlagSet("gdbserver", flag.ExitOnError)
+			listen := fs.String("listen", "", "TCP address to serve GDB remote serial protocol")
+			config := debuggeeFlags(fs)
+			fs.Parse(os.Args[2:])
+
+			if *listen == "" {
+				log.Fatalf("-listen must be given")
+			}
+
+			if err := runGDBServer(*listen, fs.Args(), config); err != nil {
+				log.Fatalf("failed to run GDB server: %s", err)
+			}
+			return
+		// godbg connect <addr>
+		case "connect":
+			if len(os.Args) < 3 {
+				log.Fatalf("address of headless server must be given")
+			}
+
+			network, address := parseListenAddress(os.Args[2])
+			conn, err := net.Dial(network, address)
+			if err != nil {
+				log.Fatalf("failed to connect: %s", err)
+			}
+
+			if err := NewHandler(conn).Run(); err != nil {
+				log.Fatalf("failed to run handler: %s", err)
+			}
+			return
+		}
+	}
+
+	config := debuggeeFlags(flag.CommandLine)
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) < 1 {
 		log.Fatalf("debuggee path must be given")
 	}
 
-	l := logger.NewLogger()
-	dbg, err := NewDebugger(args[1], l)
+	config.args = args[1:]
+	server, err := startServer(args[0], config)
 	if err != nil {
 		log.Fatalf("failed to set up debugger: %s", err)
 	}
 
-	handler := NewHandler(dbg)
-	if err := handler.Run(); err != nil {
+	// REPL is a client of the server in the same process
+	serverConn, clientConn := net.Pipe()
+	server.serveConn(serverConn)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- NewHandler(clientConn).Run()
+	}()
+
+	if err := server.run(done); err != nil {
 		log.Fatalf("failed to run handler: %s", err)
 	}
 
-	fmt.Println("process has been completed.")
+	// the REPL ends by quit command or EOF of stdin
+	if err := server.d.quit(); err != nil {
+		log.Fatalf("failed to quit: %s", err)
+	}
+}
+
+// debuggeeFlags defines flags to build and run the debuggee.
+func debuggeeFlags(fs *flag.FlagSet) *Config {
+	config := NewConfig()
+	fs.StringVar(&config.buildMode, "buildmode", "", "build mode of the debuggee (e.g. pie)")
+	fs.BoolVar(&config.trimpath, "trimpath", false, "build the debuggee with -trimpath")
+	fs.BoolVar(&config.aslr, "aslr", false, "leave address space layout randomization enabled")
+	return config
+}
+
+// startServer starts the debuggee and waits until it stops at the entry.
+func startServer(debuggeePath string, config *Config) (*rpcServer, error) {
+	d, err := NewDebugger(debuggeePath, config, logger.NewLogger())
+	if err != nil {
+		return nil, err
+	}
+
+	return newRPCServer(d), nil
+}
+
+// runHeadless serves API without the REPL until a client sends quit command.
+func runHeadless(address string, args []string, config *Config) error {
+	if len(args) < 1 {
+		return fmt.Errorf("debuggee path must be given")
+	}
+
+	config.args = args[1:]
+	server, err := startServer(args[0], config)
+	if err != nil {
+		return err
+	}
+
+	network, addr := parseListenAddress(address)
+	listener, err := net.Listen(network, addr)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+
+	server.listen(listener)
+	fmt.Printf("API server listening at %s\n", address)
+
+	if err := server.run(nil); err != nil {
+		return err
+	}
+
+	return server.d.quit()
 }
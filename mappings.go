@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ksrnnb/godbg/proc"
+)
+
+// size of a heap arena and the address of arena index 0 on linux/amd64.
+// the address of arena index i is i*heapArenaBytes + arenaBaseOffset.
+// @see https://cs.opensource.google/go/go/+/refs/tags/go1.22.5:src/runtime/malloc.go;l=243
+const (
+	heapArenaBytes  = 64 << 20
+	arenaBaseOffset = 0xffff800000000000
+)
+
+type MemoryRegion struct {
+	Start  uint64
+	End    uint64
+	Perms  string
+	Offset uint64
+	Path   string
+}
+
+func (r MemoryRegion) Contains(addr uint64) bool {
+	return r.Start <= addr && addr < r.End
+}
+
+// goroutineStack is stack bounds of runtime.g
+type goroutineStack struct {
+	lo uint64
+	hi uint64
+}
+
+// AT_ENTRY in auxiliary vector is the runtime address of the entry point of the program.
+// you can see other types by "cat /usr/include/elf.h"
+const auxvTypeEntry = 9
+
+// readAuxv reads the value of the type from /proc/<pid>/auxv
+func readAuxv(pid int, auxvType uint64) (uint64, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/auxv", pid))
+	if err != nil {
+		return 0, err
+	}
+
+	// each entry is a pair of type and value, and the vector ends with AT_NULL
+	for len(data) >= 16 {
+		typ := binary.LittleEndian.Uint64(data[0:])
+		value := binary.LittleEndian.Uint64(data[8:])
+		if typ == 0 {
+			break
+		}
+		if typ == auxvType {
+			return value, nil
+		}
+		data = data[16:]
+	}
+
+	return 0, fmt.Errorf("type %d is not found in auxiliary vector", auxvType)
+}
+
+// readMemoryRegions parses /proc/<pid>/maps
+func readMemoryRegions(pid int) ([]MemoryRegion, error) {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/maps", pid))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var regions []MemoryRegion
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		// e.g. 00400000-0047f000 r-xp 00000000 08:01 1234 /path/to/binary
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 5 {
+			continue
+		}
+
+		start, end, ok := strings.Cut(fields[0], "-")
+		if !ok {
+			return nil, fmt.Errorf("unexpected address range %s", fields[0])
+		}
+
+		r := MemoryRegion{Perms: fields[1]}
+		if r.Start, err = strconv.ParseUint(start, 16, 64); err != nil {
+			return nil, err
+		}
+		if r.End, err = strconv.ParseUint(end, 16, 64); err != nil {
+			return nil, err
+		}
+		if r.Offset, err = strconv.ParseUint(fields[2], 16, 64); err != nil {
+			return nil, err
+		}
+		if len(fields) >= 6 {
+			r.Path = strings.Join(fields[5:], " ")
+		}
+
+		regions = append(regions, r)
+	}
+
+	return regions, sc.Err()
+}
+
+func (d *Debugger) handleInfoCommand(args []string) error {
+	// "info proc mappings" is same as "info mappings"
+	if len(args) > 0 && args[0] == "proc" {
+		args = args[1:]
+	}
+
+	if len(args) == 0 {
+		return errors.New("info command must have sub command")
+	}
+
+	switch args[0] {
+	case "mappings":
+		return d.printMemoryRegions()
+	case "sharedlibrary":
+		d.printLibraries()
+		return nil
+	case "threads":
+		if d.target.Exited() {
+			return proc.ErrExited
+		}
+
+		d.printThreads()
+		return nil
+	case "address":
+		if len(args) < 2 {
+			return errors.New("address must be given")
+		}
+
+		addr, err := d.evalAddress(strings.Join(args[1:], ""))
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintln(d.out, d.explainAddress(addr))
+		return nil
+	}
+
+	return fmt.Errorf("unexpected info sub command '%s' is given", args[0])
+}
+
+func (d *Debugger) printMemoryRegions() error {
+	regions, err := readMemoryRegions(d.target.Pid())
+	if err != nil {
+		return err
+	}
+
+	stacks := d.goroutineStacks()
+	arenas := d.heapArenas()
+
+	w := tabwriter.NewWriter(d.out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "start\tend\tsize\tperms\toffset\tkind\tpath")
+	for _, r := range regions {
+		fmt.Fprintf(w, "0x%x\t0x%x\t0x%x\t%s\t0x%x\t%s\t%s\n", r.Start, r.End, r.End-r.Start, r.Perms, r.Offset, d.classifyRegion(r, stacks, arenas), r.Path)
+	}
+
+	return w.Flush()
+}
+
+// explainAddress describes which region, symbol and goroutine stack addr belongs to.
+func (d *Debugger) explainAddress(addr uint64) string {
+	regions, err := readMemoryRegions(d.target.Pid())
+	if err != nil {
+		return fmt.Sprintf("failed to read memory mappings: %s", err)
+	}
+
+	i := slices.IndexFunc(regions, func(r MemoryRegion) bool { return r.Contains(addr) })
+	if i < 0 {
+		return fmt.Sprintf("0x%x is not mapped", addr)
+	}
+
+	stacks := d.goroutineStacks()
+	r := regions[i]
+	desc := fmt.Sprintf("0x%x is in %s (0x%x-0x%x %s)", addr, d.classifyRegion(r, stacks, d.heapArenas()), r.Start, r.End, r.Perms)
+
+	if name, offset, ok := d.symTableForPC(addr).LookupSymbolByAddr(addr); ok {
+		desc += fmt.Sprintf(", symbol %s+%d", name, offset)
+	}
+
+	for _, s := range stacks {
+		if s.lo <= addr && addr < s.hi {
+			desc += fmt.Sprintf(", goroutine stack 0x%x-0x%x", s.lo, s.hi)
+			break
+		}
+	}
+
+	if !strings.HasPrefix(r.Perms, "r") {
+		desc += ", not readable"
+	}
+
+	return desc
+}
+
+// classifyRegion returns which Go concept the region corresponds to.
+// arenas are start addresses of heap arenas which the runtime uses.
+func (d *Debugger) classifyRegion(r MemoryRegion, stacks []goroutineStack, arenas []uint64) string {
+	switch r.Path {
+	case "[stack]":
+		return "thread stack"
+	case "[heap]":
+		return "C heap"
+	case "[vdso]", "[vvar]", "[vsyscall]":
+		return "kernel"
+	}
+
+	var kinds []string
+	for _, section := range d.symTable.Sections() {
+		if section.Start >= r.End || section.End <= r.Start {
+			continue
+		}
+
+		kind := sectionKind(section.Name)
+		if !slices.Contains(kinds, kind) {
+			kinds = append(kinds, kind)
+		}
+	}
+	if len(kinds) > 0 {
+		return strings.Join(kinds, ",")
+	}
+
+	if r.Path != "" {
+		return "file"
+	}
+
+	numStacks := 0
+	for _, s := range stacks {
+		if r.Start <= s.lo && s.hi <= r.End {
+			numStacks++
+		}
+	}
+
+	// other anonymous mappings (e.g. thread stacks and cgo allocations) may be next to arenas
+	isArena := slices.ContainsFunc(arenas, func(start uint64) bool {
+		return start < r.End && r.Start < start+heapArenaBytes
+	})
+	if isArena {
+		if numStacks > 0 {
+			return fmt.Sprintf("heap arena (%d goroutine stacks)", numStacks)
+		}
+		return "heap arena"
+	}
+
+	if numStacks > 0 {
+		return fmt.Sprintf("goroutine stacks (%d)", numStacks)
+	}
+
+	return "anonymous"
+}
+
+func sectionKind(name string) string {
+	switch name {
+	case ".text", ".plt", ".init", ".fini":
+		return "text"
+	case ".data", ".noptrdata", ".bss", ".noptrbss", ".go.buildinfo", ".got", ".got.plt", ".tbss":
+		return "data/bss"
+	}
+
+	return "rodata"
+}
+
+// heapArenas reads start addresses of heap arenas from runtime.mheap_, which has slices of arenaIdx.
+// older releases have allArenas, and newer ones have heapArenas and userArenaArenas.
+func (d *Debugger) heapArenas() []uint64 {
+	mheapAddr, err := d.symTable.LookupSymbolByName("runtime.mheap_")
+	if err != nil {
+		return nil
+	}
+
+	t, err := d.symTable.LookupType("runtime.mheap")
+	if err != nil {
+		return nil
+	}
+
+	var arenas []uint64
+	for _, name := range []string{"allArenas", "heapArenas", "userArenaArenas"} {
+		offset, _, err := structField(t, name)
+		if err != nil {
+			continue
+		}
+
+		ptr, ok := d.readWord(mheapAddr + uint64(offset))
+		if !ok {
+			continue
+		}
+
+		length, ok := d.readWord(mheapAddr + uint64(offset) + 8)
+		if !ok {
+			continue
+		}
+
+		for i := uint64(0); i < length; i++ {
+			if idx, ok := d.readWord(ptr + 8*i); ok {
+				arenas = append(arenas, idx*heapArenaBytes+arenaBaseOffset)
+			}
+		}
+	}
+
+	return arenas
+}
+
+// goroutineStacks reads stack bounds of all goroutines from runtime.allgs.
+// runtime.g has stack (lo and hi) as the first field.
+func (d *Debugger) goroutineStacks() []goroutineStack {
+	var stacks []goroutineStack
+	for _, g := range d.allgs() {
+		lo, ok := d.readWord(g)
+		if !ok || lo == 0 {
+			continue
+		}
+
+		hi, ok := d.readWord(g + 8)
+		if !ok || hi == 0 {
+			continue
+		}
+
+		stacks = append(stacks, goroutineStack{lo: lo, hi: hi})
+	}
+
+	return stacks
+}
@@ -3,43 +3,126 @@ package main
 import (
 	"bufio"
 	"fmt"
+	"go/scanner"
+	"go/token"
 	"io"
+	"strings"
 )
 
-// how many lines from given line number
-const lineRange = 5
+// how many lines from given line number by default
+const defaultSourceContext = 5
 
-func printSourceCode(reader io.Reader, line int) {
-	scanner := bufio.NewScanner(reader)
+const (
+	currentLineMarker        = '>'
+	enabledBreakpointMarker  = '*'
+	disabledBreakpointMarker = 'o'
+)
 
-	startLine := 1
-	if line > lineRange {
-		startLine = line - lineRange
-	}
-	endLine := line + lineRange
+// sourceListing is a range of lines to be printed with markers.
+type sourceListing struct {
+	start int
+	end   int
+	// current is the line of current pc, or 0 if pc is not in the file
+	current int
+	// breakpoints maps line to whether the breakpoint is enabled
+	breakpoints map[int]bool
+	highlight   bool
+}
 
-	currentLine := 1
-	var lines []string
+// printSourceCode prints lines in [start, end] of the listing and returns the last printed line.
+func printSourceCode(w io.Writer, reader io.Reader, listing sourceListing) int {
+	scanner := bufio.NewScanner(reader)
+
+	currentLine := 0
+	last := 0
 	for scanner.Scan() {
-		if currentLine < startLine {
-			currentLine++
+		currentLine++
+		if currentLine < listing.start {
 			continue
 		}
-		if currentLine > endLine {
+		if currentLine > listing.end {
 			break
 		}
 
 		text := scanner.Text()
-		if currentLine == line {
-			text = fmt.Sprintf("> %d %s", currentLine, text)
-		} else {
-			text = fmt.Sprintf("  %d %s", currentLine, text)
+		if listing.highlight {
+			text = highlightGoLine(text)
 		}
-		lines = append(lines, text)
-		currentLine++
+
+		fmt.Fprintf(w, "%c%c %d %s\n", listing.marker(currentLine), listing.breakpointMarker(currentLine), currentLine, text)
+		last = currentLine
+	}
+
+	return last
+}
+
+func (l sourceListing) marker(line int) rune {
+	if line == l.current {
+		return currentLineMarker
+	}
+
+	return ' '
+}
+
+func (l sourceListing) breakpointMarker(line int) rune {
+	enabled, ok := l.breakpoints[line]
+	switch {
+	case !ok:
+		return ' '
+	case enabled:
+		return enabledBreakpointMarker
 	}
 
-	for _, text := range lines {
-		fmt.Printf("%s\n", text)
+	return disabledBreakpointMarker
+}
+
+// ANSI escape sequences of colors for syntax highlighting
+const (
+	colorReset   = "\x1b[0m"
+	colorKeyword = "\x1b[34m"
+	colorString  = "\x1b[32m"
+	colorNumber  = "\x1b[35m"
+	colorComment = "\x1b[90m"
+)
+
+// highlightGoLine colors keywords, literals and comments in a line of Go source.
+// comments and raw strings across lines are not colored because each line is scanned separately.
+func highlightGoLine(line string) string {
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(line))
+
+	var s scanner.Scanner
+	s.Init(file, []byte(line), func(token.Position, string) {}, scanner.ScanComments)
+
+	var b strings.Builder
+	written := 0
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+
+		var color string
+		switch {
+		case tok.IsKeyword():
+			color = colorKeyword
+		case tok == token.STRING || tok == token.CHAR:
+			color = colorString
+		case tok == token.INT || tok == token.FLOAT || tok == token.IMAG:
+			color = colorNumber
+		case tok == token.COMMENT:
+			color = colorComment
+		default:
+			continue
+		}
+
+		offset := file.Offset(pos)
+		end := min(offset+len(lit), len(line))
+		b.WriteString(line[written:offset])
+		b.WriteString(color + line[offset:end] + colorReset)
+		written = end
 	}
+	b.WriteString(line[written:])
+
+	return b.String()
 }
@@ -0,0 +1,149 @@
+package proc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	sys "golang.org/x/sys/unix"
+)
+
+const Int3Instruction = 0xcc
+
+type Breakpoint struct {
+	pid                 int
+	addr                uintptr
+	originalInstruction []byte
+	isEnabled           bool
+	// user is true if the breakpoint is set by users, and false if it is temporary one for stepping
+	user bool
+}
+
+func NewBreakpoint(pid int, addr uint64) *Breakpoint {
+	return &Breakpoint{pid: pid, addr: uintptr(addr), originalInstruction: make([]byte, 8)}
+}
+
+func (bp *Breakpoint) Enable() error {
+	_, err := sys.PtracePeekData(bp.pid, bp.addr, bp.originalInstruction)
+	if err != nil {
+		return err
+	}
+
+	data := binary.LittleEndian.Uint64(bp.originalInstruction)
+	// data & ^0xff => data & 11111111 11111111 11111111 00000000
+	newData := (data & ^uint64(0xff)) | Int3Instruction
+	newInstruction := make([]byte, 8)
+	binary.LittleEndian.PutUint64(newInstruction, newData)
+
+	_, err = sys.PtracePokeData(bp.pid, bp.addr, newInstruction)
+	if err != nil {
+		return err
+	}
+
+	bp.isEnabled = true
+	return nil
+}
+
+func (bp *Breakpoint) Disable() error {
+	_, err := sys.PtracePokeData(bp.pid, bp.addr, bp.originalInstruction)
+	if err != nil {
+		return err
+	}
+
+	bp.isEnabled = false
+	return nil
+}
+
+// copyTo returns the breakpoint in the memory of the child process of pid, which is copied by fork.
+func (bp *Breakpoint) copyTo(pid int) *Breakpoint {
+	return &Breakpoint{
+		pid:                 pid,
+		addr:                bp.addr,
+		originalInstruction: append([]byte(nil), bp.originalInstruction...),
+		isEnabled:           bp.isEnabled,
+		user:                bp.user,
+	}
+}
+
+func (bp *Breakpoint) IsEnabled() bool {
+	return bp.isEnabled
+}
+
+func (bp *Breakpoint) IsUser() bool {
+	return bp.user
+}
+
+func (bp *Breakpoint) Addr() uint64 {
+	return uint64(bp.addr)
+}
+
+// SetBreakpoint sets temporary breakpoint for stepping.
+func (t *Target) SetBreakpoint(addr uint64) error {
+	if t.exited {
+		return ErrExited
+	}
+
+	// enabling the same address twice saves int3 as the original instruction
+	if bp, ok := t.breakpoints[addr]; ok && bp.IsEnabled() {
+		return nil
+	}
+
+	bp := NewBreakpoint(t.pid, addr)
+	if err := bp.Enable(); err != nil {
+		return fmt.Errorf("failed to set breakpoint at 0x%x: %s", addr, err)
+	}
+
+	t.breakpoints[addr] = bp
+	return nil
+}
+
+// SetUserBreakpoint sets breakpoint requested by users. a temporary breakpoint at addr becomes the user's one.
+func (t *Target) SetUserBreakpoint(addr uint64) error {
+	if err := t.SetBreakpoint(addr); err != nil {
+		return err
+	}
+
+	t.breakpoints[addr].user = true
+	return nil
+}
+
+// RemoveBreakpoint disables and removes the breakpoint at addr if it exists.
+func (t *Target) RemoveBreakpoint(addr uint64) error {
+	bp, ok := t.breakpoints[addr]
+	if !ok {
+		return nil
+	}
+
+	// breakpoint must be disabled before delete it from map
+	delete(t.breakpoints, addr)
+	if t.exited {
+		return nil
+	}
+	return bp.Disable()
+}
+
+func (t *Target) Breakpoint(addr uint64) (*Breakpoint, bool) {
+	bp, ok := t.breakpoints[addr]
+	return bp, ok
+}
+
+// Breakpoints returns breakpoints sorted by address.
+func (t *Target) Breakpoints() []*Breakpoint {
+	bps := make([]*Breakpoint, 0, len(t.breakpoints))
+	for _, bp := range t.breakpoints {
+		bps = append(bps, bp)
+	}
+
+	sort.Slice(bps, func(i, j int) bool { return bps[i].addr < bps[j].addr })
+	return bps
+}
+
+// enabledBreakpoint returns the breakpoint at addr if it is enabled.
+func (t *Target) enabledBreakpoint(addr uint64) (*Breakpoint, bool) {
+	bp, ok := t.breakpoints[addr]
+	if !ok || !bp.IsEnabled() {
+		return nil, false
+	}
+
+	return bp, true
+}
@@ -0,0 +1,248 @@
+package proc
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	sys "golang.org/x/sys/unix"
+)
+
+// tracer is processes traced by the thread which calls Launch or Attach. children created by fork are traced
+// by the thread which traces the parent, so that wait of a process may receive statuses of the others,
+// which are kept until they wait. the processes share the tracer, and mu guards it.
+type tracer struct {
+	mu              sync.Mutex
+	tracees         map[int]*Target
+	pendingStatuses map[int]sys.WaitStatus
+}
+
+func newTracer() *tracer {
+	return &tracer{
+		tracees:         make(map[int]*Target),
+		pendingStatuses: make(map[int]sys.WaitStatus),
+	}
+}
+
+// add starts to track the process.
+func (tr *tracer) add(t *Target) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	tr.tracees[t.pid] = t
+}
+
+// takePendingStatus returns a status of a thread of t which wait of another process has received.
+func (tr *tracer) takePendingStatus(t *Target) (int, sys.WaitStatus, bool) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	for tid, ws := range tr.pendingStatuses {
+		if tr.threadOwner(tid) == t {
+			delete(tr.pendingStatuses, tid)
+			return tid, ws, true
+		}
+	}
+
+	return 0, 0, false
+}
+
+// keepStatus keeps the status of the thread which is not of the waiting process, unless it is not traced
+// and has terminated. it returns false if the thread belongs to t.
+func (tr *tracer) keepStatus(t *Target, tid int, ws sys.WaitStatus) bool {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	owner := tr.threadOwner(tid)
+	if owner == t {
+		return false
+	}
+
+	// a child process whose fork event is not received yet is also kept
+	if owner != nil || ws.Stopped() {
+		tr.pendingStatuses[tid] = ws
+	}
+
+	return true
+}
+
+// threadOwner returns the process which the thread of tid belongs to, or nil if it is not traced,
+// e.g. a child whose fork event is not received yet.
+func (tr *tracer) threadOwner(tid int) *Target {
+	for _, t := range tr.tracees {
+		if _, ok := t.threads[tid]; ok {
+			return t
+		}
+	}
+
+	tgid, err := threadGroupID(tid)
+	if err != nil {
+		return nil
+	}
+
+	return tr.tracees[tgid]
+}
+
+// threadGroupID returns the process id of the thread from /proc/<tid>/status.
+func threadGroupID(tid int) (int, error) {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/status", tid))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if v, ok := strings.CutPrefix(sc.Text(), "Tgid:"); ok {
+			return strconv.Atoi(strings.TrimSpace(v))
+		}
+	}
+
+	return 0, fmt.Errorf("thread group of thread %d is not found", tid)
+}
+
+// untrace forgets the process which has terminated or is detached.
+func (t *Target) untrace() {
+	tr := t.tracer
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	delete(tr.tracees, t.pid)
+	for tid := range tr.pendingStatuses {
+		if _, ok := t.threads[tid]; ok {
+			delete(tr.pendingStatuses, tid)
+		}
+	}
+}
+
+// fork returns the child process created by th, which is reported by PTRACE_EVENT_FORK or PTRACE_EVENT_VFORK.
+// the child is traced automatically, and it stops until the caller resumes or detaches it.
+func (t *Target) fork(th *Thread, vfork bool) (*Target, error) {
+	msg, err := sys.PtraceGetEventMsg(th.tid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get child process of thread %d: %s", th.tid, err)
+	}
+
+	child := newTarget(int(msg), t.path, t.tracer)
+	child.attached = t.attached
+	for sig, policy := range t.signalPolicies {
+		child.signalPolicies[sig] = policy
+	}
+	child.notifySignal = t.notifySignal
+
+	if vfork {
+		// the child shares memory with the parent until it executes a program or exits,
+		// and breakpoints are removed so that the child doesn't trap without the debugger
+		if err := t.suspendBreakpoints(); err != nil {
+			return nil, err
+		}
+	} else {
+		// the copied memory of the child has the breakpoints
+		for addr, bp := range t.breakpoints {
+			if bp.isEnabled {
+				child.breakpoints[addr] = bp.copyTo(child.pid)
+			}
+		}
+	}
+
+	// the child starts with SIGSTOP, which may have been received already
+	child.current = &Thread{tid: child.pid, running: true, stopping: true, new: true}
+	child.threads[child.pid] = child.current
+	exit, err := child.waitThreads()
+	if err != nil {
+		return nil, err
+	}
+	if exit != nil {
+		child.exited = true
+		child.lastStop = *exit
+		child.untrace()
+	}
+
+	return child, nil
+}
+
+// suspendBreakpoints removes breakpoints from memory shared with the vfork child until the child releases it.
+func (t *Target) suspendBreakpoints() error {
+	for _, bp := range t.breakpoints {
+		if !bp.isEnabled {
+			continue
+		}
+		if err := bp.Disable(); err != nil {
+			return err
+		}
+		t.suspendedBreakpoints = append(t.suspendedBreakpoints, bp)
+	}
+
+	return nil
+}
+
+// resumeBreakpoints inserts breakpoints again when the vfork child executes a program or exits,
+// which is reported by PTRACE_EVENT_VFORK_DONE. breakpoints removed meanwhile are not inserted.
+func (t *Target) resumeBreakpoints() error {
+	suspended := t.suspendedBreakpoints
+	t.suspendedBreakpoints = nil
+
+	for _, bp := range suspended {
+		if t.breakpoints[uint64(bp.addr)] != bp {
+			continue
+		}
+		if err := bp.Enable(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// exec handles PTRACE_EVENT_EXEC. the thread which executes the program becomes the main thread,
+// and the others have exited. breakpoints and watchpoints are gone with the old program.
+func (t *Target) exec() error {
+	path, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", t.pid))
+	if err != nil {
+		return fmt.Errorf("failed to get executed program of pid %d: %s", t.pid, err)
+	}
+
+	t.path = path
+	t.current = &Thread{tid: t.pid}
+	t.threads = map[int]*Thread{t.pid: t.current}
+	t.breakpoints = make(map[uint64]*Breakpoint)
+	t.suspendedBreakpoints = nil
+	t.watchpoints = [numWatchpoints]*Watchpoint{}
+
+	return nil
+}
+
+// processEvent handles ptrace events of th except clone. it returns the event which the caller reports,
+// or nil if th can be resumed.
+func (t *Target) processEvent(th *Thread, ws sys.WaitStatus) (*StopReason, error) {
+	switch ws.TrapCause() {
+	case sys.PTRACE_EVENT_FORK, sys.PTRACE_EVENT_VFORK:
+		child, err := t.fork(th, ws.TrapCause() == sys.PTRACE_EVENT_VFORK)
+		if err != nil {
+			return nil, err
+		}
+		return &StopReason{Kind: StopFork, Signal: sys.SIGTRAP, Child: child}, nil
+	case sys.PTRACE_EVENT_VFORK_DONE:
+		return nil, t.resumeBreakpoints()
+	case sys.PTRACE_EVENT_EXEC:
+		if err := t.exec(); err != nil {
+			return nil, err
+		}
+		return &StopReason{Kind: StopExec, Signal: sys.SIGTRAP}, nil
+	}
+
+	return nil, fmt.Errorf("unexpected ptrace event %d of thread %d", ws.TrapCause(), th.tid)
+}
+
+// isProcessEvent returns true if ws is a ptrace event handled by processEvent.
+func isProcessEvent(ws sys.WaitStatus) bool {
+	switch ws.TrapCause() {
+	case sys.PTRACE_EVENT_FORK, sys.PTRACE_EVENT_VFORK, sys.PTRACE_EVENT_VFORK_DONE, sys.PTRACE_EVENT_EXEC:
+		return true
+	}
+
+	return false
+}
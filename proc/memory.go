@@ -0,0 +1,104 @@
+package proc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"slices"
+
+	sys "golang.org/x/sys/unix"
+)
+
+// ReadMemory reads memory of the process, and breakpoint instructions are
+// replaced with original instructions. data may be shorter than size if a part of it is not readable.
+func (t *Target) ReadMemory(addr uint64, size int) ([]byte, error) {
+	if t.exited {
+		return nil, ErrExited
+	}
+
+	data := make([]byte, size)
+	n, err := t.readProcessMemory(addr, data)
+	if err != nil && n == 0 {
+		return nil, fmt.Errorf("failed to read memory at 0x%x: %s", addr, err)
+	}
+	data = data[:n]
+
+	for bpAddr, bp := range t.breakpoints {
+		if !bp.IsEnabled() {
+			continue
+		}
+
+		if bpAddr >= addr && bpAddr < addr+uint64(n) {
+			data[bpAddr-addr] = bp.originalInstruction[0]
+		}
+	}
+
+	return data, nil
+}
+
+// ReadWord reads 8 bytes at addr as uint64.
+func (t *Target) ReadWord(addr uint64) (uint64, error) {
+	data, err := t.ReadMemory(addr, 8)
+	if err != nil {
+		return 0, err
+	}
+	if len(data) < 8 {
+		return 0, fmt.Errorf("failed to read memory at 0x%x: only %d bytes are readable", addr, len(data))
+	}
+
+	return binary.LittleEndian.Uint64(data), nil
+}
+
+// readProcessMemory reads memory by process_vm_readv at once.
+// if it fails (e.g. the page is not readable), it falls back to PtracePeekData which reads word by word.
+func (t *Target) readProcessMemory(addr uint64, data []byte) (int, error) {
+	if len(data) == 0 {
+		return 0, nil
+	}
+
+	local := []sys.Iovec{{Base: &data[0]}}
+	local[0].SetLen(len(data))
+	remote := []sys.RemoteIovec{{Base: uintptr(addr), Len: len(data)}}
+
+	n, err := sys.ProcessVMReadv(t.pid, local, remote, 0)
+	if err == nil && n == len(data) {
+		return n, nil
+	}
+
+	return sys.PtracePeekData(t.pid, uintptr(addr), data)
+}
+
+// WriteMemory writes data to memory of the process. original instructions of breakpoints
+// are updated instead of breakpoint instructions, so that breakpoints remain.
+func (t *Target) WriteMemory(addr uint64, data []byte) error {
+	if t.exited {
+		return ErrExited
+	}
+
+	data = slices.Clone(data)
+	end := addr + uint64(len(data))
+
+	for bpAddr, bp := range t.breakpoints {
+		if !bp.IsEnabled() {
+			continue
+		}
+
+		// original instruction is a word from the address of breakpoint
+		for i := range bp.originalInstruction {
+			a := bpAddr + uint64(i)
+			if a < addr || a >= end {
+				continue
+			}
+
+			bp.originalInstruction[i] = data[a-addr]
+			if i == 0 {
+				data[a-addr] = Int3Instruction
+			}
+		}
+	}
+
+	if _, err := sys.PtracePokeData(t.pid, uintptr(addr), data); err != nil {
+		return fmt.Errorf("failed to write memory at 0x%x: %s", addr, err)
+	}
+
+	return nil
+}
@@ -1,4 +1,4 @@
-package main
+package proc
 
 import (
 	sys "golang.org/x/sys/unix"
@@ -11,3 +11,11 @@ func ptraceSingleStep(pid int, sig int) error {
 	}
 	return nil
 }
+
+func ptraceDetach(tid int, sig int) error {
+	_, _, e1 := sys.Syscall6(sys.SYS_PTRACE, uintptr(sys.PTRACE_DETACH), uintptr(tid), uintptr(0), uintptr(sig), 0, 0)
+	if e1 != 0 {
+		return e1
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package proc
+
+import (
+	"syscall"
+
+	sys "golang.org/x/sys/unix"
+)
+
+// SignalPolicy is how the debugger handles a signal which the process receives.
+type SignalPolicy struct {
+	// Stop returns the signal to the caller of Continue and StepInstruction
+	Stop bool
+	// Print means that the signal is shown to users. signals which don't stop are given to the notifier of NotifySignals
+	Print bool
+	// Pass delivers the signal to the process when it is resumed
+	Pass bool
+}
+
+// DefaultSignalPolicy returns the policy of sig unless it is changed by SetSignalPolicy.
+func DefaultSignalPolicy(sig syscall.Signal) SignalPolicy {
+	switch sig {
+	// SIGURG is used by the go runtime for preemption and SIGPROF for profiling,
+	// and the others are notifications which programs handle as usual
+	case sys.SIGURG, sys.SIGPROF, sys.SIGALRM, sys.SIGVTALRM, sys.SIGCHLD, sys.SIGWINCH, sys.SIGIO:
+		return SignalPolicy{Pass: true}
+	// SIGTRAP is used by the debugger, and SIGINT sent to the process is taken as a request to stop it.
+	// Ctrl-C on the terminal doesn't reach the process because it runs in its own process group
+	case sys.SIGTRAP, sys.SIGINT:
+		return SignalPolicy{Stop: true, Print: true}
+	}
+
+	return SignalPolicy{Stop: true, Print: true, Pass: true}
+}
+
+// SignalPolicy returns how sig is handled.
+func (t *Target) SignalPolicy(sig syscall.Signal) SignalPolicy {
+	if policy, ok := t.signalPolicies[sig]; ok {
+		return policy
+	}
+
+	return DefaultSignalPolicy(sig)
+}
+
+// SetSignalPolicy changes how sig is handled. Stop implies Print.
+// Pass also applies to the signal which has stopped the process.
+func (t *Target) SetSignalPolicy(sig syscall.Signal, policy SignalPolicy) {
+	if policy.Stop {
+		policy.Print = true
+	}
+
+	t.signalPolicies[sig] = policy
+
+	if t.lastStop.Kind == StopSignal && t.lastStop.Signal == sig {
+		t.current.pendingSignal = 0
+		if policy.Pass {
+			t.current.pendingSignal = sig
+		}
+	}
+}
+
+// NotifySignals sets the function called when the process receives a signal which is printed but doesn't stop.
+func (t *Target) NotifySignals(notify func(sig syscall.Signal)) {
+	t.notifySignal = notify
+}
+
+// PendingSignal returns the signal which is delivered when the current thread is resumed next, or 0.
+func (t *Target) PendingSignal() syscall.Signal {
+	return t.current.pendingSignal
+}
+
+// SetPendingSignal replaces the signal which is delivered when the current thread is resumed next. 0 discards it.
+func (t *Target) SetPendingSignal(sig syscall.Signal) {
+	t.current.pendingSignal = sig
+}
+
+// receiveSignal applies the policy to the signal which stops th, and returns true if the caller must stop.
+func (t *Target) receiveSignal(th *Thread, sig syscall.Signal) bool {
+	policy := t.SignalPolicy(sig)
+
+	th.pendingSignal = 0
+	if policy.Pass {
+		th.pendingSignal = sig
+	}
+
+	if !policy.Stop && policy.Print && t.notifySignal != nil {
+		t.notifySignal(sig)
+	}
+
+	return policy.Stop
+}
+
+// runSignalHandler delivers the pending signal of th, and continues th until its handler returns to the current pc,
+// so that the handler is not stepped. ok is false if th stops at another place.
+func (t *Target) runSignalHandler(th *Thread) (reason StopReason, ok bool, err error) {
+	pc, err := th.PC()
+	if err != nil {
+		return StopReason{}, false, err
+	}
+
+	// the handler returns to pc by sigreturn
+	if err := t.SetBreakpoint(pc); err != nil {
+		return StopReason{}, false, err
+	}
+	defer t.RemoveBreakpoint(pc)
+
+	for {
+		if err := t.resumeThread(th, false, th.takePendingSignal()); err != nil {
+			return StopReason{}, false, err
+		}
+
+		_, reason, err := t.waitEvent()
+		if err != nil {
+			return StopReason{}, false, err
+		}
+
+		switch {
+		case reason.Kind == StopBreakpoint && reason.Addr == pc:
+			return reason, true, nil
+		case reason.Kind == StopSignal && !t.receiveSignal(th, reason.Signal):
+			continue
+		}
+
+		return reason, false, nil
+	}
+}
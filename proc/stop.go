@@ -0,0 +1,99 @@
+package proc
+
+import (
+	"fmt"
+	"syscall"
+
+	sys "golang.org/x/sys/unix"
+)
+
+// StopKind is why the process stops, or how it terminates.
+type StopKind int
+
+const (
+	// StopSignal means the process is stopped by a signal
+	StopSignal StopKind = iota
+	// StopBreakpoint means a breakpoint is hit
+	StopBreakpoint
+	// StopStep means a single step is done
+	StopStep
+	// StopWatchpoint means the memory watched by a watchpoint is accessed
+	StopWatchpoint
+	// StopExited means the process exits with status
+	StopExited
+	// StopKilled means the process is terminated by a signal
+	StopKilled
+	// StopInterrupted means the process is stopped by Interrupt
+	StopInterrupted
+	// StopThreadExited means the thread being stepped exits
+	StopThreadExited
+	// StopSyscall means a thread enters or exits a system call caught by CatchSyscalls
+	StopSyscall
+	// StopFork means a thread creates a child process by fork, vfork or clone without CLONE_THREAD
+	StopFork
+	// StopExec means the process executes a new program
+	StopExec
+)
+
+// StopReason is an event of the process which is returned when it stops or terminates.
+type StopReason struct {
+	Kind StopKind
+	// Signal stops or terminates the process
+	Signal syscall.Signal
+	// Addr is the address of the breakpoint
+	Addr uint64
+	// Watchpoint is the watchpoint which is hit
+	Watchpoint *Watchpoint
+	// Status is the exit status
+	Status int
+	// Thread is the id of the thread which exits
+	Thread int
+	// Syscall is the system call which is entered or exited
+	Syscall Syscall
+	// Child is the child process created by fork, which stops until it is resumed or detached
+	Child *Target
+}
+
+// Exited returns true if the process has terminated.
+func (r StopReason) Exited() bool {
+	return r.Kind == StopExited || r.Kind == StopKilled
+}
+
+func (r StopReason) String() string {
+	switch r.Kind {
+	case StopBreakpoint:
+		return fmt.Sprintf("breakpoint at 0x%x", r.Addr)
+	case StopStep:
+		return "step"
+	case StopWatchpoint:
+		return fmt.Sprintf("watchpoint at 0x%x", r.Watchpoint.addr)
+	case StopExited:
+		return fmt.Sprintf("exited with status %d", r.Status)
+	case StopKilled:
+		return fmt.Sprintf("killed by %s", signalName(r.Signal))
+	case StopInterrupted:
+		return "interrupted"
+	case StopThreadExited:
+		return fmt.Sprintf("thread %d exited", r.Thread)
+	case StopSyscall:
+		if r.Syscall.Exit {
+			return fmt.Sprintf("syscall %d returned %d", r.Syscall.Number, r.Syscall.Return)
+		}
+		return fmt.Sprintf("syscall %d entered", r.Syscall.Number)
+	case StopFork:
+		return fmt.Sprintf("forked process %d", r.Child.pid)
+	case StopExec:
+		return "executed a new program"
+	}
+
+	return fmt.Sprintf("stopped by %s", signalName(r.Signal))
+}
+
+// signalName returns the name of sig like SIGSEGV.
+func signalName(sig syscall.Signal) string {
+	if name := sys.SignalName(sig); name != "" {
+		return name
+	}
+
+	return sig.String()
+}
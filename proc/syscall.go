@@ -0,0 +1,76 @@
+package proc
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+
+	sys "golang.org/x/sys/unix"
+)
+
+// Syscall is a system call which a thread enters or exits. the number and arguments are of amd64.
+type Syscall struct {
+	Number int
+	// Args are rdi, rsi, rdx, r10, r8 and r9
+	Args [6]uint64
+	// Exit is true when the system call returns, and Return is the result, which is -errno on failure
+	Exit   bool
+	Return int64
+}
+
+// ptraceSyscallInfo is struct ptrace_syscall_info, and only op is used because registers have the rest.
+type ptraceSyscallInfo struct {
+	op   uint8
+	_    [3]uint8
+	arch uint32
+	ip   uint64
+	sp   uint64
+	// union of entry, exit and seccomp
+	_ [8]uint64
+}
+
+// CatchSyscalls makes Continue stop at entries and exits of system calls of numbers, or all system calls if numbers is empty.
+// threads are resumed by PTRACE_SYSCALL while system calls are caught.
+func (t *Target) CatchSyscalls(numbers []int) {
+	t.catchSyscalls = true
+	t.caughtSyscalls = make(map[int]bool)
+	for _, nr := range numbers {
+		t.caughtSyscalls[nr] = true
+	}
+}
+
+// StopCatchingSyscalls makes Continue ignore system calls.
+func (t *Target) StopCatchingSyscalls() {
+	t.catchSyscalls = false
+	t.caughtSyscalls = nil
+}
+
+// catchesSyscall returns true if Continue stops at the system call of nr.
+func (t *Target) catchesSyscall(nr int) bool {
+	return t.catchSyscalls && (len(t.caughtSyscalls) == 0 || t.caughtSyscalls[nr])
+}
+
+// syscallStop returns the system call which th enters or exits at the syscall-stop.
+func (t *Target) syscallStop(th *Thread) (StopReason, error) {
+	var info ptraceSyscallInfo
+	_, _, errno := syscall.Syscall6(uintptr(syscall.SYS_PTRACE), uintptr(sys.PTRACE_GET_SYSCALL_INFO), uintptr(th.tid), unsafe.Sizeof(info), uintptr(unsafe.Pointer(&info)), 0, 0)
+	if errno != 0 {
+		return StopReason{}, fmt.Errorf("failed to get syscall info of thread %d: %s", th.tid, sys.Errno(errno))
+	}
+
+	regs := &sys.PtraceRegs{}
+	if err := sys.PtraceGetRegs(th.tid, regs); err != nil {
+		return StopReason{}, fmt.Errorf("failed to get registers of thread %d: %s", th.tid, err)
+	}
+
+	sc := Syscall{
+		Number: int(regs.Orig_rax),
+		Args:   [6]uint64{regs.Rdi, regs.Rsi, regs.Rdx, regs.R10, regs.R8, regs.R9},
+	}
+	if info.op == sys.PTRACE_SYSCALL_INFO_EXIT {
+		sc.Exit = true
+		sc.Return = int64(regs.Rax)
+	}
+
+	return StopReason{Kind: StopSyscall, Signal: sys.SIGTRAP, Syscall: sc}, nil
+}
@@ -0,0 +1,526 @@
+// Package proc controls a process by ptrace, which is the core of the debugger.
+// it doesn't print anything, and errors and stops of the process are returned to the caller.
+package proc
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	sys "golang.org/x/sys/unix"
+)
+
+const (
+	// you can see signal code by "cat /usr/include/asm-generic/siginfo.h"
+	SignalCodeTrapBreakpoint = 1
+	SignalCodeTrapTrace      = 2
+	// when watchpoint is hit, TRAP_HWBKPT signal code is sent
+	SignalCodeTrapHWBreakpoint = 4
+
+	SignalCodeKernel = 0x80
+)
+
+// ErrExited is returned when the process is accessed after it terminates.
+var ErrExited = errors.New("process has exited")
+
+// Target is a process traced by the debugger. all threads of the process are traced,
+// and they stop together when one of them stops.
+// only the thread which starts tracing can send ptrace requests, so that Target must be used
+// on the goroutine which calls Launch or Attach, and the goroutine is locked to the thread.
+type Target struct {
+	pid int
+	// path of the executable
+	path string
+	// tracer is shared with the processes traced by the same thread
+	tracer *tracer
+	// true if the process is not started by the debugger
+	attached bool
+	// true if the process has terminated
+	exited bool
+
+	// threads by thread id, and the thread which stopped the process last time
+	threads map[int]*Thread
+	current *Thread
+	// true while all threads are resumed by Continue
+	allRunning bool
+	// interrupt is shared with the goroutine which calls Interrupt
+	interrupt struct {
+		mu sync.Mutex
+		// true while the process is resumed, and tid is the thread which Interrupt stops
+		running bool
+		tid     int
+		// true if SIGSTOP is sent to the thread of sentTid, and it is not received yet
+		sent    bool
+		sentTid int
+	}
+
+	breakpoints map[uint64]*Breakpoint
+	// breakpoints removed while a vfork child shares memory
+	suspendedBreakpoints []*Breakpoint
+	// hardware watchpoints for debug registers DR0-DR3
+	watchpoints [numWatchpoints]*Watchpoint
+	// why the process stopped last time
+	lastStop StopReason
+
+	// policies of signals changed from DefaultSignalPolicy
+	signalPolicies map[syscall.Signal]SignalPolicy
+	// called when a signal is received without stopping
+	notifySignal func(sig syscall.Signal)
+
+	// true if Continue stops at system calls, and numbers of them or empty for all system calls
+	catchSyscalls  bool
+	caughtSyscalls map[int]bool
+}
+
+// Launch starts the executable at path with args, and returns after it stops at the first instruction.
+// address space layout randomization is disabled unless aslr is true.
+func Launch(path string, args []string, aslr bool) (*Target, error) {
+	// lock os thread prevent go runtime changes thread id
+	runtime.LockOSThread()
+
+	cmd := exec.Command(path, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	// the process group is separated, so that Ctrl-C on the terminal is sent only to the debugger
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Ptrace:  true,
+		Setpgid: true,
+	}
+
+	// set personality not to randomize address
+	// this code is based on delve(https://github.com/go-delve/delve/tree/v1.22.1).
+	// Copyright (c) 2014 Derek Parker
+	// MIT LICENSE: https://github.com/go-delve/delve/blob/v1.22.1/LICENSE
+	var personalityGetPersonality uintptr = 0xffffffff // argument to pass to personality syscall to get the current personality
+	var _ADDR_NO_RANDOMIZE uintptr = 0x0040000         // ADDR_NO_RANDOMIZE linux constant
+
+	oldPersonality, _, err := syscall.Syscall(sys.SYS_PERSONALITY, personalityGetPersonality, 0, 0)
+	if err == syscall.Errno(0) && !aslr {
+		newPersonality := oldPersonality | _ADDR_NO_RANDOMIZE
+		syscall.Syscall(sys.SYS_PERSONALITY, newPersonality, 0, 0)
+		defer syscall.Syscall(sys.SYS_PERSONALITY, oldPersonality, 0, 0)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start %s: %s", path, err)
+	}
+
+	t := newTarget(cmd.Process.Pid, path, newTracer())
+
+	// the process stops by SIGTRAP after exec
+	var ws sys.WaitStatus
+	if _, err := sys.Wait4(t.pid, &ws, sys.WALL, nil); err != nil {
+		return nil, fmt.Errorf("failed to wait pid %d: %s", t.pid, err)
+	}
+	if !ws.Stopped() {
+		return nil, fmt.Errorf("process %d %s", t.pid, exitReason(ws))
+	}
+
+	// threads created by the only thread inherit the options
+	if err := sys.PtraceSetOptions(t.pid, ptraceOptions); err != nil {
+		return nil, fmt.Errorf("failed to set ptrace options of pid %d: %s", t.pid, err)
+	}
+
+	t.threads[t.pid] = t.current
+	return t, nil
+}
+
+// Attach attaches to all threads of the running process of pid, and returns after they stop.
+func Attach(pid int) (*Target, error) {
+	// lock os thread because only the thread which attaches can trace the process
+	runtime.LockOSThread()
+
+	path, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid))
+	if err != nil {
+		return nil, err
+	}
+
+	t := newTarget(pid, path, newTracer())
+	t.attached = true
+
+	if err := t.attachThreads(); err != nil {
+		return nil, err
+	}
+
+	t.current = t.anyThread()
+
+	return t, nil
+}
+
+func newTarget(pid int, path string, tr *tracer) *Target {
+	t := &Target{
+		pid:            pid,
+		path:           path,
+		tracer:         tr,
+		threads:        make(map[int]*Thread),
+		current:        &Thread{tid: pid},
+		breakpoints:    make(map[uint64]*Breakpoint),
+		signalPolicies: make(map[syscall.Signal]SignalPolicy),
+	}
+
+	tr.add(t)
+	return t
+}
+
+func (t *Target) Pid() int {
+	return t.pid
+}
+
+// Path returns the path of the executable.
+func (t *Target) Path() string {
+	return t.path
+}
+
+// Attached returns true if the process is not started by Launch.
+func (t *Target) Attached() bool {
+	return t.attached
+}
+
+// Exited returns true if the process has terminated.
+func (t *Target) Exited() bool {
+	return t.exited
+}
+
+// LastStop returns why the process stopped last time.
+func (t *Target) LastStop() StopReason {
+	return t.lastStop
+}
+
+// PC returns the program counter of the current thread.
+func (t *Target) PC() (uint64, error) {
+	if t.exited {
+		return 0, ErrExited
+	}
+
+	return t.current.PC()
+}
+
+// SetPC changes the program counter of the current thread.
+func (t *Target) SetPC(pc uint64) error {
+	if t.exited {
+		return ErrExited
+	}
+
+	return t.current.setPC(pc)
+}
+
+// stopReason returns why th stops by ws. when a breakpoint is hit, pc is moved back to the address of the breakpoint.
+func (t *Target) stopReason(th *Thread, ws sys.WaitStatus) (StopReason, error) {
+	sig := ws.StopSignal()
+	// PTRACE_O_TRACESYSGOOD sets 0x80 to SIGTRAP of syscall-stops
+	if sig == sys.SIGTRAP|0x80 {
+		return t.syscallStop(th)
+	}
+	if sig != sys.SIGTRAP {
+		return StopReason{Kind: StopSignal, Signal: sig}, nil
+	}
+
+	var sigInfo sys.Siginfo
+	_, _, errno := syscall.Syscall6(uintptr(syscall.SYS_PTRACE), uintptr(sys.PTRACE_GETSIGINFO), uintptr(th.tid), 0, uintptr(unsafe.Pointer(&sigInfo)), 0, 0)
+	if errno != 0 {
+		return StopReason{}, fmt.Errorf("failed to get siginfo: %s", sys.Errno(errno))
+	}
+
+	switch sigInfo.Code {
+	case SignalCodeTrapTrace, SignalCodeTrapHWBreakpoint:
+		// single step sets TRAP_TRACE even if a watchpoint is hit in the step
+		wp, err := t.hitWatchpoint(th)
+		if err != nil {
+			return StopReason{}, err
+		}
+		if wp != nil {
+			return StopReason{Kind: StopWatchpoint, Signal: sig, Watchpoint: wp}, nil
+		}
+		return StopReason{Kind: StopStep, Signal: sig}, nil
+	case SignalCodeTrapBreakpoint, SignalCodeKernel:
+		// When breakpoint is hit, SI_KERNEL or TRAP_BRKPT signal code is sent
+		pc, err := th.PC()
+		if err != nil {
+			return StopReason{}, err
+		}
+
+		// int3 which is not set by the debugger (e.g. runtime.breakpoint) is reported as a signal
+		if _, ok := t.enabledBreakpoint(pc - 1); !ok {
+			return StopReason{Kind: StopSignal, Signal: sig}, nil
+		}
+
+		// when INT3 instruction is executed, pc is icremented 1.
+		if err := th.setPC(pc - 1); err != nil {
+			return StopReason{}, err
+		}
+		return StopReason{Kind: StopBreakpoint, Signal: sig, Addr: pc - 1}, nil
+	}
+
+	return StopReason{Kind: StopSignal, Signal: sig}, nil
+}
+
+// Continue resumes all threads until one of them stops by a breakpoint, a watchpoint, a signal or a caught system call, or the process terminates.
+// pending signals are delivered, and signals which don't stop by the policy are handled without returning.
+func (t *Target) Continue() (StopReason, error) {
+	if t.exited {
+		return StopReason{}, ErrExited
+	}
+
+	// events received while the threads stopped last time are reported first
+	if th, reason, ok := t.savedEvent(); ok {
+		return t.stopAt(th, reason)
+	}
+
+	current := t.current
+	reason, stepped, err := t.stepOverBreakpoint(current)
+	if err != nil {
+		return StopReason{}, err
+	}
+	if stepped && reason.Kind != StopStep {
+		return t.stopAt(current, reason)
+	}
+
+	// if breakpoint is hit after step over breakpoint, it doesn't exec ptrace cont
+	pc, err := current.PC()
+	if err != nil {
+		return StopReason{}, err
+	}
+	if _, ok := t.enabledBreakpoint(pc); ok {
+		return t.stopAt(current, StopReason{Kind: StopBreakpoint, Signal: sys.SIGTRAP, Addr: pc})
+	}
+
+	// the other threads which have reported breakpoints execute the original instructions too
+	for _, th := range t.Threads() {
+		if th == current || !th.atBreakpoint {
+			continue
+		}
+
+		reason, stepped, err := t.stepOverBreakpoint(th)
+		if err != nil {
+			return StopReason{}, err
+		}
+		if stepped && reason.Kind != StopStep {
+			return t.stopAt(th, reason)
+		}
+	}
+
+	t.setRunning(current.tid)
+	t.allRunning = true
+	for _, th := range t.Threads() {
+		if th.running {
+			continue
+		}
+		if err := t.resumeThread(th, false, th.takePendingSignal()); err != nil {
+			return StopReason{}, err
+		}
+	}
+
+	for {
+		th, reason, err := t.waitEvent()
+		if err != nil {
+			return StopReason{}, err
+		}
+
+		if reason.Kind == StopSignal && !t.receiveSignal(th, reason.Signal) {
+			if err := t.resumeThread(th, false, th.takePendingSignal()); err != nil {
+				return StopReason{}, err
+			}
+			continue
+		}
+
+		return t.stopAt(th, reason)
+	}
+}
+
+// StepInstruction executes one instruction of the current thread while the other threads stop.
+// the pending signal is delivered, so that the step enters its handler.
+// handlers of signals which are received during the step and don't stop run before the step is retried.
+func (t *Target) StepInstruction() (StopReason, error) {
+	if t.exited {
+		return StopReason{}, ErrExited
+	}
+
+	th := t.current
+	for {
+		reason, stepped, err := t.stepOverBreakpoint(th)
+		if err != nil {
+			return StopReason{}, err
+		}
+		if stepped {
+			return t.stopAt(th, reason)
+		}
+
+		t.setRunning(th.tid)
+		if err := t.resumeThread(th, true, th.takePendingSignal()); err != nil {
+			return StopReason{}, err
+		}
+
+		_, reason, err = t.waitEvent()
+		if err != nil {
+			return StopReason{}, err
+		}
+
+		// the kernel reports the step over SYSCALL instruction by TRAP_BRKPT
+		if reason.Kind == StopSignal && reason.Signal == sys.SIGTRAP {
+			reason = StopReason{Kind: StopStep, Signal: sys.SIGTRAP}
+		}
+
+		if reason.Kind != StopSignal || t.receiveSignal(th, reason.Signal) {
+			return t.stopAt(th, reason)
+		}
+
+		if th.pendingSignal != 0 {
+			reason, ok, err := t.runSignalHandler(th)
+			if err != nil {
+				return StopReason{}, err
+			}
+			if !ok {
+				return t.stopAt(th, reason)
+			}
+		}
+	}
+}
+
+// stepOverBreakpoint executes the original instruction of the breakpoint at pc of th while the other threads stop.
+// stepped is false if no breakpoint is at pc.
+func (t *Target) stepOverBreakpoint(th *Thread) (reason StopReason, stepped bool, err error) {
+	pc, err := th.PC()
+	if err != nil {
+		return StopReason{}, false, err
+	}
+
+	bp, ok := t.enabledBreakpoint(pc)
+	if !ok {
+		return StopReason{}, false, nil
+	}
+
+	// handle breakpoint from here
+	if err := bp.Disable(); err != nil {
+		return StopReason{}, false, err
+	}
+
+	t.setRunning(th.tid)
+	sig := 0
+	for {
+		if err := t.resumeThread(th, true, sig); err != nil {
+			return StopReason{}, false, err
+		}
+
+		_, reason, err = t.waitEvent()
+		if err != nil {
+			return StopReason{}, false, err
+		}
+		if reason.Exited() {
+			return reason, true, nil
+		}
+
+		sig = 0
+		if reason.Kind != StopSignal || reason.Signal == sys.SIGTRAP || t.receiveSignal(th, reason.Signal) {
+			break
+		}
+
+		// the instruction faults again unless the signal is delivered, and the others are delivered after the step
+		switch reason.Signal {
+		case sys.SIGILL, sys.SIGBUS, sys.SIGFPE, sys.SIGSEGV, sys.SIGSTKFLT:
+			sig = th.takePendingSignal()
+		}
+	}
+
+	if err := bp.Enable(); err != nil {
+		return StopReason{}, false, err
+	}
+
+	return reason, true, nil
+}
+
+// Detach removes breakpoints and watchpoints, and detaches from all threads. pending signals are delivered.
+// methods which access the process return ErrExited after detaching.
+func (t *Target) Detach() error {
+	if t.exited {
+		return nil
+	}
+
+	for _, bp := range t.breakpoints {
+		if err := bp.Disable(); err != nil {
+			return err
+		}
+	}
+	t.breakpoints = make(map[uint64]*Breakpoint)
+	t.suspendedBreakpoints = nil
+
+	// SIGSTOP sent by the debugger must not stop the process after detaching
+	for _, th := range t.threads {
+		if th.stopping && !th.running {
+			if err := t.resumeThread(th, false, 0); err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := t.waitThreads(); err != nil {
+		return err
+	}
+
+	for _, th := range t.Threads() {
+		if th.event != nil && th.event.Kind == StopSignal {
+			t.receiveSignal(th, th.event.Signal)
+		}
+		// the child which is not reported yet is not traced either
+		if th.event != nil && th.event.Kind == StopFork {
+			if err := th.event.Child.Detach(); err != nil {
+				return err
+			}
+		}
+
+		if err := t.setDebugRegister(th, debugControlRegister, 0); err != nil {
+			return err
+		}
+
+		if err := ptraceDetach(th.tid, th.takePendingSignal()); err != nil && !errors.Is(err, sys.ESRCH) {
+			return fmt.Errorf("failed to detach from thread %d: %s", th.tid, err)
+		}
+	}
+
+	// the process is not accessed after detaching
+	t.untrace()
+	t.exited = true
+	t.threads = make(map[int]*Thread)
+	return nil
+}
+
+// Kill kills the process and waits until it terminates.
+func (t *Target) Kill() error {
+	if t.exited {
+		return nil
+	}
+
+	if err := sys.Kill(t.pid, sys.SIGKILL); err != nil {
+		return fmt.Errorf("failed to kill pid %d: %s", t.pid, err)
+	}
+
+	for _, th := range t.threads {
+		if th.event != nil && th.event.Kind == StopFork {
+			th.event.Child.Kill()
+		}
+	}
+
+	// the main thread is reported after the other threads
+	for !t.exited {
+		th, ws, err := t.wait()
+		if err != nil {
+			return err
+		}
+
+		if ws.Exited() || ws.Signaled() {
+			delete(t.threads, th.tid)
+			if th.tid == t.pid {
+				t.exited = true
+				t.lastStop = exitReason(ws)
+			}
+		}
+	}
+
+	t.untrace()
+	return nil
+}
@@ -0,0 +1,87 @@
+package proc
+
+import (
+	"debug/elf"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// buildFixture builds the program in testdata/name, and returns the path of the executable.
+func buildFixture(t *testing.T, name string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	out, err := exec.Command("go", "build", "-o", path, filepath.Join("testdata", name, "main.go")).CombinedOutput()
+	if err != nil {
+		t.Fatalf("failed to build %s: %s\n%s", name, err, out)
+	}
+
+	return path
+}
+
+// symbolAddress returns the address of the symbol in the executable at path.
+func symbolAddress(t *testing.T, path string, name string) uint64 {
+	t.Helper()
+
+	f, err := elf.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open %s: %s", path, err)
+	}
+	defer f.Close()
+
+	symbols, err := f.Symbols()
+	if err != nil {
+		t.Fatalf("failed to read symbols of %s: %s", path, err)
+	}
+	for _, s := range symbols {
+		if s.Name == name {
+			return s.Value
+		}
+	}
+
+	t.Fatalf("symbol %s is not found in %s", name, path)
+	return 0
+}
+
+func TestContinueToBreakpointAndExit(t *testing.T) {
+	path := buildFixture(t, "exit")
+	addr := symbolAddress(t, path, "main.main")
+
+	target, err := Launch(path, nil, false)
+	if err != nil {
+		t.Fatalf("failed to launch: %s", err)
+	}
+	defer target.Kill()
+
+	if err := target.SetUserBreakpoint(addr); err != nil {
+		t.Fatalf("failed to set breakpoint: %s", err)
+	}
+
+	reason, err := target.Continue()
+	if err != nil {
+		t.Fatalf("failed to continue: %s", err)
+	}
+	if reason.Kind != StopBreakpoint || reason.Addr != addr {
+		t.Fatalf("expected breakpoint at 0x%x, but got %s", addr, reason)
+	}
+
+	pc, err := target.PC()
+	if err != nil {
+		t.Fatalf("failed to read pc: %s", err)
+	}
+	if pc != addr {
+		t.Errorf("expected pc 0x%x, but got 0x%x", addr, pc)
+	}
+
+	reason, err = target.Continue()
+	if err != nil {
+		t.Fatalf("failed to continue: %s", err)
+	}
+	if reason.Kind != StopExited || reason.Status != 3 {
+		t.Fatalf("expected exit status 3, but got %s", reason)
+	}
+	if !target.Exited() {
+		t.Errorf("expected the target to be exited")
+	}
+}
@@ -0,0 +1,527 @@
+package proc
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"syscall"
+
+	sys "golang.org/x/sys/unix"
+)
+
+// new threads are traced automatically, so that all threads stop at breakpoints.
+// syscall-stops are distinguished from SIGTRAP by TRACESYSGOOD.
+// child processes and programs executed by exec are reported, so that the caller can follow them.
+const ptraceOptions = sys.PTRACE_O_TRACECLONE | sys.PTRACE_O_TRACESYSGOOD |
+	sys.PTRACE_O_TRACEFORK | sys.PTRACE_O_TRACEVFORK | sys.PTRACE_O_TRACEVFORKDONE | sys.PTRACE_O_TRACEEXEC
+
+// Thread is a thread of the process. the debugger stops all threads when one of them stops.
+type Thread struct {
+	tid int
+	// true while the thread is resumed and its stop is not received yet
+	running bool
+	// true while the thread is single stepped
+	stepping bool
+	// true if SIGSTOP is sent to stop the thread, and it is not received yet
+	stopping bool
+	// true until the initial stop of a new thread is received
+	new bool
+	// true if the breakpoint at pc has been reported, so that it is stepped over when the thread is resumed
+	atBreakpoint bool
+	// event received while the other thread stops the process, which is handled when it is resumed next
+	event *StopReason
+	// signal which is delivered when the thread is resumed next
+	pendingSignal syscall.Signal
+}
+
+// Tid returns the thread id.
+func (th *Thread) Tid() int {
+	return th.tid
+}
+
+// PC returns the program counter of the thread.
+func (th *Thread) PC() (uint64, error) {
+	regs := &sys.PtraceRegs{}
+	if err := sys.PtraceGetRegs(th.tid, regs); err != nil {
+		return 0, fmt.Errorf("failed to get pc of thread %d: %s", th.tid, err)
+	}
+
+	return regs.Rip, nil
+}
+
+func (th *Thread) setPC(pc uint64) error {
+	regs := &sys.PtraceRegs{}
+	if err := sys.PtraceGetRegs(th.tid, regs); err != nil {
+		return fmt.Errorf("failed to get registers of thread %d: %s", th.tid, err)
+	}
+
+	regs.Rip = pc
+	if err := sys.PtraceSetRegs(th.tid, regs); err != nil {
+		return fmt.Errorf("failed to set pc of thread %d: %s", th.tid, err)
+	}
+
+	return nil
+}
+
+// takePendingSignal returns the pending signal and clears it.
+func (th *Thread) takePendingSignal() int {
+	sig := th.pendingSignal
+	th.pendingSignal = 0
+	return int(sig)
+}
+
+// Tid returns id of the current thread, whose registers are accessed. it is the thread which stopped the process last time.
+func (t *Target) Tid() int {
+	return t.current.tid
+}
+
+// Threads returns threads of the process in the order of ids.
+func (t *Target) Threads() []*Thread {
+	threads := make([]*Thread, 0, len(t.threads))
+	for _, th := range t.threads {
+		threads = append(threads, th)
+	}
+
+	slices.SortFunc(threads, func(a, b *Thread) int { return a.tid - b.tid })
+	return threads
+}
+
+// Interrupt stops the process resumed by Continue or StepInstruction, and they return StopInterrupted.
+// it can be called on any goroutine, and does nothing unless the process is running.
+func (t *Target) Interrupt() error {
+	t.interrupt.mu.Lock()
+	defer t.interrupt.mu.Unlock()
+
+	if !t.interrupt.running || t.interrupt.sent {
+		return nil
+	}
+
+	if err := sys.Tgkill(t.pid, t.interrupt.tid, sys.SIGSTOP); err != nil {
+		return fmt.Errorf("failed to interrupt pid %d: %s", t.pid, err)
+	}
+
+	t.interrupt.sent = true
+	t.interrupt.sentTid = t.interrupt.tid
+	return nil
+}
+
+// setRunning allows Interrupt to stop the process by the thread of tid until the process stops.
+func (t *Target) setRunning(tid int) {
+	t.interrupt.mu.Lock()
+	defer t.interrupt.mu.Unlock()
+
+	t.interrupt.running = true
+	t.interrupt.tid = tid
+}
+
+// takeInterrupt returns true if SIGSTOP received by the thread of tid is sent by Interrupt.
+func (t *Target) takeInterrupt(tid int) bool {
+	t.interrupt.mu.Lock()
+	defer t.interrupt.mu.Unlock()
+
+	if !t.interrupt.sent || t.interrupt.sentTid != tid {
+		return false
+	}
+
+	t.interrupt.sent = false
+	return true
+}
+
+// resumeThread resumes th by PTRACE_CONT, or PTRACE_SINGLESTEP if step is true, with sig.
+// PTRACE_SYSCALL is used instead of PTRACE_CONT while system calls are caught.
+func (t *Target) resumeThread(th *Thread, step bool, sig int) error {
+	var err error
+	switch {
+	case step:
+		err = ptraceSingleStep(th.tid, sig)
+	case t.catchSyscalls:
+		err = syscall.PtraceSyscall(th.tid, sig)
+	default:
+		err = syscall.PtraceCont(th.tid, sig)
+	}
+	// the thread killed while it stops reports its exit later
+	if err != nil && !errors.Is(err, sys.ESRCH) {
+		return fmt.Errorf("failed to resume thread %d: %s", th.tid, err)
+	}
+
+	th.running = true
+	th.stepping = step
+	th.atBreakpoint = false
+	return nil
+}
+
+// wait waits until a thread changes its state. a thread which is not known yet is a new thread
+// whose initial stop is received before its parent reports the clone.
+// statuses of threads of the other processes are kept until they wait.
+func (t *Target) wait() (*Thread, sys.WaitStatus, error) {
+	for {
+		tid, ws, ok := t.tracer.takePendingStatus(t)
+		if !ok {
+			var err error
+			// children of the other threads are waited by the threads tracing them
+			tid, err = sys.Wait4(-1, &ws, sys.WALL|sys.WNOTHREAD, nil)
+			if errors.Is(err, sys.EINTR) {
+				continue
+			}
+			if err != nil {
+				return nil, 0, fmt.Errorf("failed to wait pid %d: %s", t.pid, err)
+			}
+		}
+
+		th, ok := t.threads[tid]
+		if !ok {
+			if t.tracer.keepStatus(t, tid, ws) {
+				continue
+			}
+			if !ws.Stopped() {
+				continue
+			}
+			th = &Thread{tid: tid, running: true, stopping: true, new: true}
+			t.threads[tid] = th
+		}
+
+		return th, ws, nil
+	}
+}
+
+// waitEvent waits until a thread stops by an event which the caller handles, or the process terminates.
+// new threads and exits of threads are handled here, and new threads run only if all threads are running.
+func (t *Target) waitEvent() (*Thread, StopReason, error) {
+	for {
+		th, ws, err := t.wait()
+		if err != nil {
+			return nil, StopReason{}, err
+		}
+
+		if ws.Exited() || ws.Signaled() {
+			delete(t.threads, th.tid)
+			if th.tid == t.pid {
+				return nil, exitReason(ws), nil
+			}
+			if th.stepping {
+				return nil, StopReason{Kind: StopThreadExited, Thread: th.tid}, nil
+			}
+			continue
+		}
+		if !ws.Stopped() {
+			return nil, StopReason{}, fmt.Errorf("unexpected wait status 0x%x of thread %d", uint32(ws), th.tid)
+		}
+
+		th.running = false
+		if ws.TrapCause() == sys.PTRACE_EVENT_CLONE {
+			if err := t.addClone(th); err != nil {
+				return nil, StopReason{}, err
+			}
+			if err := t.resumeThread(th, th.stepping, 0); err != nil {
+				return nil, StopReason{}, err
+			}
+			continue
+		}
+		if isProcessEvent(ws) {
+			reason, err := t.processEvent(th, ws)
+			if err != nil {
+				return nil, StopReason{}, err
+			}
+			if reason == nil {
+				if err := t.resumeThread(th, th.stepping, 0); err != nil {
+					return nil, StopReason{}, err
+				}
+				continue
+			}
+			// the thread which executes a program becomes the main thread
+			if reason.Kind == StopExec {
+				th = t.current
+			}
+			return th, *reason, nil
+		}
+
+		if ws.StopSignal() == sys.SIGSTOP {
+			if t.takeInterrupt(th.tid) {
+				th.stopping = false
+				return th, StopReason{Kind: StopInterrupted, Signal: sys.SIGSTOP}, nil
+			}
+			if th.stopping {
+				if err := t.initThread(th); err != nil {
+					return nil, StopReason{}, err
+				}
+				if t.allRunning {
+					if err := t.resumeThread(th, false, 0); err != nil {
+						return nil, StopReason{}, err
+					}
+				}
+				continue
+			}
+		}
+
+		reason, err := t.stopReason(th, ws)
+		if err != nil {
+			return nil, StopReason{}, err
+		}
+
+		// system calls which are not caught are not reported
+		if reason.Kind == StopSyscall && !t.catchesSyscall(reason.Syscall.Number) {
+			if err := t.resumeThread(th, false, 0); err != nil {
+				return nil, StopReason{}, err
+			}
+			continue
+		}
+
+		return th, reason, nil
+	}
+}
+
+// addClone adds the thread created by th, which is reported by PTRACE_EVENT_CLONE.
+func (t *Target) addClone(th *Thread) error {
+	msg, err := sys.PtraceGetEventMsg(th.tid)
+	if err != nil {
+		return fmt.Errorf("failed to get new thread of thread %d: %s", th.tid, err)
+	}
+
+	// the new thread may have stopped already
+	if _, ok := t.threads[int(msg)]; !ok {
+		t.threads[int(msg)] = &Thread{tid: int(msg), running: true, stopping: true, new: true}
+	}
+
+	return nil
+}
+
+// initThread handles the initial SIGSTOP of a new thread or SIGSTOP sent to stop th.
+// watchpoints are set to new threads because debug registers are not inherited.
+func (t *Target) initThread(th *Thread) error {
+	th.stopping = false
+	if !th.new {
+		return nil
+	}
+
+	th.new = false
+	return t.setDebugRegisters(th)
+}
+
+// stopAt makes th the current thread, stops the other threads, and returns reason as the last stop.
+// th is nil if the thread of the event has exited.
+func (t *Target) stopAt(th *Thread, reason StopReason) (StopReason, error) {
+	if !reason.Exited() {
+		exit, err := t.stopThreads()
+		if err != nil {
+			return StopReason{}, err
+		}
+		if exit != nil {
+			reason = *exit
+		}
+	}
+
+	if reason.Exited() {
+		t.interrupt.mu.Lock()
+		t.interrupt.running, t.interrupt.sent = false, false
+		t.interrupt.mu.Unlock()
+
+		t.exited = true
+		t.allRunning = false
+		t.untrace()
+		t.threads = make(map[int]*Thread)
+		t.lastStop = reason
+		return reason, nil
+	}
+
+	if th == nil || t.threads[th.tid] != th {
+		th = t.current
+	}
+	if t.threads[th.tid] != th {
+		th = t.anyThread()
+	}
+	t.current = th
+
+	if reason.Kind == StopBreakpoint {
+		t.current.atBreakpoint = true
+	}
+
+	t.lastStop = reason
+	return reason, nil
+}
+
+// stopThreads sends SIGSTOP to running threads, and waits until they stop. SIGSTOP sent by Interrupt
+// which is not received yet is also received, so that it doesn't stop the process later.
+// it returns the exit reason if the process terminates meanwhile.
+func (t *Target) stopThreads() (*StopReason, error) {
+	t.interrupt.mu.Lock()
+	t.interrupt.running = false
+	sent, sentTid := t.interrupt.sent, t.interrupt.sentTid
+	t.interrupt.sent = false
+	t.interrupt.mu.Unlock()
+	t.allRunning = false
+
+	if th, ok := t.threads[sentTid]; sent && ok && !th.stopping {
+		th.stopping = true
+		if !th.running {
+			if err := t.resumeThread(th, false, 0); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, th := range t.threads {
+		if !th.running || th.stopping {
+			continue
+		}
+		if err := sys.Tgkill(t.pid, th.tid, sys.SIGSTOP); err != nil && !errors.Is(err, sys.ESRCH) {
+			return nil, fmt.Errorf("failed to stop thread %d: %s", th.tid, err)
+		}
+		th.stopping = true
+	}
+
+	return t.waitThreads()
+}
+
+// waitThreads waits until running threads stop. their events except SIGSTOP to stop them are saved to be handled later.
+func (t *Target) waitThreads() (*StopReason, error) {
+	for slices.ContainsFunc(t.Threads(), func(th *Thread) bool { return th.running }) {
+		th, ws, err := t.wait()
+		if err != nil {
+			return nil, err
+		}
+
+		if ws.Exited() || ws.Signaled() {
+			delete(t.threads, th.tid)
+			if th.tid == t.pid {
+				reason := exitReason(ws)
+				return &reason, nil
+			}
+			continue
+		}
+
+		th.running = false
+		switch {
+		case ws.TrapCause() == sys.PTRACE_EVENT_CLONE:
+			// the parent stops at the clone event until it is resumed
+			if err := t.addClone(th); err != nil {
+				return nil, err
+			}
+		case isProcessEvent(ws):
+			reason, err := t.processEvent(th, ws)
+			if err != nil {
+				return nil, err
+			}
+			if reason != nil {
+				if reason.Kind == StopExec {
+					th = t.current
+				}
+				th.event = reason
+			}
+		case ws.StopSignal() == sys.SIGSTOP && th.stopping:
+			if err := t.initThread(th); err != nil {
+				return nil, err
+			}
+		default:
+			// a breakpoint which is hit is reported again unless it is removed, because pc is moved back to it
+			reason, err := t.stopReason(th, ws)
+			if err != nil {
+				return nil, err
+			}
+			th.event = &reason
+		}
+	}
+
+	return nil, nil
+}
+
+// savedEvent returns an event saved while the threads stopped last time, which is reported without resuming the process.
+// signals which don't stop are delivered when the thread is resumed.
+func (t *Target) savedEvent() (*Thread, StopReason, bool) {
+	for _, th := range t.Threads() {
+		if th.event == nil {
+			continue
+		}
+
+		reason := *th.event
+		th.event = nil
+
+		switch {
+		case reason.Kind == StopBreakpoint:
+			if _, ok := t.enabledBreakpoint(reason.Addr); !ok {
+				continue
+			}
+		case reason.Kind == StopSignal && !t.receiveSignal(th, reason.Signal):
+			continue
+		case reason.Kind == StopSyscall && !t.catchesSyscall(reason.Syscall.Number):
+			continue
+		}
+
+		return th, reason, true
+	}
+
+	return nil, StopReason{}, false
+}
+
+// anyThread returns the main thread, or another thread if it has exited.
+func (t *Target) anyThread() *Thread {
+	if th, ok := t.threads[t.pid]; ok {
+		return th
+	}
+
+	for _, th := range t.Threads() {
+		return th
+	}
+
+	return &Thread{tid: t.pid}
+}
+
+// attachThreads attaches to all threads of the process. threads created meanwhile are found by listing threads again.
+func (t *Target) attachThreads() error {
+	for {
+		entries, err := os.ReadDir(fmt.Sprintf("/proc/%d/task", t.pid))
+		if err != nil {
+			return fmt.Errorf("failed to list threads of pid %d: %s", t.pid, err)
+		}
+
+		attached := false
+		for _, e := range entries {
+			tid, err := strconv.Atoi(e.Name())
+			if err != nil {
+				continue
+			}
+			if _, ok := t.threads[tid]; ok {
+				continue
+			}
+
+			if err := sys.PtraceAttach(tid); err != nil {
+				// the thread has exited
+				if tid != t.pid {
+					continue
+				}
+				return fmt.Errorf("failed to attach to process %d: %s", t.pid, err)
+			}
+
+			// the thread stops by SIGSTOP of PTRACE_ATTACH
+			t.threads[tid] = &Thread{tid: tid, running: true, stopping: true}
+			attached = true
+		}
+
+		if !attached {
+			return nil
+		}
+
+		exit, err := t.waitThreads()
+		if err != nil {
+			return err
+		}
+		if exit != nil {
+			return fmt.Errorf("process %d has exited", t.pid)
+		}
+
+		for _, th := range t.threads {
+			if err := sys.PtraceSetOptions(th.tid, ptraceOptions); err != nil {
+				return fmt.Errorf("failed to set ptrace options of thread %d: %s", th.tid, err)
+			}
+		}
+	}
+}
+
+func exitReason(ws sys.WaitStatus) StopReason {
+	if ws.Signaled() {
+		return StopReason{Kind: StopKilled, Signal: ws.Signal()}
+	}
+
+	return StopReason{Kind: StopExited, Status: ws.ExitStatus()}
+}
@@ -0,0 +1,168 @@
+package proc
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	sys "golang.org/x/sys/unix"
+)
+
+const (
+	// offset of u_debugreg in struct user for amd64, which is defined in sys/user.h
+	debugRegisterOffset = 848
+	// DR0-DR3 hold addresses of watchpoints
+	numWatchpoints = 4
+	// DR6 has bits of watchpoints which are hit, and DR7 enables watchpoints
+	debugStatusRegister  = 6
+	debugControlRegister = 7
+)
+
+type WatchpointKind int
+
+const (
+	// WatchWrite stops when the memory is written
+	WatchWrite WatchpointKind = iota
+	// WatchAccess stops when the memory is read or written
+	WatchAccess
+)
+
+// Watchpoint is a hardware watchpoint by debug registers, which watches all threads.
+type Watchpoint struct {
+	addr uint64
+	size int
+	kind WatchpointKind
+}
+
+// SetWatchpoint sets watchpoint on size bytes at addr to all threads. size must be 1, 2, 4 or 8, and addr must be aligned to size.
+// @see Intel SDM Vol.3 18.2 Debug Registers
+func (t *Target) SetWatchpoint(addr uint64, size int, kind WatchpointKind) error {
+	if t.exited {
+		return ErrExited
+	}
+
+	if _, ok := watchpointLengths[size]; !ok {
+		return fmt.Errorf("watchpoint size must be 1, 2, 4 or 8, but got %d", size)
+	}
+	if addr%uint64(size) != 0 {
+		return fmt.Errorf("address 0x%x is not aligned to %d bytes", addr, size)
+	}
+
+	slot := -1
+	for i, wp := range t.watchpoints {
+		if wp == nil {
+			slot = i
+			break
+		}
+	}
+	if slot < 0 {
+		return fmt.Errorf("no debug register is available, up to %d watchpoints can be set", numWatchpoints)
+	}
+
+	t.watchpoints[slot] = &Watchpoint{addr: addr, size: size, kind: kind}
+	for _, th := range t.Threads() {
+		if err := t.setDebugRegisters(th); err != nil {
+			t.watchpoints[slot] = nil
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (t *Target) ClearWatchpoint(addr uint64, size int, kind WatchpointKind) error {
+	for i, wp := range t.watchpoints {
+		if wp == nil || wp.addr != addr || wp.size != size || wp.kind != kind {
+			continue
+		}
+
+		t.watchpoints[i] = nil
+		for _, th := range t.Threads() {
+			if err := t.setDebugRegisters(th); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return fmt.Errorf("watchpoint at 0x%x is not found", addr)
+}
+
+func (wp *Watchpoint) Addr() uint64 {
+	return wp.addr
+}
+
+func (wp *Watchpoint) Size() int {
+	return wp.size
+}
+
+func (wp *Watchpoint) Kind() WatchpointKind {
+	return wp.kind
+}
+
+// LEN field of DR7 by size
+var watchpointLengths = map[int]uint64{1: 0b00, 2: 0b01, 8: 0b10, 4: 0b11}
+
+// setDebugRegisters sets addresses of watchpoints and DR7 to the debug registers of th.
+// debug registers are per thread, so that all threads must have the same values.
+func (t *Target) setDebugRegisters(th *Thread) error {
+	dr7 := uint64(0)
+	for i, wp := range t.watchpoints {
+		if wp == nil {
+			continue
+		}
+
+		rw := uint64(0b01)
+		if wp.kind == WatchAccess {
+			rw = 0b11
+		}
+
+		// address must be set before it is enabled
+		if err := t.setDebugRegister(th, i, wp.addr); err != nil {
+			return err
+		}
+		// local enable bit, and R/W and LEN fields of the slot
+		dr7 |= 1<<(i*2) | rw<<(16+i*4) | watchpointLengths[wp.size]<<(18+i*4)
+	}
+
+	return t.setDebugRegister(th, debugControlRegister, dr7)
+}
+
+// hitWatchpoint returns the watchpoint which stops th, or nil if no watchpoint is hit.
+func (t *Target) hitWatchpoint(th *Thread) (*Watchpoint, error) {
+	dr6, err := t.getDebugRegister(th, debugStatusRegister)
+	if err != nil {
+		return nil, err
+	}
+
+	// DR6 is not cleared by the processor
+	if err := t.setDebugRegister(th, debugStatusRegister, 0); err != nil {
+		return nil, err
+	}
+
+	for i, wp := range t.watchpoints {
+		if wp != nil && dr6&(1<<i) != 0 {
+			return wp, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (t *Target) getDebugRegister(th *Thread, n int) (uint64, error) {
+	b := make([]byte, 8)
+	if _, err := sys.PtracePeekUser(th.tid, uintptr(debugRegisterOffset+n*8), b); err != nil {
+		return 0, fmt.Errorf("failed to get debug register %d of thread %d: %s", n, th.tid, err)
+	}
+
+	return binary.LittleEndian.Uint64(b), nil
+}
+
+func (t *Target) setDebugRegister(th *Thread, n int, value uint64) error {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, value)
+	if _, err := sys.PtracePokeUser(th.tid, uintptr(debugRegisterOffset+n*8), b); err != nil {
+		return fmt.Errorf("failed to set debug register %d of thread %d: %s", n, th.tid, err)
+	}
+
+	return nil
+}
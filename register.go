@@ -1,9 +1,13 @@
 package main
 
 import (
+	"encoding/binary"
 	"fmt"
+	"io"
 	"reflect"
+	"strings"
 
+	"github.com/ksrnnb/godbg/proc"
 	sys "golang.org/x/sys/unix"
 )
 
@@ -40,18 +44,43 @@ const (
 	Gs      Register = "Gs"
 )
 
+// registerByName returns Register for case-insensitive name like "rsp".
+func registerByName(name string) Register {
+	name = strings.ToLower(name)
+	if name == "" {
+		return Register(name)
+	}
+
+	return Register(strings.ToUpper(name[:1]) + name[1:])
+}
+
+// RegisterClient accesses registers of the thread of tid, or the current thread of the process if tid is 0.
 type RegisterClient struct {
-	pid int
+	target *proc.Target
+	tid    int
+}
+
+func NewRegisterClient(target *proc.Target) RegisterClient {
+	return RegisterClient{target: target}
 }
 
-func NewRegisterClient(pid int) RegisterClient {
-	return RegisterClient{pid: pid}
+// threadRegisterClient returns RegisterClient of the thread, which doesn't follow the current thread.
+func threadRegisterClient(target *proc.Target, tid int) RegisterClient {
+	return RegisterClient{target: target, tid: tid}
+}
+
+func (c RegisterClient) threadID() int {
+	if c.tid != 0 {
+		return c.tid
+	}
+
+	return c.target.Tid()
 }
 
 func (c RegisterClient) GetRegisterValue(register Register) (uint64, error) {
 	regs := &sys.PtraceRegs{}
-	if err := sys.PtraceGetRegs(c.pid, regs); err != nil {
-		return 0, fmt.Errorf("failed to get register values for %s and pid %d: %s", register, c.pid, err)
+	if err := sys.PtraceGetRegs(c.threadID(), regs); err != nil {
+		return 0, fmt.Errorf("failed to get register values for %s and thread %d: %s", register, c.threadID(), err)
 	}
 
 	v := reflect.ValueOf(regs).Elem()
@@ -68,7 +97,7 @@ func (c RegisterClient) GetRegisterValue(register Register) (uint64, error) {
 
 func (c RegisterClient) SetRegisterValue(register Register, value uint64) error {
 	regs := &sys.PtraceRegs{}
-	if err := sys.PtraceGetRegs(c.pid, regs); err != nil {
+	if err := sys.PtraceGetRegs(c.threadID(), regs); err != nil {
 		return err
 	}
 
@@ -85,21 +114,93 @@ func (c RegisterClient) SetRegisterValue(register Register, value uint64) error
 	}
 	field.SetUint(value)
 
-	return sys.PtraceSetRegs(c.pid, regs)
+	return sys.PtraceSetRegs(c.threadID(), regs)
 }
 
-func (c RegisterClient) DumpRegisters() error {
+func (c RegisterClient) DumpRegisters(w io.Writer) error {
 	regs := &sys.PtraceRegs{}
-	if err := sys.PtraceGetRegs(c.pid, regs); err != nil {
-		return fmt.Errorf("failed to get regs for pid %d: %s", c.pid, err)
+	if err := sys.PtraceGetRegs(c.threadID(), regs); err != nil {
+		return fmt.Errorf("failed to get regs for thread %d: %s", c.threadID(), err)
 	}
 
 	v := reflect.ValueOf(regs).Elem()
 
 	for i := 0; i < v.NumField(); i++ {
 		field := v.Field(i)
-		fmt.Printf("%s: 0x%x\n", v.Type().Field(i).Name, field.Uint())
+		fmt.Fprintf(w, "%s: 0x%x\n", v.Type().Field(i).Name, field.Uint())
 	}
 
 	return nil
 }
+
+// DWARF register numbers for amd64.
+// @see System V Application Binary Interface AMD64 Architecture Processor Supplement, 3.6.2 DWARF Register Number Mapping
+const (
+	DwarfRegRbp    = 6
+	DwarfRegRsp    = 7
+	DwarfRegRip    = 16
+	DwarfRegXMM0   = 17
+	DwarfRegST0    = 33
+	DwarfRegRflags = 49
+)
+
+var dwarfRegisters = map[uint64]Register{
+	0:              Rax,
+	1:              Rdx,
+	2:              Rcx,
+	3:              Rbx,
+	4:              Rsi,
+	5:              Rdi,
+	DwarfRegRbp:    Rbp,
+	DwarfRegRsp:    Rsp,
+	8:              R8,
+	9:              R9,
+	10:             R10,
+	11:             R11,
+	12:             R12,
+	13:             R13,
+	14:             R14,
+	15:             R15,
+	DwarfRegRip:    Rip,
+	DwarfRegRflags: Eflags,
+	50:             Es,
+	51:             Cs,
+	52:             Ss,
+	53:             Ds,
+	54:             Fs,
+	55:             Gs,
+	58:             Fs_base,
+	59:             Gs_base,
+}
+
+// DwarfRegister returns the value of the register by DWARF register number in little endian.
+// XMM and x87 registers are also supported.
+func (c RegisterClient) DwarfRegister(regnum uint64) ([]byte, error) {
+	if register, ok := dwarfRegisters[regnum]; ok {
+		v, err := c.GetRegisterValue(register)
+		if err != nil {
+			return nil, err
+		}
+
+		b := make([]byte, 8)
+		binary.LittleEndian.PutUint64(b, v)
+		return b, nil
+	}
+
+	var name string
+	switch {
+	case regnum >= DwarfRegXMM0 && regnum < DwarfRegXMM0+numXMMRegisters:
+		name = fmt.Sprintf("x%d", regnum-DwarfRegXMM0)
+	case regnum >= DwarfRegST0 && regnum < DwarfRegST0+numSTRegisters:
+		name = fmt.Sprintf("st%d", regnum-DwarfRegST0)
+	default:
+		return nil, fmt.Errorf("unsupported DWARF register %d", regnum)
+	}
+
+	fp, err := c.GetFPRegisters()
+	if err != nil {
+		return nil, err
+	}
+
+	return fp.Get(name)
+}
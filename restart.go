@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/ksrnnb/godbg/proc"
+)
+
+// handleRestartCommand kills all inferiors and launches the program again. args replace arguments of the process if they are given.
+// the package is built again if its sources have changed, and user breakpoints of the selected inferior are set again by their locations.
+func (d *Debugger) handleRestartCommand(args []string) error {
+	// the binary of the attached process is not built by the debugger
+	if d.builtBinaryPath == "" {
+		return errors.New("attached process can't be restarted")
+	}
+
+	if err := d.killInferiors(); err != nil {
+		return err
+	}
+
+	if len(args) > 0 {
+		d.config.args = args
+	}
+
+	path := d.builtBinaryPath
+	if d.sourcesChanged() {
+		fmt.Fprintf(d.out, "building %s because sources have changed\n", d.debuggeePath)
+
+		newPath, err := buildDebuggeeProgram(d.debuggeePath, d.config)
+		if err != nil {
+			return fmt.Errorf("failed to build %s: %s", d.debuggeePath, err)
+		}
+		path = newPath
+	}
+
+	t, err := proc.Launch(path, d.config.args, d.config.aslr)
+	if err != nil {
+		if path != d.builtBinaryPath {
+			os.Remove(path)
+		}
+		return err
+	}
+
+	locations := d.inferior.userBreakpointLocations()
+	for _, inf := range d.inferiors {
+		inf.close()
+	}
+
+	if err := d.load(t); err != nil {
+		return err
+	}
+	d.resetInferiors()
+
+	if path != d.builtBinaryPath {
+		oldPath := d.builtBinaryPath
+		d.builtBinaryPath = path
+		if err := os.Remove(oldPath); err != nil {
+			return err
+		}
+	}
+
+	for _, location := range locations {
+		if _, err := d.setBreakpointAtLocation(strings.Fields(location)); err != nil {
+			fmt.Fprintf(d.out, "failed to set breakpoint at %s: %s\n", location, err)
+		}
+	}
+
+	fmt.Fprintf(d.out, "process %d started\n", t.Pid())
+	return nil
+}
+
+// userBreakpointLocations returns locations of user breakpoints in the order of addresses, and pending breakpoints.
+func (inf *inferior) userBreakpointLocations() []string {
+	addrs := make([]uint64, 0, len(inf.breakpointLocations))
+	for addr := range inf.breakpointLocations {
+		addrs = append(addrs, addr)
+	}
+	slices.Sort(addrs)
+
+	locations := make([]string, 0, len(addrs)+len(inf.pendingBreakpoints))
+	for _, addr := range addrs {
+		locations = append(locations, inf.breakpointLocations[addr])
+	}
+
+	return append(locations, inf.pendingBreakpoints...)
+}
+
+// sourcesChanged returns true if a source file of the executable is modified after it is built.
+func (d *Debugger) sourcesChanged() bool {
+	// symbols of the selected inferior are of another program which it has executed
+	if d.debugeeBinaryPath != d.builtBinaryPath {
+		return true
+	}
+
+	info, err := os.Stat(d.builtBinaryPath)
+	if err != nil {
+		return true
+	}
+
+	files, err := d.symTable.Files()
+	if err != nil {
+		return true
+	}
+
+	for _, f := range files {
+		path, ok := d.resolveSourcePath(f)
+		if !ok {
+			continue
+		}
+
+		if fi, err := os.Stat(path); err == nil && fi.ModTime().After(info.ModTime()) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,475 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/ksrnnb/godbg/api"
+	"github.com/ksrnnb/godbg/proc"
+	sys "golang.org/x/sys/unix"
+)
+
+// rpcServer serves JSON-RPC 2.0 API of package api.
+// requests are read on goroutines of connections, and handled by run on the thread tracing the process,
+// because ptrace requests must be sent from the thread which attaches the process.
+type rpcServer struct {
+	d    *Debugger
+	jobs chan func()
+
+	mu    sync.Mutex
+	conns map[*rpcConn]bool
+
+	// quitting is set by quit command, and run returns after the job
+	quitting bool
+}
+
+type rpcConn struct {
+	conn net.Conn
+	mu   sync.Mutex
+}
+
+func newRPCServer(d *Debugger) *rpcServer {
+	s := &rpcServer{
+		d:     d,
+		jobs:  make(chan func(), 64),
+		conns: make(map[*rpcConn]bool),
+	}
+	d.onExit = s.exited
+
+	return s
+}
+
+// parseListenAddress parses address like "unix:/tmp/godbg.sock" or "127.0.0.1:4040" (TCP).
+func parseListenAddress(address string) (network string, addr string) {
+	if path, ok := strings.CutPrefix(address, "unix:"); ok {
+		return "unix", path
+	}
+
+	return "tcp", address
+}
+
+// listen accepts connections in background.
+func (s *rpcServer) listen(listener net.Listener) {
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			s.serveConn(conn)
+		}
+	}()
+}
+
+// serveConn reads requests of the connection in background.
+func (s *rpcServer) serveConn(conn net.Conn) {
+	c := &rpcConn{conn: conn}
+
+	s.mu.Lock()
+	s.conns[c] = true
+	s.mu.Unlock()
+
+	go func() {
+		defer conn.Close()
+		defer func() {
+			s.mu.Lock()
+			delete(s.conns, c)
+			s.mu.Unlock()
+		}()
+
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			var req api.Request
+			if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+				c.reply(json.RawMessage("null"), nil, &api.Error{Code: api.ParseErrorCode, Message: err.Error()})
+				continue
+			}
+
+			// the job handling the request which resumes the process runs until it stops
+			if req.Method == api.InterruptMethod {
+				s.interrupt(c, req)
+				continue
+			}
+
+			s.jobs <- func() { s.handle(c, req) }
+		}
+	}()
+}
+
+// run handles requests until quit command is given, or done is closed or receives a value.
+func (s *rpcServer) run(done <-chan error) error {
+	for {
+		select {
+		case job := <-s.jobs:
+			job()
+			if s.quitting {
+				return nil
+			}
+		case err := <-done:
+			return err
+		}
+	}
+}
+
+func (c *rpcConn) send(message any) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conn.Write(append(data, '\n'))
+}
+
+func (c *rpcConn) reply(id json.RawMessage, result any, rpcErr *api.Error) {
+	res := api.Response{JSONRPC: "2.0", ID: id, Error: rpcErr}
+	if rpcErr == nil {
+		data, err := json.Marshal(result)
+		if err != nil {
+			res.Error = &api.Error{Code: api.ServerErrorCode, Message: err.Error()}
+		}
+		res.Result = data
+	}
+
+	c.send(res)
+}
+
+// broadcast sends the notification to all clients.
+func (s *rpcServer) broadcast(method string, params any) {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	conns := make([]*rpcConn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mu.Unlock()
+
+	for _, c := range conns {
+		c.send(api.Request{JSONRPC: "2.0", Method: method, Params: data})
+	}
+}
+
+// exited notifies clients that the process has exited. the server keeps serving after that.
+func (s *rpcServer) exited(reason proc.StopReason) {
+	s.broadcast(api.ExitedEvent, exitedOf(reason))
+}
+
+func exitedOf(reason proc.StopReason) *api.Exited {
+	exited := &api.Exited{Status: reason.Status}
+	if reason.Kind == proc.StopKilled {
+		exited.Signal = sys.SignalName(reason.Signal)
+	}
+
+	return exited
+}
+
+func (s *rpcServer) handle(c *rpcConn, req api.Request) {
+	if req.JSONRPC != "2.0" {
+		c.reply(req.ID, nil, &api.Error{Code: api.InvalidRequestCode, Message: "jsonrpc must be 2.0"})
+		return
+	}
+
+	// outputs are returned only by command method
+	s.d.out = io.Discard
+	s.d.suppressSourceCode = true
+	defer func() {
+		s.d.out = io.Discard
+		s.d.suppressSourceCode = false
+	}()
+
+	result, err := s.call(req.Method, req.Params)
+
+	// notification doesn't have a response
+	if req.ID == nil {
+		return
+	}
+
+	if err != nil {
+		rpcErr, ok := err.(*api.Error)
+		if !ok {
+			rpcErr = &api.Error{Code: api.ServerErrorCode, Message: err.Error()}
+		}
+		c.reply(req.ID, nil, rpcErr)
+		return
+	}
+
+	c.reply(req.ID, result, nil)
+}
+
+// interrupt stops the running process on the goroutine of the connection.
+func (s *rpcServer) interrupt(c *rpcConn, req api.Request) {
+	err := s.d.interrupt()
+	if req.ID == nil {
+		return
+	}
+
+	if err != nil {
+		c.reply(req.ID, nil, &api.Error{Code: api.ServerErrorCode, Message: err.Error()})
+		return
+	}
+
+	c.reply(req.ID, nil, nil)
+}
+
+func decodeParams(params json.RawMessage, v any) error {
+	if len(params) == 0 {
+		return nil
+	}
+
+	if err := json.Unmarshal(params, v); err != nil {
+		return &api.Error{Code: api.InvalidParamsCode, Message: err.Error()}
+	}
+
+	return nil
+}
+
+func (s *rpcServer) call(method string, params json.RawMessage) (any, error) {
+	switch method {
+	case api.CreateBreakpointMethod:
+		var p api.CreateBreakpointParams
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+
+		args := strings.Fields(p.Location)
+		if len(args) == 0 {
+			return nil, &api.Error{Code: api.InvalidParamsCode, Message: "location must be given"}
+		}
+
+		addr, err := s.d.setBreakpointAtLocation(args)
+		if err != nil {
+			return nil, err
+		}
+
+		// pending breakpoint doesn't have address yet
+		if addr == 0 {
+			return api.Breakpoint{Function: p.Location}, nil
+		}
+
+		return s.breakpoint(addr), nil
+	case api.ClearBreakpointMethod:
+		var p api.ClearBreakpointParams
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+
+		return nil, s.d.clearBreakpoint(p.Addr)
+	case api.BreakpointsMethod:
+		breakpoints := []api.Breakpoint{}
+		for _, bp := range s.d.target.Breakpoints() {
+			if bp.IsUser() {
+				breakpoints = append(breakpoints, s.breakpoint(bp.Addr()))
+			}
+		}
+
+		return breakpoints, nil
+	case api.ContinueMethod:
+		return s.resume(s.d.continueInstruction)
+	case api.StepMethod:
+		var p api.StepParams
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+
+		step, ok := map[string]func() error{
+			api.StepNext:        s.d.handleNextCommand,
+			api.StepIn:          s.d.handleStepInCommand,
+			api.StepOut:         s.d.handleStepOutCommand,
+			api.StepInstruction: s.d.handleNextInstructionCommand,
+		}[p.Kind]
+		if !ok {
+			return nil, &api.Error{Code: api.InvalidParamsCode, Message: fmt.Sprintf("unknown kind of step: %s", p.Kind)}
+		}
+
+		return s.resume(step)
+	case api.StateMethod:
+		return s.state()
+	case api.StacktraceMethod:
+		var p api.StacktraceParams
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+
+		return s.stacktrace(p.Goroutine)
+	case api.EvalMethod:
+		var p api.EvalParams
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+
+		return s.eval(p.Expr)
+	case api.GoroutinesMethod:
+		return s.goroutines()
+	case api.CommandMethod:
+		var p api.CommandParams
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+
+		return s.command(p.Line)
+	}
+
+	return nil, &api.Error{Code: api.MethodNotFoundCode, Message: fmt.Sprintf("method %s is not found", method)}
+}
+
+// resume runs the process by run, and notifies clients where the process stops.
+// what the debugger prints while the process runs is returned to the caller.
+func (s *rpcServer) resume(run func() error) (api.State, error) {
+	var buf bytes.Buffer
+	s.d.out = &buf
+
+	// the exit of the process or a signal during run is notified by events instead of an error
+	exited := s.d.target.Exited()
+	if err := run(); err != nil && !isReportedStop(err, exited) {
+		return api.State{}, err
+	}
+
+	state, err := s.state()
+	if err != nil {
+		return api.State{}, err
+	}
+
+	if state.Exited == nil {
+		s.broadcast(api.StoppedEvent, state)
+	}
+
+	state.Output = buf.String()
+	return state, nil
+}
+
+// command runs a command of the REPL, and returns what it prints.
+func (s *rpcServer) command(line string) (api.CommandResult, error) {
+	var buf bytes.Buffer
+	s.d.out = &buf
+	s.d.suppressSourceCode = false
+
+	cmd, err := NewCommand(line)
+	if err != nil {
+		fmt.Fprintf(&buf, "failed to parse command: %s\n", err)
+		return api.CommandResult{Output: buf.String()}, nil
+	}
+
+	if err := s.d.HandleCommand(cmd); errors.Is(err, errQuit) {
+		s.quitting = true
+		return api.CommandResult{}, nil
+	} else if err != nil {
+		return api.CommandResult{}, err
+	}
+
+	switch cmd.Type {
+	case ContinueCommand, NextCommand, StepInCommand, StepOutCommand, SingleStepInstructionCommand, NextInstructionCommand:
+		if state, err := s.state(); err == nil {
+			s.broadcast(api.StoppedEvent, state)
+		}
+	}
+
+	return api.CommandResult{Output: buf.String()}, nil
+}
+
+func (s *rpcServer) breakpoint(addr uint64) api.Breakpoint {
+	bp := api.Breakpoint{Addr: addr}
+	if b, ok := s.d.target.Breakpoint(addr); ok {
+		bp.Enabled = b.IsEnabled()
+	}
+
+	if fn := s.d.symTableForPC(addr).PCToFunc(addr); fn != nil {
+		bp.Function, bp.File, bp.Line = s.d.symTableForPC(addr).GetFuncInfo(addr)
+	}
+
+	return bp
+}
+
+func (s *rpcServer) state() (api.State, error) {
+	if s.d.target.Exited() {
+		return api.State{Pid: s.d.target.Pid(), Exited: exitedOf(s.d.target.LastStop())}, nil
+	}
+
+	pc, err := s.d.getPC()
+	if err != nil {
+		return api.State{}, err
+	}
+
+	state := api.State{Pid: s.d.target.Pid(), PC: pc}
+	if fn := s.d.symTableForPC(pc).PCToFunc(pc); fn != nil {
+		state.Function, state.File, state.Line = s.d.symTableForPC(pc).GetFuncInfo(pc)
+	}
+
+	state.Goroutine, _ = s.d.currentGoroutineID()
+	state.Breakpoint = s.d.hasUserBreakpoint(pc)
+	if stop := s.d.target.LastStop(); stop.Kind == proc.StopSignal {
+		state.Signal = sys.SignalName(stop.Signal)
+	}
+
+	return state, nil
+}
+
+func (s *rpcServer) stacktrace(goroutine uint64) ([]api.Frame, error) {
+	var frames []stackFrame
+	var err error
+	if current, ok := s.d.currentGoroutineID(); goroutine == 0 || (ok && goroutine == current) {
+		frames, err = s.d.currentStackFrames()
+	} else {
+		frames, err = s.d.goroutineStackFrames(goroutine)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]api.Frame, 0, len(frames))
+	for _, f := range frames {
+		result = append(result, api.Frame{PC: f.pc, Function: f.funcname, File: f.filename, Line: f.line})
+	}
+
+	return result, nil
+}
+
+// eval evaluates a variable of the current function, or an address expression.
+func (s *rpcServer) eval(expr string) (api.Variable, error) {
+	typ, value, err := s.d.evalExpression(expr)
+	if err != nil {
+		return api.Variable{}, err
+	}
+
+	return api.Variable{Name: expr, Type: typ, Value: value}, nil
+}
+
+func (s *rpcServer) goroutines() ([]api.Goroutine, error) {
+	goroutines, err := s.d.goroutines()
+	if err != nil {
+		return nil, err
+	}
+
+	current, hasCurrent := s.d.currentGoroutineID()
+	result := make([]api.Goroutine, 0, len(goroutines))
+	for _, g := range goroutines {
+		pc := g.pc
+		isCurrent := hasCurrent && g.id == current
+		// saved pc of the running goroutine is stale
+		if isCurrent {
+			if pc, err = s.d.getPC(); err != nil {
+				return nil, err
+			}
+		}
+
+		goroutine := api.Goroutine{ID: g.id, PC: pc, Current: isCurrent}
+		if fn := s.d.symTableForPC(pc).PCToFunc(pc); fn != nil {
+			goroutine.Function, goroutine.File, goroutine.Line = s.d.symTableForPC(pc).GetFuncInfo(pc)
+		}
+
+		result = append(result, goroutine)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/ksrnnb/godbg/api"
+	"github.com/ksrnnb/godbg/logger"
+)
+
+// TestClient calls methods of the server in the same process through the client over net.Pipe.
+// the server runs on the test goroutine, which traces the process.
+func TestClient(t *testing.T) {
+	d, err := NewDebugger("./cmd/hello", NewConfig(), logger.NewLogger())
+	if err != nil {
+		t.Fatalf("failed to start debugger: %s", err)
+	}
+	defer d.quit()
+
+	server := newRPCServer(d)
+	serverConn, clientConn := net.Pipe()
+	server.serveConn(serverConn)
+
+	client := api.NewClient(clientConn, nil)
+	defer client.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- debugHello(client)
+	}()
+
+	if err := server.run(done); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// debugHello stops cmd/hello at main.main, steps to the line printing c, and continues until the exit.
+func debugHello(client *api.Client) error {
+	bp, err := client.CreateBreakpoint("main.main")
+	if err != nil {
+		return fmt.Errorf("failed to create breakpoint: %s", err)
+	}
+	if bp.Function != "main.main" || !bp.Enabled {
+		return fmt.Errorf("unexpected breakpoint %+v", bp)
+	}
+
+	state, err := client.Continue()
+	if err != nil {
+		return fmt.Errorf("failed to continue: %s", err)
+	}
+	if state.Function != "main.main" || !state.Breakpoint {
+		return fmt.Errorf("expected the breakpoint at main.main, but got %+v", state)
+	}
+
+	for range 4 {
+		if state, err = client.Step(api.StepNext); err != nil {
+			return fmt.Errorf("failed to step: %s", err)
+		}
+	}
+	if state.Line != 10 {
+		return fmt.Errorf("expected line 10, but got %+v", state)
+	}
+
+	v, err := client.Eval("c")
+	if err != nil {
+		return fmt.Errorf("failed to evaluate c: %s", err)
+	}
+	if v.Value != "8" {
+		return fmt.Errorf("expected c = 8, but got %+v", v)
+	}
+
+	frames, err := client.Stacktrace(0)
+	if err != nil {
+		return fmt.Errorf("failed to get stacktrace: %s", err)
+	}
+	if len(frames) == 0 || frames[0].Function != "main.main" || frames[0].Line != 10 {
+		return fmt.Errorf("unexpected frames %+v", frames)
+	}
+
+	output, err := client.Command("print c")
+	if err != nil {
+		return fmt.Errorf("failed to run print command: %s", err)
+	}
+	if output != "c int = 8\n" {
+		return fmt.Errorf("unexpected output of print command %q", output)
+	}
+
+	state, err = client.Continue()
+	if err != nil {
+		return fmt.Errorf("failed to continue: %s", err)
+	}
+	if state.Exited == nil || state.Exited.Status != 0 {
+		return fmt.Errorf("expected the exit with status 0, but got %+v", state)
+	}
+
+	return nil
+}
+
+// TestHandlerStepIn steps into a function through the REPL, where the step sets a temporary breakpoint
+// after the call of the prologue, and checks that the source is listed once.
+func TestHandlerStepIn(t *testing.T) {
+	d, err := NewDebugger("./cmd/hello", NewConfig(), logger.NewLogger())
+	if err != nil {
+		t.Fatalf("failed to start debugger: %s", err)
+	}
+	defer d.quit()
+
+	server := newRPCServer(d)
+	serverConn, clientConn := net.Pipe()
+	server.serveConn(serverConn)
+
+	h := NewHandler(clientConn)
+	defer h.client.Close()
+
+	var output string
+	done := make(chan error, 1)
+	go func() {
+		for _, line := range []string{"break main.go:11", "continue", "stepin"} {
+			if output, err = h.handle(line); err != nil {
+				done <- fmt.Errorf("failed to handle %s: %s", line, err)
+				return
+			}
+		}
+		done <- nil
+	}()
+
+	if err := server.run(done); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := strings.Count(output, `fmt.Println("Hello, world!")`); n != 1 {
+		t.Fatalf("expected the source of printHello once, but got %d times in %q", n, output)
+	}
+}
+
+// TestStepOutReturnValues checks that a string and a struct returned in registers are printed by their values.
+func TestStepOutReturnValues(t *testing.T) {
+	d, err := NewDebugger("./testdata/values", NewConfig(), logger.NewLogger())
+	if err != nil {
+		t.Fatalf("failed to start debugger: %s", err)
+	}
+	defer d.quit()
+
+	server := newRPCServer(d)
+	serverConn, clientConn := net.Pipe()
+	server.serveConn(serverConn)
+
+	client := api.NewClient(clientConn, nil)
+	defer client.Close()
+
+	tests := []struct {
+		function string
+		want     string
+	}{
+		{function: "main.greet", want: `~r0 string = "hello, gopher"`},
+		{function: "main.makePoint", want: `~r0 main.point = {X: 1, Y: 2, Name: "origin"}`},
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		for _, tt := range tests {
+			var output string
+			for _, line := range []string{"break " + tt.function, "continue", "stepout"} {
+				if output, err = client.Command(line); err != nil {
+					done <- fmt.Errorf("failed to run %s: %s", line, err)
+					return
+				}
+			}
+			if !strings.Contains(output, tt.want) {
+				done <- fmt.Errorf("expected %s returns %s, but got %q", tt.function, tt.want, output)
+				return
+			}
+		}
+		done <- nil
+	}()
+
+	if err := server.run(done); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestDisassembleAfterExit disassembles a function from the binary after the process exits,
+// which must be the same as the instructions in memory of the process.
+func TestDisassembleAfterExit(t *testing.T) {
+	d, err := NewDebugger("./cmd/hello", NewConfig(), logger.NewLogger())
+	if err != nil {
+		t.Fatalf("failed to start debugger: %s", err)
+	}
+	defer d.quit()
+
+	server := newRPCServer(d)
+	serverConn, clientConn := net.Pipe()
+	server.serveConn(serverConn)
+
+	client := api.NewClient(clientConn, nil)
+	defer client.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- disassembleAfterExit(client)
+	}()
+
+	if err := server.run(done); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func disassembleAfterExit(client *api.Client) error {
+	live, err := client.Command("disassemble main.printHello")
+	if err != nil {
+		return fmt.Errorf("failed to disassemble: %s", err)
+	}
+	if !strings.Contains(live, "CALL fmt.Println(SB)") {
+		return fmt.Errorf("unexpected instructions in memory %q", live)
+	}
+
+	state, err := client.Continue()
+	if err != nil {
+		return fmt.Errorf("failed to continue: %s", err)
+	}
+	if state.Exited == nil {
+		return fmt.Errorf("expected the exit, but got %+v", state)
+	}
+
+	static, err := client.Command("disassemble main.printHello")
+	if err != nil {
+		return fmt.Errorf("failed to disassemble after exit: %s", err)
+	}
+	if static != live {
+		return fmt.Errorf("instructions in the file %q differ from instructions in memory %q", static, live)
+	}
+
+	// the current function is not known without the process
+	output, err := client.Command("disassemble")
+	if err != nil {
+		return fmt.Errorf("failed to run disassemble: %s", err)
+	}
+	if !strings.HasPrefix(output, "failed to handle disassemble command") {
+		return fmt.Errorf("expected the failure without the process, but got %q", output)
+	}
+
+	return nil
+}
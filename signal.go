@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/ksrnnb/godbg/proc"
+	sys "golang.org/x/sys/unix"
+)
+
+// the last standard signal, and real-time signals are not listed
+const maxStandardSignal = 31
+
+// handleSignalCommand prints policies of signals, or changes the policy of a signal by keywords
+// like "handle SIGUSR1 nostop noprint pass".
+func (d *Debugger) handleSignalCommand(args []string) error {
+	if len(args) == 0 {
+		d.printSignalPolicies(nil)
+		return nil
+	}
+
+	sig, err := parseSignal(args[0])
+	if err != nil {
+		return err
+	}
+
+	policy := d.target.SignalPolicy(sig)
+	for _, keyword := range args[1:] {
+		switch keyword {
+		case "stop":
+			policy.Stop, policy.Print = true, true
+		case "nostop":
+			policy.Stop = false
+		case "print":
+			policy.Print = true
+		case "noprint":
+			policy.Stop, policy.Print = false, false
+		case "pass":
+			policy.Pass = true
+		case "nopass":
+			policy.Pass = false
+		default:
+			return fmt.Errorf("unknown keyword %s, which must be one of stop, nostop, print, noprint, pass and nopass", keyword)
+		}
+	}
+
+	// policies are kept after restart
+	d.signalPolicies[sig] = policy
+	d.target.SetSignalPolicy(sig, policy)
+
+	d.printSignalPolicies([]syscall.Signal{sig})
+	return nil
+}
+
+// printSignalPolicies prints policies of signals, or all standard signals if signals is nil.
+func (d *Debugger) printSignalPolicies(signals []syscall.Signal) {
+	if signals == nil {
+		for sig := syscall.Signal(1); sig <= maxStandardSignal; sig++ {
+			if sys.SignalName(sig) != "" {
+				signals = append(signals, sig)
+			}
+		}
+	}
+
+	yesNo := map[bool]string{true: "yes", false: "no"}
+	fmt.Fprintf(d.out, "%-10s %-5s %-5s %-5s %s\n", "signal", "stop", "print", "pass", "description")
+	for _, sig := range signals {
+		policy := d.target.SignalPolicy(sig)
+		fmt.Fprintf(d.out, "%-10s %-5s %-5s %-5s %s\n", sys.SignalName(sig), yesNo[policy.Stop], yesNo[policy.Print], yesNo[policy.Pass], sig)
+	}
+}
+
+// notifySignal prints the signal which the process receives without stopping.
+func (d *Debugger) notifySignal(sig syscall.Signal) {
+	fmt.Fprintf(d.out, "process %d received %s\n", d.target.Pid(), sys.SignalName(sig))
+}
+
+// parseSignal parses a signal like SIGUSR1, usr1 or 10.
+func parseSignal(s string) (syscall.Signal, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		if sys.SignalName(syscall.Signal(n)) == "" {
+			return 0, fmt.Errorf("unknown signal %d", n)
+		}
+		return syscall.Signal(n), nil
+	}
+
+	name := strings.ToUpper(s)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+
+	sig := sys.SignalNum(name)
+	if sig == 0 {
+		return 0, fmt.Errorf("unknown signal %s", s)
+	}
+
+	return sig, nil
+}
+
+// applySignalPolicies sets policies changed by handle command to the process.
+func (d *Debugger) applySignalPolicies(t *proc.Target) {
+	for sig, policy := range d.signalPolicies {
+		t.SetSignalPolicy(sig, policy)
+	}
+	t.NotifySignals(d.notifySignal)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// substitutePath is a rule to rewrite the prefix of source paths recorded in debug information.
+type substitutePath struct {
+	from string
+	to   string
+}
+
+// goEnvironment is where source code of the standard library and modules is on this machine.
+type goEnvironment struct {
+	goroot   string
+	modCache string
+	// path and directory of the main module of the debuggee
+	modulePath string
+	moduleDir  string
+}
+
+// resolveSourcePath returns the path of the source file on this machine.
+// the path in debug information may be from another machine, or may be trimmed by -trimpath.
+func (d *Debugger) resolveSourcePath(filename string) (string, bool) {
+	for _, rule := range d.config.substitutePaths {
+		if rest, ok := cutPathPrefix(filename, rule.from); ok {
+			if path := filepath.Join(rule.to, rest); fileExists(path) {
+				return path, true
+			}
+		}
+	}
+
+	if fileExists(filename) {
+		return filename, true
+	}
+
+	env := d.goEnvironment()
+
+	// module cache of another machine, e.g. /home/user/go/pkg/mod/github.com/x/y@v1.0.0/file.go
+	if _, rest, ok := strings.Cut(filename, "/pkg/mod/"); ok && env.modCache != "" {
+		if path := filepath.Join(env.modCache, rest); fileExists(path) {
+			return path, true
+		}
+	}
+
+	// GOROOT of another machine, e.g. /usr/local/go/src/fmt/print.go
+	if _, rest, ok := strings.Cut(filename, "/src/"); ok && env.goroot != "" {
+		if path := filepath.Join(env.goroot, "src", rest); fileExists(path) {
+			return path, true
+		}
+	}
+
+	// paths are relative to module or GOROOT/src if the binary is built with -trimpath
+	if filepath.IsAbs(filename) {
+		return "", false
+	}
+
+	if rest, ok := cutPathPrefix(filename, env.modulePath); ok && env.moduleDir != "" {
+		if path := filepath.Join(env.moduleDir, rest); fileExists(path) {
+			return path, true
+		}
+	}
+
+	// e.g. github.com/x/y@v1.0.0/file.go
+	if strings.Contains(filename, "@") && env.modCache != "" {
+		if path := filepath.Join(env.modCache, escapeModulePath(filename)); fileExists(path) {
+			return path, true
+		}
+	}
+
+	if env.goroot != "" {
+		if path := filepath.Join(env.goroot, "src", filename); fileExists(path) {
+			return path, true
+		}
+	}
+
+	return "", false
+}
+
+// goEnvironment runs go command to get GOROOT, GOMODCACHE and the main module at the first call.
+func (d *Debugger) goEnvironment() goEnvironment {
+	if d.goEnv != nil {
+		return *d.goEnv
+	}
+
+	env := goEnvironment{}
+	if out, err := exec.Command("go", "env", "GOROOT", "GOMODCACHE").Output(); err == nil {
+		lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+		if len(lines) == 2 {
+			env.goroot, env.modCache = lines[0], lines[1]
+		}
+	}
+
+	cmd := exec.Command("go", "list", "-m", "-f", "{{.Path}} {{.Dir}}")
+	cmd.Dir = d.debuggeePath
+	if info, err := os.Stat(d.debuggeePath); err == nil && !info.IsDir() {
+		cmd.Dir = filepath.Dir(d.debuggeePath)
+	}
+	if out, err := cmd.Output(); err == nil {
+		env.modulePath, env.moduleDir, _ = strings.Cut(strings.TrimSpace(string(out)), " ")
+	}
+
+	d.goEnv = &env
+	return env
+}
+
+// cutPathPrefix returns path without prefix if prefix is the leading directories of path.
+func cutPathPrefix(path string, prefix string) (string, bool) {
+	if prefix == "" {
+		return "", false
+	}
+
+	prefix = strings.TrimSuffix(prefix, "/")
+	if !strings.HasPrefix(path, prefix+"/") {
+		return "", false
+	}
+
+	return path[len(prefix)+1:], true
+}
+
+// escapeModulePath escapes upper case letters as module cache does (e.g. github.com/!burnt!sushi).
+func escapeModulePath(path string) string {
+	var b strings.Builder
+	for _, r := range path {
+		if unicode.IsUpper(r) {
+			b.WriteByte('!')
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// maxStackDepth limits frames in case frame pointers are broken
+const maxStackDepth = 1024
+
+// stackFrame is a frame found by walking frame pointers.
+type stackFrame struct {
+	pc       uint64
+	sp       uint64
+	bp       uint64
+	funcname string
+	filename string
+	line     int
+}
+
+// frameRegisters are registers of a caller frame, which are recovered by walking frame pointers.
+// other registers are not saved in the frame, so they are not available.
+type frameRegisters struct {
+	pc uint64
+	sp uint64
+	bp uint64
+}
+
+func (r frameRegisters) DwarfRegister(regnum uint64) ([]byte, error) {
+	var v uint64
+	switch regnum {
+	case DwarfRegRip:
+		v = r.pc
+	case DwarfRegRsp:
+		v = r.sp
+	case DwarfRegRbp:
+		v = r.bp
+	default:
+		return nil, fmt.Errorf("DWARF register %d of caller frame is not available", regnum)
+	}
+
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, v)
+	return b, nil
+}
+
+// currentStackFrames walks frames from the current registers.
+func (d *Debugger) currentStackFrames() ([]stackFrame, error) {
+	pc, err := d.getPC()
+	if err != nil {
+		return nil, err
+	}
+
+	sp, err := d.registerClient.GetRegisterValue(Rsp)
+	if err != nil {
+		return nil, err
+	}
+
+	bp, err := d.registerClient.GetRegisterValue(Rbp)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.stackFrames(pc, sp, bp)
+}
+
+// stackFrames walks frame pointers from the frame of pc, sp and bp until main.main or runtime.goexit.
+func (d *Debugger) stackFrames(pc, sp, bp uint64) ([]stackFrame, error) {
+	var frames []stackFrame
+	for len(frames) < maxStackDepth {
+		if d.symTableForPC(pc).PCToFunc(pc) == nil {
+			break
+		}
+
+		funcname, filename, line := d.symTableForPC(pc).GetFuncInfo(pc)
+		frames = append(frames, stackFrame{pc: pc, sp: sp, bp: bp, funcname: funcname, filename: filename, line: line})
+
+		if funcname == MainFunctionSymbol || funcname == "runtime.goexit" || bp == 0 {
+			break
+		}
+
+		// return address is just above the saved rbp
+		returnAddress, err := d.readMemory(bp + 8)
+		if err != nil {
+			return nil, fmt.Errorf("faield to get return address: %s", err)
+		}
+
+		callerBP, err := d.readMemory(bp)
+		if err != nil {
+			return nil, fmt.Errorf("faield to get frame pointer: %s", err)
+		}
+
+		// stack pointer of the caller is just above the return address
+		pc, sp, bp = returnAddress, bp+16, callerBP
+	}
+
+	return frames, nil
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"debug/elf"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// symbolCacheVersion must be incremented when the format of symbolIndex is changed.
+const symbolCacheVersion = 1
+
+// symbolCacheMaxEntries is the number of cache files kept in the cache directory.
+// each build of the debuggee has a new build ID, so that old files are removed in order of last use.
+const symbolCacheMaxEntries = 32
+
+const (
+	// note types of build ID
+	noteTypeGoBuildID  = 4
+	noteTypeGNUBuildID = 3
+)
+
+// buildID returns Go build ID of the binary, or GNU build ID if Go build ID is not found.
+// empty string is returned if the binary has neither of them.
+func buildID(f *elf.File) string {
+	if desc := readNote(sectionData(f, ".note.go.buildid"), "Go", noteTypeGoBuildID); desc != nil {
+		return string(desc)
+	}
+
+	if desc := readNote(sectionData(f, ".note.gnu.build-id"), "GNU", noteTypeGNUBuildID); desc != nil {
+		return hex.EncodeToString(desc)
+	}
+
+	return ""
+}
+
+// readNote returns the descriptor of the ELF note which has the name and type.
+func readNote(data []byte, name string, typ uint32) []byte {
+	align := func(n uint32) uint32 { return (n + 3) &^ 3 }
+
+	for len(data) >= 12 {
+		nameSize := binary.LittleEndian.Uint32(data[0:])
+		descSize := binary.LittleEndian.Uint32(data[4:])
+		noteType := binary.LittleEndian.Uint32(data[8:])
+		data = data[12:]
+
+		if uint64(align(nameSize))+uint64(align(descSize)) > uint64(len(data)) {
+			return nil
+		}
+
+		noteName := string(bytes.TrimRight(data[:nameSize], "\x00"))
+		desc := data[align(nameSize) : align(nameSize)+descSize]
+		if noteName == name && noteType == typ {
+			return desc
+		}
+
+		data = data[align(nameSize)+align(descSize):]
+	}
+
+	return nil
+}
+
+// symbolCachePath returns the path of the cache file for the build ID.
+func symbolCachePath(buildID string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	// build ID contains '/', so it is hashed to be used as a file name
+	sum := sha256.Sum256([]byte(buildID))
+	name := fmt.Sprintf("%s-v%d.gob", hex.EncodeToString(sum[:16]), symbolCacheVersion)
+
+	return filepath.Join(dir, "godbg", name), nil
+}
+
+func loadSymbolIndex(path string) (*symbolIndex, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var idx symbolIndex
+	if err := gob.NewDecoder(f).Decode(&idx); err != nil {
+		return nil, fmt.Errorf("failed to decode symbol cache %s: %s", path, err)
+	}
+
+	// the cache used recently is kept by pruneSymbolCache
+	now := time.Now()
+	os.Chtimes(path, now, now)
+
+	return &idx, nil
+}
+
+func saveSymbolIndex(path string, idx *symbolIndex) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	// write to temporary file and rename it, so that other debugger never reads a partial cache
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := gob.NewEncoder(tmp).Encode(idx); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to encode symbol cache: %s", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// pruneSymbolCache removes cache files in dir except the keep most recently used ones.
+func pruneSymbolCache(dir string, keep int) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	type cacheFile struct {
+		path    string
+		modTime time.Time
+	}
+	var files []cacheFile
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || filepath.Ext(entry.Name()) != ".gob" {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, cacheFile{path: filepath.Join(dir, entry.Name()), modTime: info.ModTime()})
+	}
+
+	if len(files) <= keep {
+		return nil
+	}
+
+	// newest first
+	slices.SortFunc(files, func(a, b cacheFile) int {
+		return b.modTime.Compare(a.modTime)
+	})
+
+	for _, f := range files[keep:] {
+		if err := os.Remove(f.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
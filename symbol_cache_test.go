@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestPruneSymbolCache(t *testing.T) {
+	dir := t.TempDir()
+
+	// a.gob is the oldest and e.gob is the newest
+	now := time.Now()
+	for i, name := range []string{"a.gob", "b.gob", "c.gob", "d.gob", "e.gob", "other.txt"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		modTime := now.Add(time.Duration(i-10) * time.Minute)
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := pruneSymbolCache(dir, 3); err != nil {
+		t.Fatalf("failed to prune: %s", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+
+	want := []string{"c.gob", "d.gob", "e.gob", "other.txt"}
+	if !slices.Equal(names, want) {
+		t.Fatalf("expected %v, but got %v", want, names)
+	}
+
+	// nothing is removed if files are fewer than keep
+	if err := pruneSymbolCache(dir, 3); err != nil {
+		t.Fatalf("failed to prune: %s", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != len(want) {
+		t.Fatalf("expected %d files, but got %d", len(want), len(entries))
+	}
+}
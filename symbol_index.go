@@ -0,0 +1,274 @@
+package main
+
+import (
+	"cmp"
+	"debug/dwarf"
+	"debug/gosym"
+	"runtime"
+	"slices"
+	"sync"
+)
+
+// lineRow is a row of line number program
+type lineRow struct {
+	Addr uint64
+	// index of symbolIndex.Files
+	File        uint32
+	Line        int
+	IsStmt      bool
+	PrologueEnd bool
+}
+
+// funcRange is address range of DW_TAG_subprogram
+type funcRange struct {
+	Name     string
+	LowPC    uint64
+	HighPC   uint64
+	Offset   dwarf.Offset
+	CUOffset dwarf.Offset
+}
+
+// symbolIndex is built once when debug information is loaded,
+// so that lookups don't have to scan all line programs and DIEs.
+//
+// exported fields are saved in the cache, and the others are derived from them by prepare.
+type symbolIndex struct {
+	Files []string
+	// all rows sorted by address
+	Rows []lineRow
+	// functions sorted by low pc
+	Funcs []funcRange
+
+	// rows of each file sorted by line and address
+	fileRows map[string][]lineRow
+	// function name to DIE
+	funcsByName map[string]funcRange
+	// function name to gosym.Func
+	gosymFuncs map[string]*gosym.Func
+}
+
+// cuLineRows is rows of line number program of a compile unit.
+type cuLineRows struct {
+	files []string
+	rows  []lineRow
+	err   error
+}
+
+func buildSymbolIndex(dwarfData *dwarf.Data) (*symbolIndex, error) {
+	idx := &symbolIndex{}
+
+	var cus []*dwarf.Entry
+	var cuOffset dwarf.Offset
+	reader := dwarfData.Reader()
+	for entry, err := reader.Next(); entry != nil; entry, err = reader.Next() {
+		if err != nil {
+			return nil, err
+		}
+
+		switch entry.Tag {
+		case dwarf.TagCompileUnit:
+			cuOffset = entry.Offset
+			cus = append(cus, entry)
+		case dwarf.TagSubprogram:
+			if err := idx.addFunc(dwarfData, entry, cuOffset); err != nil {
+				return nil, err
+			}
+
+			// variables of function are not indexed
+			if entry.Children {
+				reader.SkipChildren()
+			}
+		}
+	}
+
+	// line number programs are independent of each other, so they are read concurrently
+	results := make([]cuLineRows, len(cus))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range runtime.GOMAXPROCS(0) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i] = readLineRows(dwarfData, cus[i])
+			}
+		}()
+	}
+	for i := range cus {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	fileIndex := make(map[string]uint32)
+	for _, r := range results {
+		if r.err != nil {
+			return nil, r.err
+		}
+
+		for _, row := range r.rows {
+			name := r.files[row.File]
+			i, ok := fileIndex[name]
+			if !ok {
+				i = uint32(len(idx.Files))
+				idx.Files = append(idx.Files, name)
+				fileIndex[name] = i
+			}
+
+			row.File = i
+			idx.Rows = append(idx.Rows, row)
+		}
+	}
+
+	// stable sort keeps the order of line program for the same address
+	slices.SortStableFunc(idx.Rows, func(a, b lineRow) int {
+		return cmp.Compare(a.Addr, b.Addr)
+	})
+	slices.SortFunc(idx.Funcs, func(a, b funcRange) int {
+		return cmp.Compare(a.LowPC, b.LowPC)
+	})
+
+	return idx, nil
+}
+
+// readLineRows reads line number program of cu.
+// File of the rows is the index of files in the result.
+func readLineRows(dwarfData *dwarf.Data, cu *dwarf.Entry) cuLineRows {
+	var result cuLineRows
+
+	lineReader, err := dwarfData.LineReader(cu)
+	if err != nil {
+		result.err = err
+		return result
+	}
+
+	// compile unit without line program
+	if lineReader == nil {
+		return result
+	}
+
+	fileIndex := make(map[*dwarf.LineFile]uint32)
+	var lineEntry dwarf.LineEntry
+	for lineReader.Next(&lineEntry) == nil {
+		// address of end sequence is the first byte after the sequence
+		if lineEntry.EndSequence || lineEntry.File == nil {
+			continue
+		}
+
+		i, ok := fileIndex[lineEntry.File]
+		if !ok {
+			i = uint32(len(result.files))
+			result.files = append(result.files, lineEntry.File.Name)
+			fileIndex[lineEntry.File] = i
+		}
+
+		result.rows = append(result.rows, lineRow{
+			Addr:        lineEntry.Address,
+			File:        i,
+			Line:        lineEntry.Line,
+			IsStmt:      lineEntry.IsStmt,
+			PrologueEnd: lineEntry.PrologueEnd,
+		})
+	}
+
+	return result
+}
+
+func (idx *symbolIndex) addFunc(dwarfData *dwarf.Data, entry *dwarf.Entry, cuOffset dwarf.Offset) error {
+	// DW_AT_high_pc is an offset from DW_AT_low_pc since DWARF 4, and Ranges handles it
+	ranges, err := dwarfData.Ranges(entry)
+	if err != nil {
+		return err
+	}
+
+	name, _ := entry.Val(dwarf.AttrName).(string)
+	for _, r := range ranges {
+		idx.Funcs = append(idx.Funcs, funcRange{Name: name, LowPC: r[0], HighPC: r[1], Offset: entry.Offset, CUOffset: cuOffset})
+	}
+
+	return nil
+}
+
+// prepare builds lookup tables which are not saved in the cache.
+func (idx *symbolIndex) prepare(table *gosym.Table) {
+	idx.fileRows = make(map[string][]lineRow, len(idx.Files))
+	for _, row := range idx.Rows {
+		name := idx.Files[row.File]
+		idx.fileRows[name] = append(idx.fileRows[name], row)
+	}
+	for _, rows := range idx.fileRows {
+		slices.SortStableFunc(rows, func(a, b lineRow) int {
+			return cmp.Or(cmp.Compare(a.Line, b.Line), cmp.Compare(a.Addr, b.Addr))
+		})
+	}
+
+	idx.funcsByName = make(map[string]funcRange, len(idx.Funcs))
+	for _, f := range idx.Funcs {
+		if _, ok := idx.funcsByName[f.Name]; !ok {
+			idx.funcsByName[f.Name] = f
+		}
+	}
+
+	idx.gosymFuncs = make(map[string]*gosym.Func, len(table.Funcs))
+	for i := range table.Funcs {
+		fn := &table.Funcs[i]
+		idx.gosymFuncs[fn.Name] = fn
+	}
+}
+
+// rowsInRange returns rows whose address is in [start, end).
+func (idx *symbolIndex) rowsInRange(start, end uint64) []lineRow {
+	i, _ := slices.BinarySearchFunc(idx.Rows, start, func(r lineRow, addr uint64) int {
+		return cmp.Compare(r.Addr, addr)
+	})
+	j, _ := slices.BinarySearchFunc(idx.Rows, end, func(r lineRow, addr uint64) int {
+		return cmp.Compare(r.Addr, addr)
+	})
+
+	return idx.Rows[i:j]
+}
+
+// lineRows returns rows of the line in the file sorted by address.
+func (idx *symbolIndex) lineRows(file string, line int) []lineRow {
+	rows := idx.fileRows[file]
+	i, _ := slices.BinarySearchFunc(rows, line, func(r lineRow, line int) int {
+		return cmp.Compare(r.Line, line)
+	})
+	j, _ := slices.BinarySearchFunc(rows, line+1, func(r lineRow, line int) int {
+		return cmp.Compare(r.Line, line)
+	})
+
+	return rows[i:j]
+}
+
+// funcForPC returns the function which contains pc.
+func (idx *symbolIndex) funcForPC(pc uint64) (funcRange, bool) {
+	i, found := slices.BinarySearchFunc(idx.Funcs, pc, func(f funcRange, pc uint64) int {
+		return cmp.Compare(f.LowPC, pc)
+	})
+	if !found {
+		// function just before pc
+		i--
+	}
+	if i < 0 {
+		return funcRange{}, false
+	}
+
+	f := idx.Funcs[i]
+	if pc >= f.HighPC {
+		return funcRange{}, false
+	}
+
+	return f, true
+}
+
+// prologueEnd returns the address of prologue end of the function in [entry, end).
+func (idx *symbolIndex) prologueEnd(entry, end uint64) (uint64, bool) {
+	for _, row := range idx.rowsInRange(entry, end) {
+		if row.PrologueEnd {
+			return row.Addr, true
+		}
+	}
+
+	return 0, false
+}
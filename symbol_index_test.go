@@ -0,0 +1,139 @@
+package main
+
+import (
+	"debug/gosym"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/ksrnnb/godbg/logger"
+)
+
+var goTool struct {
+	once  sync.Once
+	st    *SymbolTable
+	funcs []*gosym.Func
+	err   error
+}
+
+// loadGoTool builds the go command with debug information, which is large enough to measure lookups,
+// and returns its symbol table after the index is ready. functions with line information are sampled.
+// it is loaded once because benchmarks are run several times to decide b.N.
+func loadGoTool(b *testing.B) (*SymbolTable, []*gosym.Func) {
+	b.Helper()
+
+	goTool.once.Do(func() {
+		goTool.st, goTool.funcs, goTool.err = buildGoTool(b)
+	})
+	if goTool.err != nil {
+		b.Fatal(goTool.err)
+	}
+
+	b.ResetTimer()
+	return goTool.st, goTool.funcs
+}
+
+func buildGoTool(b *testing.B) (*SymbolTable, []*gosym.Func, error) {
+	dir, err := os.MkdirTemp("", "godbg-bench")
+	if err != nil {
+		return nil, nil, err
+	}
+	// debug information is read into memory, so that the binary isn't needed after loading
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "go")
+	if out, err := exec.Command("go", "build", "-o", path, "cmd/go").CombinedOutput(); err != nil {
+		return nil, nil, fmt.Errorf("failed to build go command: %s\n%s", err, out)
+	}
+
+	// the index must be built instead of being loaded from the user's cache.
+	// it is set after go build, which uses the cache directory too.
+	b.Setenv("XDG_CACHE_HOME", dir)
+
+	st, err := NewSymbolTable(path, logger.NewLogger())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load symbol table: %s", err)
+	}
+	// the index is saved in the cache before the directory is removed
+	defer st.Close()
+
+	if _, err := st.waitIndex(); err != nil {
+		return nil, nil, err
+	}
+
+	var funcs []*gosym.Func
+	for i := range st.table.Funcs {
+		fn := &st.table.Funcs[i]
+		if i%64 != 0 || fn.Sym == nil {
+			continue
+		}
+		if file, _, _ := st.PCToLine(fn.Entry); file == "" {
+			continue
+		}
+		funcs = append(funcs, fn)
+	}
+	if len(funcs) == 0 {
+		return nil, nil, errors.New("no functions are sampled")
+	}
+
+	return st, funcs, nil
+}
+
+func BenchmarkBuildSymbolIndex(b *testing.B) {
+	st, _ := loadGoTool(b)
+
+	for i := 0; i < b.N; i++ {
+		idx, err := buildSymbolIndex(st.dwarfData)
+		if err != nil {
+			b.Fatal(err)
+		}
+		idx.prepare(st.table)
+	}
+}
+
+func BenchmarkPCToLine(b *testing.B) {
+	st, funcs := loadGoTool(b)
+
+	for i := 0; i < b.N; i++ {
+		fn := funcs[i%len(funcs)]
+		if _, line, _ := st.PCToLine(fn.Entry); line == 0 {
+			b.Fatalf("no line for %s", fn.Name)
+		}
+	}
+}
+
+func BenchmarkLineToPC(b *testing.B) {
+	st, funcs := loadGoTool(b)
+
+	type location struct {
+		file string
+		line int
+	}
+	locations := make([]location, len(funcs))
+	for i, fn := range funcs {
+		file, line, _ := st.PCToLine(fn.Entry)
+		locations[i] = location{file, line}
+	}
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		l := locations[i%len(locations)]
+		// functions without prologue end are not the point here
+		st.GetNewStatementAddrByLine(l.file, l.line)
+	}
+}
+
+func BenchmarkLookupFunc(b *testing.B) {
+	st, funcs := loadGoTool(b)
+
+	for i := 0; i < b.N; i++ {
+		fn := funcs[i%len(funcs)]
+		if _, err := st.LookupFunc(fn.Name); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
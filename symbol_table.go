@@ -1,22 +1,61 @@
 package main
 
 import (
+	"cmp"
 	"debug/dwarf"
 	"debug/elf"
 	"debug/gosym"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"log/slog"
 	"math"
+	"path/filepath"
 	"slices"
+	"sync"
 
 	"github.com/ksrnnb/godbg/frame"
 )
 
 type SymbolTable struct {
+	// path of the binary, which instructions are read from while the process is not running
+	path             string
 	table            *gosym.Table
 	dwarfData        *dwarf.Data
 	runtimeETextAddr uint64
-	frameEntries     frame.FrameDescriptionEntries
+	locationLists    *frame.LocationLists
+	unitHeaders      []unitHeader
+	// function and object symbols sorted by address
+	symbols []elf.Symbol
+	// sections loaded in memory
+	sections []Section
+	logger   *slog.Logger
+
+	// link-time entry point, and whether the binary is position independent
+	entry uint64
+	pie   bool
+	// loadBias is added to link-time addresses to get runtime addresses
+	loadBias uint64
+	// link-time address of the dynamic section, or 0 if the binary is statically linked
+	dynamicAddr uint64
+
+	// .debug_frame is parsed when it is needed for the first time
+	debugFrame   []byte
+	frameOnce    sync.Once
+	frameEntries frame.FrameDescriptionEntries
+
+	// index is built or loaded from the cache in background, and indexReady is closed when it is done
+	indexReady chan struct{}
+	index      *symbolIndex
+	indexErr   error
+	// loadDone is closed when the index is saved in the cache
+	loadDone chan struct{}
+}
+
+type Section struct {
+	Name  string
+	Start uint64
+	End   uint64
 }
 
 type Variable struct {
@@ -24,6 +63,12 @@ type Variable struct {
 	Address uint64
 	Name    string
 	Type    string
+	// Pieces is the location of variable which is not in memory (e.g. register or optimized out).
+	// if Pieces is nil, the variable is at Address.
+	Pieces    []frame.Piece
+	dwarfType dwarf.Type
+	// err is why the location of the variable can't be evaluated, which is returned when it is read
+	err error
 }
 
 // section is described in the elf format document.
@@ -31,37 +76,62 @@ type Variable struct {
 //
 // you can see how to use gosym in pclntab_test
 // @see https://cs.opensource.google/go/go/+/refs/tags/go1.22.5:src/debug/gosym/pclntab_test.go;l=86
-func NewSymbolTable(debugeePath string) (*SymbolTable, error) {
+func NewSymbolTable(debugeePath string, logger *slog.Logger) (*SymbolTable, error) {
 	f, err := elf.Open(debugeePath)
 	if err != nil {
 		return nil, err
 	}
 	defer f.Close()
 
-	var runtimeETextAddr uint64
+	var runtimeTextAddr, runtimeETextAddr uint64
+	var addrSymbols []elf.Symbol
 	symbols, _ := f.Symbols()
 	for _, s := range symbols {
 		if s.Name == "runtime.etext" {
 			runtimeETextAddr = s.Value
 		}
+		if s.Name == "runtime.text" {
+			runtimeTextAddr = s.Value
+		}
+
+		typ := elf.ST_TYPE(s.Info)
+		if (typ == elf.STT_FUNC || typ == elf.STT_OBJECT) && s.Value != 0 {
+			addrSymbols = append(addrSymbols, s)
+		}
 	}
+	slices.SortFunc(addrSymbols, func(a, b elf.Symbol) int {
+		return cmp.Compare(a.Value, b.Value)
+	})
 
-	s := f.Section(".gosymtab")
-	if s == nil {
-		return nil, errors.New(".gosymtab section is not found")
+	var sections []Section
+	for _, section := range f.Sections {
+		if section.Flags&elf.SHF_ALLOC == 0 || section.Addr == 0 {
+			continue
+		}
+		sections = append(sections, Section{Name: section.Name, Start: section.Addr, End: section.Addr + section.Size})
 	}
 
-	symdata, err := s.Data()
-	if err != nil {
-		return nil, err
+	symdata := sectionData(f, ".gosymtab")
+
+	// shared objects which are not built by Go don't have .gopclntab
+	pclnSection := f.Section(".gopclntab")
+	textSection := f.Section(".text")
+	if pclnSection == nil || textSection == nil {
+		return nil, errors.New(".gopclntab section is not found")
 	}
 
-	pclndata, err := f.Section(".gopclntab").Data()
+	pclndata, err := pclnSection.Data()
 	if err != nil {
 		return nil, err
 	}
 
-	pcln := gosym.NewLineTable(pclndata, f.Section(".text").Addr)
+	// functions in pclntab are relative to runtime.text, which is not the start of .text in shared objects
+	textAddr := textSection.Addr
+	if runtimeTextAddr != 0 {
+		textAddr = runtimeTextAddr
+	}
+
+	pcln := gosym.NewLineTable(pclndata, textAddr)
 
 	table, err := gosym.NewTable(symdata, pcln)
 
@@ -82,290 +152,707 @@ func NewSymbolTable(debugeePath string) (*SymbolTable, error) {
 	if err != nil {
 		return nil, err
 	}
-	frameEntries := frame.Parse(debugFrame)
 
-	return &SymbolTable{
+	var dynamicAddr uint64
+	for _, p := range f.Progs {
+		if p.Type == elf.PT_DYNAMIC {
+			dynamicAddr = p.Vaddr
+		}
+	}
+
+	// location lists are in .debug_loc until DWARF 4 and .debug_loclists since DWARF 5
+	locationLists := frame.NewLocationLists(sectionData(f, ".debug_loc"), sectionData(f, ".debug_loclists"), sectionData(f, ".debug_addr"))
+	unitHeaders := parseUnitHeaders(sectionData(f, ".debug_info"))
+
+	st := &SymbolTable{
+		path:             debugeePath,
 		table:            table,
 		dwarfData:        dwarfData,
 		runtimeETextAddr: runtimeETextAddr,
-		frameEntries:     frameEntries,
-	}, nil
-}
+		locationLists:    locationLists,
+		unitHeaders:      unitHeaders,
+		symbols:          addrSymbols,
+		sections:         sections,
+		logger:           logger,
+		entry:            f.Entry,
+		pie:              f.Type == elf.ET_DYN,
+		dynamicAddr:      dynamicAddr,
+		debugFrame:       debugFrame,
+		indexReady:       make(chan struct{}),
+		loadDone:         make(chan struct{}),
+	}
 
-func (st *SymbolTable) PCToLine(pc uint64) (file string, line int, fn *gosym.Func) {
-	return st.table.PCToLine(pc)
-}
+	// commands which don't need the index can be used while indexing
+	go st.loadIndex(buildID(f))
 
-func (st *SymbolTable) PCToFunc(pc uint64) *gosym.Func {
-	return st.table.PCToFunc(pc)
+	return st, nil
 }
 
-func (st *SymbolTable) LookupFunc(funcname string) (*gosym.Func, error) {
-	fn := st.table.LookupFunc(funcname)
-	if fn == nil {
-		return nil, fmt.Errorf("failed to look up function: %s", funcname)
+// newEmptySymbolTable returns the symbol table of a program which is not built by Go.
+// it has no functions, lines or types, so that the process can be only run, stopped, detached or killed.
+func newEmptySymbolTable(logger *slog.Logger) *SymbolTable {
+	st := &SymbolTable{
+		table:      &gosym.Table{},
+		logger:     logger,
+		indexReady: make(chan struct{}),
+		indexErr:   errors.New("the program has no debug information of Go"),
+		loadDone:   make(chan struct{}),
 	}
+	close(st.indexReady)
+	close(st.loadDone)
 
-	return fn, nil
+	return st
 }
 
-func (st *SymbolTable) GetPrologueEndAddress(fn *gosym.Func) (uint64, error) {
-	reader := st.dwarfData.Reader()
-	for {
-		entry, err := reader.Next()
+// loadIndex loads the index from the cache for the build ID, or builds it and saves it in the cache.
+func (st *SymbolTable) loadIndex(buildID string) {
+	defer close(st.loadDone)
+
+	var cachePath string
+	if buildID != "" {
+		path, err := symbolCachePath(buildID)
 		if err != nil {
-			break
+			st.logger.Debug("symbol cache is not available", "error", err)
 		}
+		cachePath = path
+	}
 
-		if entry.Tag != dwarf.TagCompileUnit {
-			continue
+	if cachePath != "" {
+		idx, err := loadSymbolIndex(cachePath)
+		if err == nil {
+			idx.prepare(st.table)
+			st.index = idx
+			close(st.indexReady)
+			return
 		}
+		st.logger.Debug("failed to load symbol cache", "error", err)
+	}
 
-		lineReader, err := st.dwarfData.LineReader(entry)
-		if err != nil {
-			return 0, err
+	idx, err := buildSymbolIndex(st.dwarfData)
+	if err != nil {
+		st.indexErr = fmt.Errorf("failed to index debug information: %s", err)
+		close(st.indexReady)
+		return
+	}
+	idx.prepare(st.table)
+	st.index = idx
+	close(st.indexReady)
+
+	if cachePath != "" {
+		if err := saveSymbolIndex(cachePath, idx); err != nil {
+			st.logger.Debug("failed to save symbol cache", "error", err)
 		}
+		if err := pruneSymbolCache(filepath.Dir(cachePath), symbolCacheMaxEntries); err != nil {
+			st.logger.Debug("failed to prune symbol cache", "error", err)
+		}
+	}
+}
 
-		var lineEntry dwarf.LineEntry
-		for {
-			if err := lineReader.Next(&lineEntry); err != nil {
-				break
-			}
+// Close waits for the cache to be saved so that the cache is not left partially written.
+func (st *SymbolTable) Close() {
+	<-st.loadDone
+}
 
-			if lineEntry.Address == fn.Entry {
-				for err := lineReader.Next(&lineEntry); err == nil; {
-					if lineEntry.PrologueEnd {
-						return lineEntry.Address, nil
-					}
-				}
-			}
-		}
+// waitIndex blocks until the index is available.
+func (st *SymbolTable) waitIndex() (*symbolIndex, error) {
+	<-st.indexReady
+	return st.index, st.indexErr
+}
 
-	}
+// fdeForPC returns FDE which covers pc, parsing .debug_frame at first.
+func (st *SymbolTable) fdeForPC(pc uint64) (*frame.FrameDescriptionEntry, error) {
+	st.frameOnce.Do(func() {
+		st.frameEntries = frame.Parse(st.debugFrame)
+	})
 
-	return 0, fmt.Errorf("faield to get prologue end address for function %s", fn.Name)
+	return st.frameEntries.FDEForPC(pc)
 }
 
-func (st *SymbolTable) GetNewStatementAddrByLine(filename string, line int) (uint64, error) {
-	addr, fn, err := st.table.LineToPC(filename, line)
+// sectionData returns data of the section, or nil if the section doesn't exist.
+func sectionData(f *elf.File, name string) []byte {
+	s := f.Section(name)
+	if s == nil {
+		return nil
+	}
+
+	data, err := s.Data()
 	if err != nil {
-		return 0, fmt.Errorf("failed to get addr by filename %s and line %d: %s", filename, line, err)
+		return nil
 	}
 
-	reader := st.dwarfData.Reader()
-	for {
-		entry, err := reader.Next()
-		if err != nil {
-			break
-		}
+	return data
+}
+
+// SetLoadBias sets the difference between the address where the binary is loaded and the link-time address.
+// addresses given to and returned by SymbolTable are runtime addresses, so they are translated by the bias.
+func (st *SymbolTable) SetLoadBias(bias uint64) {
+	st.loadBias = bias
+}
+
+// IsPIE returns true if the binary is position independent, so that it may be loaded at a random address.
+func (st *SymbolTable) IsPIE() bool {
+	return st.pie
+}
+
+// Entry returns the link-time entry point of the binary.
+func (st *SymbolTable) Entry() uint64 {
+	return st.entry
+}
+
+// DynamicAddress returns the runtime address of the dynamic section.
+func (st *SymbolTable) DynamicAddress() (uint64, bool) {
+	if st.dynamicAddr == 0 {
+		return 0, false
+	}
+
+	return st.toRuntimeAddr(st.dynamicAddr), true
+}
+
+// ContainsPC returns true if pc is in a function of the binary.
+func (st *SymbolTable) ContainsPC(pc uint64) bool {
+	return st.table.PCToFunc(st.toLinkAddr(pc)) != nil
+}
+
+// toLinkAddr translates runtime address to link-time address.
+func (st *SymbolTable) toLinkAddr(addr uint64) uint64 {
+	return addr - st.loadBias
+}
+
+// toRuntimeAddr translates link-time address to runtime address.
+func (st *SymbolTable) toRuntimeAddr(addr uint64) uint64 {
+	return addr + st.loadBias
+}
+
+// relocateFunc returns the copy of fn whose addresses are runtime addresses.
+func (st *SymbolTable) relocateFunc(fn *gosym.Func) *gosym.Func {
+	if fn == nil || st.loadBias == 0 {
+		return fn
+	}
+
+	relocated := *fn
+	relocated.Entry = st.toRuntimeAddr(fn.Entry)
+	relocated.End = st.toRuntimeAddr(fn.End)
+
+	return &relocated
+}
+
+// ReadCode reads at most size bytes at the runtime address addr from the executable section of the binary.
+func (st *SymbolTable) ReadCode(addr uint64, size int) ([]byte, error) {
+	f, err := elf.Open(st.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
 
-		if entry.Tag != dwarf.TagCompileUnit {
+	linkAddr := st.toLinkAddr(addr)
+	for _, section := range f.Sections {
+		if section.Flags&elf.SHF_EXECINSTR == 0 || linkAddr < section.Addr || linkAddr >= section.Addr+section.Size {
 			continue
 		}
 
-		lineReader, err := st.dwarfData.LineReader(entry)
-		if err != nil {
-			return 0, err
+		data := make([]byte, min(uint64(size), section.Addr+section.Size-linkAddr))
+		if _, err := section.ReadAt(data, int64(linkAddr-section.Addr)); err != nil {
+			return nil, fmt.Errorf("failed to read %s of %s: %s", section.Name, st.path, err)
 		}
+		return data, nil
+	}
 
-		var lineEntry dwarf.LineEntry
+	return nil, fmt.Errorf("0x%x is not in executable sections of %s", addr, st.path)
+}
 
-		for {
-			if err := lineReader.Next(&lineEntry); err != nil {
-				break
-			}
+func (st *SymbolTable) PCToLine(pc uint64) (file string, line int, fn *gosym.Func) {
+	file, line, fn = st.table.PCToLine(st.toLinkAddr(pc))
+	return file, line, st.relocateFunc(fn)
+}
 
-			if lineEntry.File.Name != filename {
-				continue
-			}
+func (st *SymbolTable) PCToFunc(pc uint64) *gosym.Func {
+	return st.relocateFunc(st.table.PCToFunc(st.toLinkAddr(pc)))
+}
 
-			if lineEntry.Address == addr && lineEntry.IsStmt {
-				if lineEntry.Address != fn.Entry {
-					return lineEntry.Address, nil
-				}
-
-				// if address is func entry, it is not prologue end
-				for err := lineReader.Next(&lineEntry); err == nil; {
-					if lineEntry.PrologueEnd {
-						return lineEntry.Address, nil
-					}
-				}
-			}
+func (st *SymbolTable) LookupFunc(funcname string) (*gosym.Func, error) {
+	index, err := st.waitIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	fn, ok := index.gosymFuncs[funcname]
+	if !ok {
+		return nil, fmt.Errorf("failed to look up function: %s", funcname)
+	}
+
+	return st.relocateFunc(fn), nil
+}
+
+// LookupSymbolByAddr returns function or global variable symbol which contains addr.
+func (st *SymbolTable) LookupSymbolByAddr(addr uint64) (name string, offset uint64, ok bool) {
+	addr = st.toLinkAddr(addr)
+	i, found := slices.BinarySearchFunc(st.symbols, addr, func(s elf.Symbol, addr uint64) int {
+		return cmp.Compare(s.Value, addr)
+	})
+	if !found {
+		// symbol just before addr
+		i--
+	}
+	if i < 0 {
+		return "", 0, false
+	}
+
+	s := st.symbols[i]
+	if addr-s.Value >= max(s.Size, 1) {
+		return "", 0, false
+	}
+
+	return s.Name, addr - s.Value, true
+}
+
+// LookupSymbolByName returns the address of function or global variable symbol.
+func (st *SymbolTable) LookupSymbolByName(name string) (uint64, error) {
+	for _, s := range st.symbols {
+		if s.Name == name {
+			return st.toRuntimeAddr(s.Value), nil
 		}
 	}
 
-	return 0, fmt.Errorf("failed to get NS addr for file %s and line %d", filename, line)
+	return 0, fmt.Errorf("failed to look up symbol: %s", name)
 }
 
-func (st *SymbolTable) GetCurrentFuncLowPCAndHighPC(pc uint64) (lowPC uint64, highPC uint64, err error) {
+// LookupType returns the type of the name (e.g. runtime.g) in debug information.
+func (st *SymbolTable) LookupType(name string) (dwarf.Type, error) {
+	if st.dwarfData == nil {
+		return nil, fmt.Errorf("type %s is not found", name)
+	}
+
 	reader := st.dwarfData.Reader()
-	for {
-		entry, err := reader.Next()
+	for entry, err := reader.Next(); entry != nil; entry, err = reader.Next() {
 		if err != nil {
-			break
-		}
-
-		if entry == nil {
-			break
+			return nil, err
 		}
 
-		if entry.Tag != dwarf.TagSubprogram {
+		// types are children of compile units
+		if entry.Tag == dwarf.TagCompileUnit {
 			continue
 		}
 
-		lowPC, _ = entry.Val(dwarf.AttrLowpc).(uint64)
-		highPC, _ = entry.Val(dwarf.AttrHighpc).(uint64)
+		switch entry.Tag {
+		case dwarf.TagStructType, dwarf.TagTypedef, dwarf.TagBaseType:
+			if n, _ := entry.Val(dwarf.AttrName).(string); n == name {
+				return st.dwarfData.Type(entry.Offset)
+			}
+		}
 
-		if pc >= lowPC && pc <= highPC {
-			return lowPC, highPC, nil
+		if entry.Children {
+			reader.SkipChildren()
 		}
 	}
 
-	return 0, 0, nil
+	return nil, fmt.Errorf("type %s is not found", name)
 }
 
-func (st *SymbolTable) GetCurrentFuncStartToEndLine(pc uint64) (startLine int, endLine int, err error) {
-	filename, _, _ := st.PCToLine(pc)
-	lowPC, highPC, err := st.GetCurrentFuncLowPCAndHighPC(pc)
+// Sections returns ELF sections which are loaded in memory.
+func (st *SymbolTable) Sections() []Section {
+	sections := make([]Section, 0, len(st.sections))
+	for _, s := range st.sections {
+		sections = append(sections, Section{Name: s.Name, Start: st.toRuntimeAddr(s.Start), End: st.toRuntimeAddr(s.End)})
+	}
+
+	return sections
+}
+
+// Files returns source files in the line number programs.
+func (st *SymbolTable) Files() ([]string, error) {
+	index, err := st.waitIndex()
 	if err != nil {
-		return 0, 0, err
+		return nil, err
 	}
 
-	reader := st.dwarfData.Reader()
-	for {
-		entry, err := reader.Next()
-		if err != nil {
-			break
-		}
+	return index.Files, nil
+}
 
-		if entry == nil {
-			break
-		}
+func (st *SymbolTable) GetPrologueEndAddress(fn *gosym.Func) (uint64, error) {
+	index, err := st.waitIndex()
+	if err != nil {
+		return 0, err
+	}
+
+	addr, ok := index.prologueEnd(st.toLinkAddr(fn.Entry), st.toLinkAddr(fn.End))
+	if !ok {
+		return 0, fmt.Errorf("faield to get prologue end address for function %s", fn.Name)
+	}
 
-		if entry.Tag != dwarf.TagCompileUnit {
+	return st.toRuntimeAddr(addr), nil
+}
+
+func (st *SymbolTable) GetNewStatementAddrByLine(filename string, line int) (uint64, error) {
+	index, err := st.waitIndex()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, row := range index.lineRows(filename, line) {
+		if !row.IsStmt {
 			continue
 		}
 
-		lineReader, err := st.dwarfData.LineReader(entry)
-		if err != nil {
-			return 0, 0, err
+		fn := st.table.PCToFunc(row.Addr)
+		if fn == nil || row.Addr != fn.Entry {
+			return st.toRuntimeAddr(row.Addr), nil
 		}
 
-		var lineEntry dwarf.LineEntry
+		// if address is func entry, it is not prologue end
+		addr, ok := index.prologueEnd(fn.Entry, fn.End)
+		if !ok {
+			return 0, fmt.Errorf("faield to get prologue end address for function %s", fn.Name)
+		}
 
-		startLine = math.MaxInt
-		endLine = -1
+		return st.toRuntimeAddr(addr), nil
+	}
 
-		for {
-			if err := lineReader.Next(&lineEntry); err != nil {
-				break
-			}
+	return 0, fmt.Errorf("failed to get NS addr for file %s and line %d", filename, line)
+}
 
-			if lineEntry.File.Name != filename {
-				continue
-			}
+func (st *SymbolTable) GetCurrentFuncLowPCAndHighPC(pc uint64) (lowPC uint64, highPC uint64, err error) {
+	index, err := st.waitIndex()
+	if err != nil {
+		return 0, 0, err
+	}
 
-			if !lineEntry.IsStmt {
-				continue
-			}
+	f, ok := index.funcForPC(st.toLinkAddr(pc))
+	if !ok {
+		return 0, 0, nil
+	}
 
-			if lineEntry.Address >= lowPC && lineEntry.Address <= highPC {
-				if lineEntry.Line < startLine {
-					startLine = lineEntry.Line
-				}
+	return st.toRuntimeAddr(f.LowPC), st.toRuntimeAddr(f.HighPC), nil
+}
 
-				if lineEntry.Line > endLine {
-					endLine = lineEntry.Line
-				}
-			}
-		}
+func (st *SymbolTable) GetCurrentFuncStartToEndLine(pc uint64) (startLine int, endLine int, err error) {
+	filename, _, _ := st.PCToLine(pc)
+	lowPC, highPC, err := st.GetCurrentFuncLowPCAndHighPC(pc)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// the index is already available because GetCurrentFuncLowPCAndHighPC waited for it
+	index := st.index
 
-		if startLine != math.MaxInt {
-			return startLine, endLine, nil
+	startLine = math.MaxInt
+	endLine = -1
+	for _, row := range index.rowsInRange(st.toLinkAddr(lowPC), st.toLinkAddr(highPC)) {
+		if index.Files[row.File] != filename || !row.IsStmt {
+			continue
 		}
+
+		startLine = min(startLine, row.Line)
+		endLine = max(endLine, row.Line)
 	}
 
-	return 0, 0, fmt.Errorf("failed to find start line and end line for pc %0x", pc)
+	if startLine == math.MaxInt {
+		return 0, 0, fmt.Errorf("failed to find start line and end line for pc %0x", pc)
+	}
+
+	return startLine, endLine, nil
 }
 
 func (st *SymbolTable) GetFuncInfo(pc uint64) (funcName string, filename string, line int) {
-	filename, line, fn := st.table.PCToLine(pc)
+	filename, line, fn := st.table.PCToLine(st.toLinkAddr(pc))
 
 	return fn.Name, filename, line
 }
 
 func (st *SymbolTable) GetRuntimeETextAddress() uint64 {
-	return st.runtimeETextAddr
+	return st.toRuntimeAddr(st.runtimeETextAddr)
+}
+
+// GetVariables returns local variables and arguments of the function for pc.
+// variables in lexical blocks which don't contain pc are excluded.
+func (st *SymbolTable) GetVariables(pc uint64, regs frame.Registers, readMemory frame.MemoryReader) ([]Variable, error) {
+	return st.getFunctionVariables(pc, regs, readMemory, func(entry *dwarf.Entry) bool {
+		if entry.Tag == dwarf.TagVariable {
+			return true
+		}
+
+		isResult, _ := entry.Val(dwarf.AttrVarParam).(bool)
+		return entry.Tag == dwarf.TagFormalParameter && !isResult
+	})
+}
+
+// GetReturnValues returns results of the function for pc.
+// Go compiler emits results as DW_TAG_formal_parameter with DW_AT_variable_parameter (e.g. ~r0).
+func (st *SymbolTable) GetReturnValues(pc uint64, regs frame.Registers, readMemory frame.MemoryReader) ([]Variable, error) {
+	return st.getFunctionVariables(pc, regs, readMemory, func(entry *dwarf.Entry) bool {
+		isResult, _ := entry.Val(dwarf.AttrVarParam).(bool)
+		return entry.Tag == dwarf.TagFormalParameter && isResult
+	})
 }
 
-func (st *SymbolTable) GetVariables(pc uint64, sp uint64) (variables []Variable, err error) {
-	reader, err := st.seekToFunction(pc)
+func (st *SymbolTable) getFunctionVariables(pc uint64, regs frame.Registers, readMemory frame.MemoryReader, filter func(*dwarf.Entry) bool) (variables []Variable, err error) {
+	// debug information is described by link-time addresses
+	pc = st.toLinkAddr(pc)
+
+	reader, cu, fn, err := st.seekToFunction(pc)
 	if err != nil {
 		return nil, err
 	}
 
-	for entry, err := reader.Next(); entry != nil; entry, err = reader.Next() {
+	ectx := frame.EvalContext{Regs: regs, ReadMemory: readMemory}
+	unit := st.locationListUnit(cu)
+	ectx.Address = func(index uint64) (uint64, error) {
+		return st.locationLists.Address(unit, index)
+	}
+	fde, err := st.fdeForPC(pc)
+	if err == nil {
+		sp, err := regs.DwarfRegister(DwarfRegRsp)
 		if err != nil {
 			return nil, err
 		}
 
-		if entry.Tag == dwarf.TagVariable {
-			name, _ := entry.Val(dwarf.AttrName).(string)
+		fctx := fde.EstablishFrame(pc)
+		ectx.CFA = fctx.CFAOffset() + int64(binary.LittleEndian.Uint64(sp))
+	}
 
-			instructions, _ := entry.Val(dwarf.AttrLocation).([]byte)
+	// frame base is evaluated only for variables which use DW_OP_fbreg, so that the others are listed
+	// even if it can't be evaluated (e.g. C functions which have only .eh_frame)
+	baseCtx := ectx
+	ectx.FrameBase = sync.OnceValues(func() (int64, error) {
+		return st.frameBase(cu, fn, pc, baseCtx)
+	})
 
-			offset, _ := entry.Val(dwarf.AttrType).(dwarf.Offset)
+	depth := 1
+	for entry, err := reader.Next(); entry != nil; entry, err = reader.Next() {
+		if err != nil {
+			return nil, err
+		}
 
-			t, err := st.dwarfData.Type(offset)
-			if err != nil {
-				return nil, err
+		// end of children
+		if entry.Tag == 0 {
+			depth--
+			if depth == 0 {
+				break
 			}
+			continue
+		}
 
-			// TODO: get arbitrary variables and specify scope
-			targets := []string{"foo", "bar", "baz"}
-			if slices.Contains(targets, name) {
-				fde, err := st.frameEntries.FDEForPC(pc)
-				var cfa int64
-				if err == nil {
-					fctx := fde.EstablishFrame(pc)
-					cfa = fctx.CFAOffset() + int64(sp)
-				}
-				addr, err := frame.ExecuteStackProgram(cfa, instructions)
-				if err != nil {
-					return nil, err
-				}
-
-				variables = append(variables, Variable{Name: name, Address: uint64(addr), Type: t.String()})
+		if entry.Tag == dwarf.TagLexDwarfBlock && entry.Children {
+			if st.entryContainsPC(entry, pc) {
+				depth++
+			} else {
+				reader.SkipChildren()
 			}
+			continue
 		}
+
+		if entry.Children {
+			reader.SkipChildren()
+		}
+
+		if !filter(entry) {
+			continue
+		}
+
+		variables = append(variables, st.newVariable(cu, entry, pc, ectx))
 	}
 
 	return variables, nil
 }
 
-func (st *SymbolTable) seekToFunction(pc uint64) (*dwarf.Reader, error) {
-	reader := st.dwarfData.Reader()
-	reader.Seek(0)
+// newVariable returns the variable of entry at pc. if its type or location can't be evaluated,
+// the error is kept in the variable, so that the other variables are still listed.
+func (st *SymbolTable) newVariable(cu *dwarf.Entry, entry *dwarf.Entry, pc uint64, ectx frame.EvalContext) Variable {
+	name, _ := entry.Val(dwarf.AttrName).(string)
+	offset, _ := entry.Val(dwarf.AttrType).(dwarf.Offset)
 
-	for entry, err := reader.Next(); entry != nil; entry, err = reader.Next() {
+	t, err := st.dwarfData.Type(offset)
+	if err != nil {
+		return Variable{Name: name, err: fmt.Errorf("failed to read type of %s: %s", name, err)}
+	}
+
+	instructions, err := st.locationExpression(cu, entry, dwarf.AttrLocation, pc)
+	if err != nil {
+		return Variable{Name: name, Type: typeName(t), dwarfType: t, err: err}
+	}
+
+	addr, pieces, err := frame.ExecuteStackProgram(ectx, instructions)
+	if err != nil {
+		return Variable{Name: name, Type: typeName(t), dwarfType: t, err: fmt.Errorf("failed to evaluate location of %s: %s", name, err)}
+	}
+
+	return Variable{Name: name, Address: uint64(addr), Type: typeName(t), Pieces: pieces, dwarfType: t}
+}
+
+// frameBase evaluates DW_AT_frame_base of the function.
+// Go functions use DW_OP_call_frame_cfa, but C functions may use a register like DW_OP_reg6 (rbp).
+func (st *SymbolTable) frameBase(cu *dwarf.Entry, fn *dwarf.Entry, pc uint64, ectx frame.EvalContext) (int64, error) {
+	instructions, err := st.locationExpression(cu, fn, dwarf.AttrFrameBase, pc)
+	if err != nil {
+		return 0, err
+	}
+
+	if instructions == nil {
+		return 0, errors.New("frame base is not available")
+	}
+
+	addr, pieces, err := frame.ExecuteStackProgram(ectx, instructions)
+	if err != nil {
+		return 0, fmt.Errorf("failed to evaluate frame base: %s", err)
+	}
+
+	if len(pieces) == 0 {
+		return addr, nil
+	}
+
+	// frame base described by register location is the value of the register
+	switch p := pieces[0]; p.Kind {
+	case frame.RegPiece:
+		b, err := ectx.Regs.DwarfRegister(p.RegNum)
 		if err != nil {
-			return nil, err
+			return 0, err
 		}
+		return int64(binary.LittleEndian.Uint64(fitSize(b, 8))), nil
+	case frame.ImmPiece:
+		return int64(binary.LittleEndian.Uint64(fitSize(p.Value, 8))), nil
+	}
 
-		lowpc, ok := entry.Val(dwarf.AttrLowpc).(uint64)
-		if !ok {
-			continue
+	return 0, nil
+}
+
+// locationExpression returns the location attribute (e.g. DW_AT_location) of entry at pc.
+// the attribute is an expression, or a location list when the location changes in the function.
+func (st *SymbolTable) locationExpression(cu *dwarf.Entry, entry *dwarf.Entry, attr dwarf.Attr, pc uint64) ([]byte, error) {
+	field := entry.AttrField(attr)
+	if field == nil {
+		return nil, nil
+	}
+
+	switch field.Class {
+	case dwarf.ClassExprLoc, dwarf.ClassBlock:
+		instructions, _ := field.Val.([]byte)
+		return instructions, nil
+	case dwarf.ClassLocListPtr:
+		offset, _ := field.Val.(int64)
+		return st.locationLists.FindByOffset(st.locationListUnit(cu), uint64(offset), pc)
+	case dwarf.ClassLocList:
+		index, _ := field.Val.(int64)
+		return st.locationLists.FindByIndex(st.locationListUnit(cu), uint64(index), pc)
+	}
+
+	return nil, fmt.Errorf("unexpected class of location %s", field.Class)
+}
+
+func (st *SymbolTable) locationListUnit(cu *dwarf.Entry) frame.LocationListUnit {
+	unit := frame.LocationListUnit{Version: st.unitVersion(cu.Offset)}
+	unit.BaseAddress, _ = cu.Val(dwarf.AttrLowpc).(uint64)
+
+	if addrBase, ok := cu.Val(dwarf.AttrAddrBase).(int64); ok {
+		unit.AddrBase = uint64(addrBase)
+	}
+	if loclistsBase, ok := cu.Val(dwarf.AttrLoclistsBase).(int64); ok {
+		unit.LoclistsBase = uint64(loclistsBase)
+	}
+
+	return unit
+}
+
+// unitVersion returns DWARF version of the unit which contains offset.
+func (st *SymbolTable) unitVersion(offset dwarf.Offset) int {
+	version := 4
+	for _, h := range st.unitHeaders {
+		if h.offset > offset {
+			break
 		}
+		version = h.version
+	}
 
-		highpc, ok := entry.Val(dwarf.AttrHighpc).(uint64)
-		if !ok {
-			continue
+	return version
+}
+
+func (st *SymbolTable) entryContainsPC(entry *dwarf.Entry, pc uint64) bool {
+	ranges, err := st.dwarfData.Ranges(entry)
+	if err != nil {
+		return false
+	}
+
+	for _, r := range ranges {
+		if r[0] <= pc && pc < r[1] {
+			return true
 		}
+	}
+
+	return false
+}
+
+// seekToFunction returns reader which points to the first child of the function for pc,
+// and the entries of compile unit and function.
+func (st *SymbolTable) seekToFunction(pc uint64) (reader *dwarf.Reader, cu *dwarf.Entry, fn *dwarf.Entry, err error) {
+	index, err := st.waitIndex()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	f, ok := index.funcForPC(pc)
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("faield to seek to function for pc: %x", pc)
+	}
+
+	return st.seekToEntry(f)
+}
+
+// seekToFunctionByName is the same as seekToFunction, but looks up the function by name.
+func (st *SymbolTable) seekToFunctionByName(name string) (reader *dwarf.Reader, cu *dwarf.Entry, fn *dwarf.Entry, err error) {
+	index, err := st.waitIndex()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	f, ok := index.funcsByName[name]
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("faield to seek to function: %s", name)
+	}
 
-		if lowpc <= pc && highpc > pc {
-			return reader, nil
+	return st.seekToEntry(f)
+}
+
+func (st *SymbolTable) seekToEntry(f funcRange) (reader *dwarf.Reader, cu *dwarf.Entry, fn *dwarf.Entry, err error) {
+	reader = st.dwarfData.Reader()
+
+	reader.Seek(f.CUOffset)
+	cu, err = reader.Next()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	reader.Seek(f.Offset)
+	fn, err = reader.Next()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return reader, cu, fn, nil
+}
+
+type unitHeader struct {
+	offset  dwarf.Offset
+	version int
+}
+
+// parseUnitHeaders reads offset and version of each unit in .debug_info.
+func parseUnitHeaders(debugInfo []byte) []unitHeader {
+	var headers []unitHeader
+	for off := uint64(0); off+6 < uint64(len(debugInfo)); {
+		length := uint64(binary.LittleEndian.Uint32(debugInfo[off:]))
+		headerSize := uint64(4)
+		// 64-bit DWARF format
+		if length == 0xffffffff {
+			if off+14 > uint64(len(debugInfo)) {
+				break
+			}
+			length = binary.LittleEndian.Uint64(debugInfo[off+4:])
+			headerSize = 12
 		}
+
+		version := binary.LittleEndian.Uint16(debugInfo[off+headerSize:])
+		headers = append(headers, unitHeader{offset: dwarf.Offset(off), version: int(version)})
+
+		off += headerSize + length
 	}
 
-	return nil, fmt.Errorf("faield to seek to function for pc: %x", pc)
+	return headers
 }
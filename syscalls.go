@@ -0,0 +1,677 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ksrnnb/godbg/proc"
+	sys "golang.org/x/sys/unix"
+)
+
+// strings and buffers of system calls are printed up to this length
+const maxSyscallStringLength = 64
+
+// syscallCatch is system calls caught by catch command, which is kept after restart.
+type syscallCatch struct {
+	// numbers of system calls, or empty for all system calls
+	numbers []int
+	// if false, system calls are printed without stopping the process
+	stop bool
+}
+
+// syscallSignature is the name and the kinds of arguments of a system call, one letter for each argument.
+//
+//	d: 32 bit signed decimal (e.g. file descriptors)
+//	l: 64 bit signed decimal (e.g. file offsets of off_t and loff_t)
+//	u: unsigned decimal (e.g. sizes)
+//	x: hexadecimal (e.g. pointers and flags)
+//	o: octal (e.g. file modes)
+//	s: NUL terminated string (e.g. paths)
+//	b: buffer whose length is the next argument, which is read on entry (e.g. write)
+//	B: buffer whose length is the return value, which is read on exit (e.g. read)
+type syscallSignature struct {
+	name string
+	args string
+}
+
+// syscallSignatures are system calls of linux/amd64 by number.
+// you can see numbers by "cat /usr/include/x86_64-linux-gnu/asm/unistd_64.h"
+var syscallSignatures = map[int]syscallSignature{
+	0:   {"read", "dBu"},
+	1:   {"write", "dbu"},
+	2:   {"open", "sxo"},
+	3:   {"close", "d"},
+	4:   {"stat", "sx"},
+	5:   {"fstat", "dx"},
+	6:   {"lstat", "sx"},
+	7:   {"poll", "xud"},
+	8:   {"lseek", "dld"},
+	9:   {"mmap", "xuxxdl"},
+	10:  {"mprotect", "xux"},
+	11:  {"munmap", "xu"},
+	12:  {"brk", "x"},
+	13:  {"rt_sigaction", "dxxu"},
+	14:  {"rt_sigprocmask", "dxxu"},
+	15:  {"rt_sigreturn", ""},
+	16:  {"ioctl", "dxx"},
+	17:  {"pread64", "dBul"},
+	18:  {"pwrite64", "dbul"},
+	19:  {"readv", "dxd"},
+	20:  {"writev", "dxd"},
+	21:  {"access", "sx"},
+	22:  {"pipe", "x"},
+	23:  {"select", "dxxxx"},
+	24:  {"sched_yield", ""},
+	25:  {"mremap", "xuuxx"},
+	26:  {"msync", "xux"},
+	27:  {"mincore", "xux"},
+	28:  {"madvise", "xud"},
+	29:  {"shmget", "xux"},
+	30:  {"shmat", "dxx"},
+	31:  {"shmctl", "ddx"},
+	32:  {"dup", "d"},
+	33:  {"dup2", "dd"},
+	34:  {"pause", ""},
+	35:  {"nanosleep", "xx"},
+	36:  {"getitimer", "dx"},
+	37:  {"alarm", "u"},
+	38:  {"setitimer", "dxx"},
+	39:  {"getpid", ""},
+	40:  {"sendfile", "ddxu"},
+	41:  {"socket", "ddd"},
+	42:  {"connect", "dxu"},
+	43:  {"accept", "dxx"},
+	44:  {"sendto", "dbuxxu"},
+	45:  {"recvfrom", "dBuxxx"},
+	46:  {"sendmsg", "dxx"},
+	47:  {"recvmsg", "dxx"},
+	48:  {"shutdown", "dd"},
+	49:  {"bind", "dxu"},
+	50:  {"listen", "dd"},
+	51:  {"getsockname", "dxx"},
+	52:  {"getpeername", "dxx"},
+	53:  {"socketpair", "dddx"},
+	54:  {"setsockopt", "dddxu"},
+	55:  {"getsockopt", "dddxx"},
+	56:  {"clone", "xxxxx"},
+	57:  {"fork", ""},
+	58:  {"vfork", ""},
+	59:  {"execve", "sxx"},
+	60:  {"exit", "d"},
+	61:  {"wait4", "dxxx"},
+	62:  {"kill", "dd"},
+	63:  {"uname", "x"},
+	64:  {"semget", "xdx"},
+	65:  {"semop", "dxu"},
+	66:  {"semctl", "dddx"},
+	67:  {"shmdt", "x"},
+	68:  {"msgget", "xx"},
+	69:  {"msgsnd", "dxux"},
+	70:  {"msgrcv", "dxudx"},
+	71:  {"msgctl", "ddx"},
+	72:  {"fcntl", "ddx"},
+	73:  {"flock", "dd"},
+	74:  {"fsync", "d"},
+	75:  {"fdatasync", "d"},
+	76:  {"truncate", "sl"},
+	77:  {"ftruncate", "dl"},
+	78:  {"getdents", "dxu"},
+	79:  {"getcwd", "xu"},
+	80:  {"chdir", "s"},
+	81:  {"fchdir", "d"},
+	82:  {"rename", "ss"},
+	83:  {"mkdir", "so"},
+	84:  {"rmdir", "s"},
+	85:  {"creat", "so"},
+	86:  {"link", "ss"},
+	87:  {"unlink", "s"},
+	88:  {"symlink", "ss"},
+	89:  {"readlink", "sxu"},
+	90:  {"chmod", "so"},
+	91:  {"fchmod", "do"},
+	92:  {"chown", "sdd"},
+	93:  {"fchown", "ddd"},
+	94:  {"lchown", "sdd"},
+	95:  {"umask", "o"},
+	96:  {"gettimeofday", "xx"},
+	97:  {"getrlimit", "dx"},
+	98:  {"getrusage", "dx"},
+	99:  {"sysinfo", "x"},
+	100: {"times", "x"},
+	101: {"ptrace", "ddxx"},
+	102: {"getuid", ""},
+	103: {"syslog", "dxd"},
+	104: {"getgid", ""},
+	105: {"setuid", "d"},
+	106: {"setgid", "d"},
+	107: {"geteuid", ""},
+	108: {"getegid", ""},
+	109: {"setpgid", "dd"},
+	110: {"getppid", ""},
+	111: {"getpgrp", ""},
+	112: {"setsid", ""},
+	113: {"setreuid", "dd"},
+	114: {"setregid", "dd"},
+	115: {"getgroups", "dx"},
+	116: {"setgroups", "dx"},
+	117: {"setresuid", "ddd"},
+	118: {"getresuid", "xxx"},
+	119: {"setresgid", "ddd"},
+	120: {"getresgid", "xxx"},
+	121: {"getpgid", "d"},
+	122: {"setfsuid", "d"},
+	123: {"setfsgid", "d"},
+	124: {"getsid", "d"},
+	125: {"capget", "xx"},
+	126: {"capset", "xx"},
+	127: {"rt_sigpending", "xu"},
+	128: {"rt_sigtimedwait", "xxxu"},
+	129: {"rt_sigqueueinfo", "ddx"},
+	130: {"rt_sigsuspend", "xu"},
+	131: {"sigaltstack", "xx"},
+	132: {"utime", "sx"},
+	133: {"mknod", "sox"},
+	134: {"uselib", "s"},
+	135: {"personality", "x"},
+	136: {"ustat", "xx"},
+	137: {"statfs", "sx"},
+	138: {"fstatfs", "dx"},
+	139: {"sysfs", "dxx"},
+	140: {"getpriority", "dd"},
+	141: {"setpriority", "ddd"},
+	142: {"sched_setparam", "dx"},
+	143: {"sched_getparam", "dx"},
+	144: {"sched_setscheduler", "ddx"},
+	145: {"sched_getscheduler", "d"},
+	146: {"sched_get_priority_max", "d"},
+	147: {"sched_get_priority_min", "d"},
+	148: {"sched_rr_get_interval", "dx"},
+	149: {"mlock", "xu"},
+	150: {"munlock", "xu"},
+	151: {"mlockall", "x"},
+	152: {"munlockall", ""},
+	153: {"vhangup", ""},
+	154: {"modify_ldt", "dxu"},
+	155: {"pivot_root", "ss"},
+	156: {"_sysctl", "x"},
+	157: {"prctl", "dxxxx"},
+	158: {"arch_prctl", "dx"},
+	159: {"adjtimex", "x"},
+	160: {"setrlimit", "dx"},
+	161: {"chroot", "s"},
+	162: {"sync", ""},
+	163: {"acct", "s"},
+	164: {"settimeofday", "xx"},
+	165: {"mount", "sssxx"},
+	166: {"umount2", "sx"},
+	167: {"swapon", "sx"},
+	168: {"swapoff", "s"},
+	169: {"reboot", "xxdx"},
+	170: {"sethostname", "bu"},
+	171: {"setdomainname", "bu"},
+	172: {"iopl", "d"},
+	173: {"ioperm", "uud"},
+	174: {"create_module", ""},
+	175: {"init_module", "xus"},
+	176: {"delete_module", "sx"},
+	177: {"get_kernel_syms", ""},
+	178: {"query_module", ""},
+	179: {"quotactl", "xsdx"},
+	180: {"nfsservctl", ""},
+	181: {"getpmsg", ""},
+	182: {"putpmsg", ""},
+	183: {"afs_syscall", ""},
+	184: {"tuxcall", ""},
+	185: {"security", ""},
+	186: {"gettid", ""},
+	187: {"readahead", "dlu"},
+	188: {"setxattr", "ssbux"},
+	189: {"lsetxattr", "ssbux"},
+	190: {"fsetxattr", "dsbux"},
+	191: {"getxattr", "ssBu"},
+	192: {"lgetxattr", "ssBu"},
+	193: {"fgetxattr", "dsBu"},
+	194: {"listxattr", "sxu"},
+	195: {"llistxattr", "sxu"},
+	196: {"flistxattr", "dxu"},
+	197: {"removexattr", "ss"},
+	198: {"lremovexattr", "ss"},
+	199: {"fremovexattr", "ds"},
+	200: {"tkill", "dd"},
+	201: {"time", "x"},
+	202: {"futex", "xddxxd"},
+	203: {"sched_setaffinity", "dux"},
+	204: {"sched_getaffinity", "dux"},
+	205: {"set_thread_area", "x"},
+	206: {"io_setup", "ux"},
+	207: {"io_destroy", "x"},
+	208: {"io_getevents", "xddxx"},
+	209: {"io_submit", "xdx"},
+	210: {"io_cancel", "xxx"},
+	211: {"get_thread_area", "x"},
+	212: {"lookup_dcookie", "xxu"},
+	213: {"epoll_create", "d"},
+	214: {"epoll_ctl_old", ""},
+	215: {"epoll_wait_old", ""},
+	216: {"remap_file_pages", "xuxxx"},
+	217: {"getdents64", "dxu"},
+	218: {"set_tid_address", "x"},
+	219: {"restart_syscall", ""},
+	220: {"semtimedop", "dxux"},
+	221: {"fadvise64", "dlud"},
+	222: {"timer_create", "dxx"},
+	223: {"timer_settime", "xdxx"},
+	224: {"timer_gettime", "xx"},
+	225: {"timer_getoverrun", "x"},
+	226: {"timer_delete", "x"},
+	227: {"clock_settime", "dx"},
+	228: {"clock_gettime", "dx"},
+	229: {"clock_getres", "dx"},
+	230: {"clock_nanosleep", "ddxx"},
+	231: {"exit_group", "d"},
+	232: {"epoll_wait", "dxdd"},
+	233: {"epoll_ctl", "dddx"},
+	234: {"tgkill", "ddd"},
+	235: {"utimes", "sx"},
+	236: {"vserver", ""},
+	237: {"mbind", "xudxux"},
+	238: {"set_mempolicy", "dxu"},
+	239: {"get_mempolicy", "xxuxx"},
+	240: {"mq_open", "sdox"},
+	241: {"mq_unlink", "s"},
+	242: {"mq_timedsend", "dbuux"},
+	243: {"mq_timedreceive", "dBuxx"},
+	244: {"mq_notify", "dx"},
+	245: {"mq_getsetattr", "dxx"},
+	246: {"kexec_load", "xuxx"},
+	247: {"waitid", "ddxdx"},
+	248: {"add_key", "ssbud"},
+	249: {"request_key", "sssd"},
+	250: {"keyctl", "dxxxx"},
+	251: {"ioprio_set", "ddd"},
+	252: {"ioprio_get", "dd"},
+	253: {"inotify_init", ""},
+	254: {"inotify_add_watch", "dsx"},
+	255: {"inotify_rm_watch", "dd"},
+	256: {"migrate_pages", "duxx"},
+	257: {"openat", "dsxo"},
+	258: {"mkdirat", "dso"},
+	259: {"mknodat", "dsox"},
+	260: {"fchownat", "dsddx"},
+	261: {"futimesat", "dsx"},
+	262: {"newfstatat", "dsxx"},
+	263: {"unlinkat", "dsx"},
+	264: {"renameat", "dsds"},
+	265: {"linkat", "dsdsx"},
+	266: {"symlinkat", "sds"},
+	267: {"readlinkat", "dsxu"},
+	268: {"fchmodat", "dso"},
+	269: {"faccessat", "dsx"},
+	270: {"pselect6", "dxxxxx"},
+	271: {"ppoll", "xuxxu"},
+	272: {"unshare", "x"},
+	273: {"set_robust_list", "xu"},
+	274: {"get_robust_list", "dxx"},
+	275: {"splice", "dxdxux"},
+	276: {"tee", "ddux"},
+	277: {"sync_file_range", "dllx"},
+	278: {"vmsplice", "dxux"},
+	279: {"move_pages", "duxxxx"},
+	280: {"utimensat", "dsxx"},
+	281: {"epoll_pwait", "dxddxu"},
+	282: {"signalfd", "dxu"},
+	283: {"timerfd_create", "dx"},
+	284: {"eventfd", "u"},
+	285: {"fallocate", "dxll"},
+	286: {"timerfd_settime", "dxxx"},
+	287: {"timerfd_gettime", "dx"},
+	288: {"accept4", "dxxx"},
+	289: {"signalfd4", "dxux"},
+	290: {"eventfd2", "ux"},
+	291: {"epoll_create1", "x"},
+	292: {"dup3", "ddx"},
+	293: {"pipe2", "xx"},
+	294: {"inotify_init1", "x"},
+	295: {"preadv", "dxdld"},
+	296: {"pwritev", "dxdld"},
+	297: {"rt_tgsigqueueinfo", "dddx"},
+	298: {"perf_event_open", "xdddx"},
+	299: {"recvmmsg", "dxuxx"},
+	300: {"fanotify_init", "xx"},
+	301: {"fanotify_mark", "dxxds"},
+	302: {"prlimit64", "ddxx"},
+	303: {"name_to_handle_at", "dsxxx"},
+	304: {"open_by_handle_at", "dxx"},
+	305: {"clock_adjtime", "dx"},
+	306: {"syncfs", "d"},
+	307: {"sendmmsg", "dxux"},
+	308: {"setns", "dx"},
+	309: {"getcpu", "xxx"},
+	310: {"process_vm_readv", "dxuxux"},
+	311: {"process_vm_writev", "dxuxux"},
+	312: {"kcmp", "ddduu"},
+	313: {"finit_module", "dsx"},
+	314: {"sched_setattr", "dxx"},
+	315: {"sched_getattr", "dxux"},
+	316: {"renameat2", "dsdsx"},
+	317: {"seccomp", "xxx"},
+	318: {"getrandom", "Bux"},
+	319: {"memfd_create", "sx"},
+	320: {"kexec_file_load", "ddusx"},
+	321: {"bpf", "dxu"},
+	322: {"execveat", "dsxxx"},
+	323: {"userfaultfd", "x"},
+	324: {"membarrier", "dxd"},
+	325: {"mlock2", "xux"},
+	326: {"copy_file_range", "dxdxux"},
+	327: {"preadv2", "dxdldx"},
+	328: {"pwritev2", "dxdldx"},
+	329: {"pkey_mprotect", "xuxd"},
+	330: {"pkey_alloc", "xx"},
+	331: {"pkey_free", "d"},
+	332: {"statx", "dsxxx"},
+	333: {"io_pgetevents", "xddxxx"},
+	334: {"rseq", "xuxx"},
+	424: {"pidfd_send_signal", "ddxx"},
+	425: {"io_uring_setup", "ux"},
+	426: {"io_uring_enter", "duuxxu"},
+	427: {"io_uring_register", "duxu"},
+	428: {"open_tree", "dsx"},
+	429: {"move_mount", "dsdsx"},
+	430: {"fsopen", "sx"},
+	431: {"fsconfig", "ddsxd"},
+	432: {"fsmount", "dxx"},
+	433: {"fspick", "dsx"},
+	434: {"pidfd_open", "dx"},
+	435: {"clone3", "xu"},
+	436: {"close_range", "uux"},
+	437: {"openat2", "dsxu"},
+	438: {"pidfd_getfd", "ddx"},
+	439: {"faccessat2", "dsxx"},
+	440: {"process_madvise", "dxudx"},
+	441: {"epoll_pwait2", "dxdxxu"},
+	442: {"mount_setattr", "dsxxu"},
+	443: {"quotactl_fd", "duxx"},
+	444: {"landlock_create_ruleset", "xux"},
+	445: {"landlock_add_rule", "ddxx"},
+	446: {"landlock_restrict_self", "dx"},
+	447: {"memfd_secret", "x"},
+	448: {"process_mrelease", "dx"},
+	449: {"futex_waitv", "xuxxd"},
+	450: {"set_mempolicy_home_node", "xuux"},
+	451: {"cachestat", "dxxx"},
+	452: {"fchmodat2", "dsox"},
+	453: {"map_shadow_stack", "xux"},
+	454: {"futex_wake", "xxdx"},
+	455: {"futex_wait", "xxxxxd"},
+	456: {"futex_requeue", "xxdd"},
+	457: {"statmount", "xxux"},
+	458: {"listmount", "xxux"},
+	459: {"lsm_get_self_attr", "dxxx"},
+	460: {"lsm_set_self_attr", "dxux"},
+	461: {"lsm_list_modules", "xxx"},
+}
+
+// handleCatchCommand catches system calls like "catch syscall write openat", or all system calls without names.
+// "catch syscall nostop ..." prints them without stopping, and "catch syscall off" stops catching.
+func (d *Debugger) handleCatchCommand(args []string) error {
+	if len(args) == 0 {
+		d.printSyscallCatch()
+		return nil
+	}
+
+	if args[0] != "syscall" {
+		return fmt.Errorf("unknown catch event %s, which must be syscall", args[0])
+	}
+	args = args[1:]
+
+	if len(args) > 0 && args[0] == "off" {
+		d.syscallCatch = nil
+		d.target.StopCatchingSyscalls()
+		fmt.Fprintln(d.out, "system calls are not caught")
+		return nil
+	}
+
+	catch := &syscallCatch{stop: true}
+	if len(args) > 0 && args[0] == "nostop" {
+		catch.stop = false
+		args = args[1:]
+	}
+
+	for _, arg := range args {
+		nr, err := parseSyscall(arg)
+		if err != nil {
+			return err
+		}
+		catch.numbers = append(catch.numbers, nr)
+	}
+
+	d.syscallCatch = catch
+	d.target.CatchSyscalls(catch.numbers)
+
+	d.printSyscallCatch()
+	return nil
+}
+
+// printSyscallCatch prints system calls caught by catch command.
+func (d *Debugger) printSyscallCatch() {
+	if d.syscallCatch == nil {
+		fmt.Fprintln(d.out, "system calls are not caught")
+		return
+	}
+
+	names := "all system calls"
+	if len(d.syscallCatch.numbers) > 0 {
+		var s []string
+		for _, nr := range d.syscallCatch.numbers {
+			s = append(s, syscallName(nr))
+		}
+		names = strings.Join(s, ", ")
+	}
+
+	action := "stops"
+	if !d.syscallCatch.stop {
+		action = "doesn't stop"
+	}
+	fmt.Fprintf(d.out, "catch %s, and the process %s at entries and exits\n", names, action)
+}
+
+// applySyscallCatch catches system calls of catch command in the process.
+func (d *Debugger) applySyscallCatch(t *proc.Target) {
+	if d.syscallCatch != nil {
+		t.CatchSyscalls(d.syscallCatch.numbers)
+	}
+}
+
+// parseSyscall parses a system call like openat or 257.
+func parseSyscall(s string) (int, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		if _, ok := syscallSignatures[n]; !ok {
+			return 0, fmt.Errorf("unknown system call %d", n)
+		}
+		return n, nil
+	}
+
+	for nr, sig := range syscallSignatures {
+		if sig.name == s {
+			return nr, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown system call %s", s)
+}
+
+// syscallName returns the name of the system call, or its number if it is unknown.
+func syscallName(nr int) string {
+	if sig, ok := syscallSignatures[nr]; ok {
+		return sig.name
+	}
+
+	return fmt.Sprintf("syscall_%d", nr)
+}
+
+// printSyscall prints the system call which the current thread enters or exits,
+// and the Go function and the goroutine which call it.
+func (d *Debugger) printSyscall(sc proc.Syscall) {
+	s := d.formatSyscall(sc)
+	if sc.Exit {
+		s += " = " + formatSyscallReturn(sc.Return)
+	}
+
+	caller := ""
+	if frame, ok := d.syscallCaller(); ok {
+		caller = fmt.Sprintf(" in %s at %s:%d", frame.funcname, frame.filename, frame.line)
+	}
+	if id, ok := d.currentGoroutineID(); ok {
+		caller += fmt.Sprintf(", goroutine %d", id)
+	}
+
+	event := "entered"
+	if sc.Exit {
+		event = "returned"
+	}
+	fmt.Fprintf(d.out, "thread %d %s %s%s\n", d.target.Tid(), event, s, caller)
+}
+
+// formatSyscall formats the system call like `openat(-100, "/etc/hosts", 0x80000, 0)`.
+// buffers filled by the system call are read on exit.
+func (d *Debugger) formatSyscall(sc proc.Syscall) string {
+	sig, ok := syscallSignatures[sc.Number]
+	if !ok {
+		// arguments of unknown system calls are shown as they are
+		sig = syscallSignature{name: syscallName(sc.Number), args: "xxxxxx"}
+	}
+
+	args := make([]string, len(sig.args))
+	for i, kind := range sig.args {
+		v := sc.Args[i]
+		switch kind {
+		case 'd':
+			args[i] = strconv.FormatInt(int64(int32(v)), 10)
+		case 'l':
+			args[i] = strconv.FormatInt(int64(v), 10)
+		case 'u':
+			args[i] = strconv.FormatUint(v, 10)
+		case 'o':
+			args[i] = fmt.Sprintf("%#o", v)
+		case 's':
+			args[i] = d.readSyscallString(v)
+		case 'b':
+			length := uint64(0)
+			if i+1 < len(sc.Args) {
+				length = sc.Args[i+1]
+			}
+			args[i] = d.readSyscallBuffer(v, length)
+		case 'B':
+			// the buffer is filled when the system call returns
+			if sc.Exit && sc.Return >= 0 {
+				args[i] = d.readSyscallBuffer(v, uint64(sc.Return))
+			} else {
+				args[i] = fmt.Sprintf("%#x", v)
+			}
+		default:
+			args[i] = fmt.Sprintf("%#x", v)
+		}
+	}
+
+	return fmt.Sprintf("%s(%s)", sig.name, strings.Join(args, ", "))
+}
+
+// formatSyscallReturn formats the return value, which is -errno on failure.
+func formatSyscallReturn(ret int64) string {
+	// errno is 1 to 4095
+	if ret < 0 && ret >= -4095 {
+		errno := sys.Errno(-ret)
+		return fmt.Sprintf("-1 %s (%s)", sys.ErrnoName(errno), errno)
+	}
+
+	if ret < 0 || ret > 0xffff {
+		return fmt.Sprintf("0x%x", uint64(ret))
+	}
+
+	return strconv.FormatInt(ret, 10)
+}
+
+// readSyscallString reads NUL terminated string at addr, or returns the address if it can't be read.
+func (d *Debugger) readSyscallString(addr uint64) string {
+	if addr == 0 {
+		return "NULL"
+	}
+
+	var s []byte
+	// read by words not to cross the end of the mapping
+	for len(s) < maxSyscallStringLength {
+		b, err := d.target.ReadMemory(addr+uint64(len(s)), 8)
+		if err != nil {
+			return fmt.Sprintf("%#x", addr)
+		}
+
+		if i := slices.Index(b, 0); i >= 0 {
+			return strconv.Quote(string(append(s, b[:i]...)))
+		}
+		s = append(s, b...)
+	}
+
+	return strconv.Quote(string(s[:maxSyscallStringLength])) + "..."
+}
+
+// readSyscallBuffer reads the buffer of length at addr, or returns the address if it can't be read.
+func (d *Debugger) readSyscallBuffer(addr uint64, length uint64) string {
+	if addr == 0 {
+		return "NULL"
+	}
+
+	size := min(length, maxSyscallStringLength)
+	b, err := d.target.ReadMemory(addr, int(size))
+	if err != nil {
+		return fmt.Sprintf("%#x", addr)
+	}
+
+	s := strconv.Quote(string(b))
+	if length > size {
+		s += "..."
+	}
+
+	return s
+}
+
+// syscallCaller returns the frame of the Go function which issues the system call of the current thread.
+// functions of the standard library are skipped, so that the caller is a function of the program
+// (e.g. main.main instead of syscall.write), or the innermost function if the program doesn't call it.
+func (d *Debugger) syscallCaller() (stackFrame, bool) {
+	frames, err := d.currentStackFrames()
+	if err != nil || len(frames) == 0 {
+		return stackFrame{}, false
+	}
+
+	for _, frame := range frames {
+		if !isStandardFunction(frame.funcname) {
+			return frame, true
+		}
+	}
+
+	return frames[0], true
+}
+
+// isStandardFunction returns true if the function is in the standard library, whose import paths
+// don't have a dot in the first element unlike modules (e.g. os.(*File).Write and internal/poll.(*FD).Write).
+func isStandardFunction(funcname string) bool {
+	// the package path ends at the first dot after the last slash
+	pkg := funcname
+	if i := strings.LastIndex(pkg, "/"); i >= 0 {
+		if j := strings.Index(pkg[i:], "."); j >= 0 {
+			pkg = pkg[:i+j]
+		}
+	} else if j := strings.Index(pkg, "."); j >= 0 {
+		pkg = pkg[:j]
+	}
+
+	if pkg == "main" {
+		return false
+	}
+
+	first, _, _ := strings.Cut(pkg, "/")
+	return !strings.Contains(first, ".")
+}
@@ -0,0 +1,22 @@
+package main
+
+import "fmt"
+
+type point struct {
+	X, Y int
+	Name string
+}
+
+//go:noinline
+func greet(name string) string {
+	return "hello, " + name
+}
+
+//go:noinline
+func makePoint(name string) point {
+	return point{X: 1, Y: 2, Name: name}
+}
+
+func main() {
+	fmt.Println(greet("gopher"), makePoint("origin"))
+}
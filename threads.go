@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+)
+
+// printThreads prints where every thread of the process is. the current thread is marked by '*'.
+func (d *Debugger) printThreads() {
+	for _, th := range d.target.Threads() {
+		mark := " "
+		if th.Tid() == d.target.Tid() {
+			mark = "*"
+		}
+
+		pc, err := th.PC()
+		if err != nil {
+			fmt.Fprintf(d.out, "%s thread %d\t%s\n", mark, th.Tid(), err)
+			continue
+		}
+
+		location := "??"
+		if fn := d.symTableForPC(pc).PCToFunc(pc); fn != nil {
+			funcname, filename, line := d.symTableForPC(pc).GetFuncInfo(pc)
+			location = fmt.Sprintf("%s\t%s:%d", funcname, filename, line)
+		}
+
+		goroutine := ""
+		if id, ok := d.threadGoroutineID(threadRegisterClient(d.target, th.Tid())); ok {
+			goroutine = fmt.Sprintf("\tgoroutine %d", id)
+		}
+
+		fmt.Fprintf(d.out, "%s thread %d\t0x%x\t%s%s\n", mark, th.Tid(), pc, location, goroutine)
+	}
+}
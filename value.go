@@ -0,0 +1,337 @@
+package main
+
+import (
+	"debug/dwarf"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/ksrnnb/godbg/frame"
+)
+
+const (
+	optimizedOut = "<optimized out>"
+	// values larger than this are not read, and only their addresses are shown
+	maxValueSize = 1 << 16
+	// strings longer than this are truncated
+	maxStringLen = 256
+	// arrays and slices show this number of elements at most
+	maxElements = 64
+	// composite values nested deeper than this are elided
+	maxValueDepth = 4
+)
+
+// readVariable reads the value of variable from memory, registers or pieces of them.
+// regs are registers of the frame of the variable, which are unwound unless it is the innermost frame.
+func (d *Debugger) readVariable(v Variable, regs frame.Registers) (string, error) {
+	return formatVariable(v, regs, d.readMemoryBytes)
+}
+
+// formatVariable assembles the value of variable and formats it.
+// readMemory reads the variable in memory, and data which strings and slices point to.
+func formatVariable(v Variable, regs frame.Registers, readMemory frame.MemoryReader) (string, error) {
+	if v.err != nil {
+		return "", v.err
+	}
+
+	f := valueFormatter{readMemory: readMemory}
+	if v.Pieces == nil {
+		return f.readValue(v.Address, v.dwarfType)
+	}
+
+	size := int(v.dwarfType.Size())
+	var data []byte
+	for _, p := range v.Pieces {
+		pieceSize := p.Size
+		if pieceSize == 0 {
+			pieceSize = size - len(data)
+		}
+
+		switch p.Kind {
+		case frame.OptimizedOutPiece:
+			// partially optimized out variable can't be displayed
+			return optimizedOut, nil
+		case frame.AddrPiece:
+			b, err := readMemory(p.Addr, pieceSize)
+			if err != nil {
+				return "", err
+			}
+			data = append(data, b...)
+		case frame.RegPiece:
+			b, err := regs.DwarfRegister(p.RegNum)
+			if err != nil {
+				return "", err
+			}
+			data = append(data, fitSize(pieceBytes(b, p.Offset), pieceSize)...)
+		case frame.ImmPiece:
+			data = append(data, fitSize(pieceBytes(p.Value, p.Offset), pieceSize)...)
+		}
+	}
+
+	return f.format(data, v.dwarfType, 0), nil
+}
+
+// pieceBytes returns bytes of the register or the value from offset of the piece.
+func pieceBytes(b []byte, offset int) []byte {
+	if offset >= len(b) {
+		return nil
+	}
+	return b[offset:]
+}
+
+// valueFormatter formats values of Go types, reading memory which they refer to.
+type valueFormatter struct {
+	readMemory frame.MemoryReader
+}
+
+// readValue reads the value of type t at addr and formats it.
+func (f valueFormatter) readValue(addr uint64, t dwarf.Type) (string, error) {
+	size := t.Size()
+	if size < 0 || size > maxValueSize {
+		return fmt.Sprintf("(%s) 0x%x", typeName(t), addr), nil
+	}
+
+	var data []byte
+	if size > 0 {
+		b, err := f.readMemory(addr, int(size))
+		if err != nil {
+			return "", err
+		}
+		if len(b) < int(size) {
+			return "", fmt.Errorf("failed to read %d bytes at 0x%x", size, addr)
+		}
+		data = b
+	}
+
+	return f.format(data, t, 0), nil
+}
+
+// format formats data as type t. depth is the number of composite values which contain the value.
+func (f valueFormatter) format(data []byte, t dwarf.Type, depth int) string {
+	t = underlyingType(t)
+
+	size := t.Size()
+	if size < 0 || len(data) < int(size) {
+		return fmt.Sprintf("(%s) %x", typeName(t), data)
+	}
+
+	switch t := t.(type) {
+	case *dwarf.StructType:
+		switch {
+		case t.StructName == "string":
+			return f.formatString(data, t)
+		case strings.HasPrefix(t.StructName, "[]"):
+			return f.formatSlice(data, t, depth)
+		}
+		return f.formatStruct(data, t, depth)
+	case *dwarf.ArrayType:
+		return f.formatArray(data, t, depth)
+	}
+
+	return formatScalar(data, t)
+}
+
+// formatString reads the bytes of the string header, which is {str *uint8, len int}.
+func (f valueFormatter) formatString(data []byte, t *dwarf.StructType) string {
+	addr, okAddr := fieldUint(data, t, "str")
+	length, okLen := fieldUint(data, t, "len")
+	if !okAddr || !okLen {
+		return f.formatStruct(data, t, 0)
+	}
+
+	if length == 0 {
+		return `""`
+	}
+
+	n := min(length, maxStringLen)
+	b, err := f.readMemory(addr, int(n))
+	if err != nil {
+		return fmt.Sprintf("(string) <failed to read %d bytes at 0x%x: %s>", n, addr, err)
+	}
+
+	s := strconv.Quote(string(b))
+	if length > n {
+		s += fmt.Sprintf("...+%d more", length-n)
+	}
+
+	return s
+}
+
+// formatSlice reads elements of the slice header, which is {array *T, len int, cap int}.
+func (f valueFormatter) formatSlice(data []byte, t *dwarf.StructType, depth int) string {
+	addr, okAddr := fieldUint(data, t, "array")
+	length, okLen := fieldUint(data, t, "len")
+	capacity, okCap := fieldUint(data, t, "cap")
+	if !okAddr || !okLen || !okCap {
+		return f.formatStruct(data, t, depth)
+	}
+	_, array, _ := structField(t, "array")
+	ptr, ok := underlyingType(array).(*dwarf.PtrType)
+	if !ok {
+		return f.formatStruct(data, t, depth)
+	}
+
+	header := fmt.Sprintf("len: %d, cap: %d", length, capacity)
+	if length == 0 {
+		return header + ", []"
+	}
+	if depth >= maxValueDepth {
+		return header + ", [...]"
+	}
+
+	elemSize := ptr.Type.Size()
+	if elemSize <= 0 {
+		return header
+	}
+	n := min(length, maxElements, uint64(maxValueSize/elemSize))
+	b, err := f.readMemory(addr, int(n)*int(elemSize))
+	if err != nil {
+		return fmt.Sprintf("%s, <failed to read elements at 0x%x: %s>", header, addr, err)
+	}
+
+	return header + ", " + f.formatElements(b, ptr.Type, int(n), length-n, depth)
+}
+
+// formatArray formats elements of the array.
+func (f valueFormatter) formatArray(data []byte, t *dwarf.ArrayType, depth int) string {
+	if t.Count <= 0 {
+		return "[]"
+	}
+	if depth >= maxValueDepth {
+		return "[...]"
+	}
+
+	elemSize := t.Type.Size()
+	if elemSize <= 0 {
+		return fmt.Sprintf("(%s) %x", typeName(t), data)
+	}
+
+	n := min(t.Count, maxElements)
+	return f.formatElements(data, t.Type, int(n), uint64(t.Count-n), depth)
+}
+
+// formatElements formats n elements of type elem in data, and the number of elements which are not shown.
+func (f valueFormatter) formatElements(data []byte, elem dwarf.Type, n int, more uint64, depth int) string {
+	elemSize := int(elem.Size())
+
+	values := make([]string, 0, n+1)
+	for i := range n {
+		values = append(values, f.format(data[i*elemSize:(i+1)*elemSize], elem, depth+1))
+	}
+	if more > 0 {
+		values = append(values, fmt.Sprintf("...+%d more", more))
+	}
+
+	return "[" + strings.Join(values, ", ") + "]"
+}
+
+// formatStruct formats fields by their names. interfaces are shown as structs of the runtime, which have the type and the data pointer.
+func (f valueFormatter) formatStruct(data []byte, t *dwarf.StructType, depth int) string {
+	if depth >= maxValueDepth {
+		return "{...}"
+	}
+
+	fields := make([]string, 0, len(t.Field))
+	for _, field := range t.Field {
+		size := field.Type.Size()
+		if field.ByteOffset < 0 || size < 0 || field.ByteOffset+size > int64(len(data)) {
+			fields = append(fields, field.Name+": ?")
+			continue
+		}
+		value := f.format(data[field.ByteOffset:field.ByteOffset+size], field.Type, depth+1)
+		fields = append(fields, field.Name+": "+value)
+	}
+
+	return "{" + strings.Join(fields, ", ") + "}"
+}
+
+// formatScalar formats data as a scalar type t.
+func formatScalar(data []byte, t dwarf.Type) string {
+	size := t.Size()
+	if size <= 0 || size > 8 || len(data) < int(size) {
+		return fmt.Sprintf("(%s) %x", typeName(t), data)
+	}
+
+	raw := binary.LittleEndian.Uint64(fitSize(data[:size], 8))
+
+	switch t.(type) {
+	case *dwarf.IntType:
+		// sign extension
+		shift := 64 - 8*size
+		return fmt.Sprintf("%d", int64(raw<<shift)>>shift)
+	case *dwarf.UintType, *dwarf.UcharType, *dwarf.CharType:
+		return fmt.Sprintf("%d", raw)
+	case *dwarf.BoolType:
+		return fmt.Sprintf("%t", raw != 0)
+	case *dwarf.FloatType:
+		if size == 4 {
+			return fmt.Sprintf("%g", math.Float32frombits(uint32(raw)))
+		}
+		return fmt.Sprintf("%g", math.Float64frombits(raw))
+	case *dwarf.PtrType:
+		return fmt.Sprintf("0x%x", raw)
+	}
+
+	return fmt.Sprintf("(%s) 0x%x", typeName(t), raw)
+}
+
+// underlyingType unwraps typedefs.
+func underlyingType(t dwarf.Type) dwarf.Type {
+	for {
+		typedef, ok := t.(*dwarf.TypedefType)
+		if !ok {
+			return t
+		}
+		t = typedef.Type
+	}
+}
+
+// typeName returns the name of t in Go. String of dwarf.Type describes types like string and slices as structs,
+// and names of arrays and pointers are composed because debug/dwarf doesn't read them.
+func typeName(t dwarf.Type) string {
+	switch t := t.(type) {
+	case *dwarf.StructType:
+		if t.StructName != "" {
+			return t.StructName
+		}
+	case *dwarf.ArrayType:
+		return fmt.Sprintf("[%d]%s", t.Count, typeName(t.Type))
+	case *dwarf.PtrType:
+		if _, ok := t.Type.(*dwarf.VoidType); ok {
+			return "unsafe.Pointer"
+		}
+		return "*" + typeName(t.Type)
+	}
+
+	if name := t.Common().Name; name != "" {
+		return name
+	}
+
+	return t.String()
+}
+
+// fieldUint reads the field of integer or pointer of 8 bytes at most.
+func fieldUint(data []byte, t *dwarf.StructType, name string) (uint64, bool) {
+	offset, typ, err := structField(t, name)
+	if err != nil {
+		return 0, false
+	}
+
+	size := typ.Size()
+	if offset < 0 || size <= 0 || size > 8 || offset+size > int64(len(data)) {
+		return 0, false
+	}
+
+	return binary.LittleEndian.Uint64(fitSize(data[offset:offset+size], 8)), true
+}
+
+// fitSize truncates or zero-extends b to size bytes.
+func fitSize(b []byte, size int) []byte {
+	if len(b) >= size {
+		return b[:size]
+	}
+
+	return append(append([]byte{}, b...), make([]byte, size-len(b))...)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/ksrnnb/godbg/frame"
+	"github.com/ksrnnb/godbg/logger"
+)
+
+// fakeRegisters has values of DWARF registers.
+type fakeRegisters map[uint64]uint64
+
+func (r fakeRegisters) DwarfRegister(regnum uint64) ([]byte, error) {
+	v, ok := r[regnum]
+	if !ok {
+		return nil, fmt.Errorf("register %d is not available", regnum)
+	}
+
+	return binary.LittleEndian.AppendUint64(nil, v), nil
+}
+
+// TestFormatVariableFromRegisterPieces evaluates the string argument of main.greet at the entry of the optimized build,
+// where the pointer and the length of the string are pieces of the registers by the internal ABI.
+func TestFormatVariableFromRegisterPieces(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "values")
+	if out, err := exec.Command("go", "build", "-o", path, "./testdata/values").CombinedOutput(); err != nil {
+		t.Fatalf("failed to build: %s\n%s", err, out)
+	}
+
+	// the index must not be saved in the user's cache
+	t.Setenv("XDG_CACHE_HOME", dir)
+
+	st, err := NewSymbolTable(path, logger.NewLogger())
+	if err != nil {
+		t.Fatalf("failed to load symbol table: %s", err)
+	}
+	defer st.Close()
+
+	fn, err := st.LookupFunc("main.greet")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const dataAddr = 0x1000
+	// the string is passed in the first two integer registers
+	regs := fakeRegisters{abiIntRegisters[0]: dataAddr, abiIntRegisters[1]: 6, DwarfRegRsp: 0x7fff0000}
+	readMemory := func(addr uint64, size int) ([]byte, error) {
+		data := []byte("gopher")
+		if addr != dataAddr || size > len(data) {
+			return nil, fmt.Errorf("failed to read %d bytes at 0x%x", size, addr)
+		}
+		return data[:size], nil
+	}
+
+	variables, err := st.GetVariables(fn.Entry, regs, frame.MemoryReader(readMemory))
+	if err != nil {
+		t.Fatalf("failed to get variables: %s", err)
+	}
+
+	for _, v := range variables {
+		if v.Name != "name" {
+			continue
+		}
+
+		if len(v.Pieces) < 2 {
+			t.Fatalf("expected pieces of registers, but got %+v", v.Pieces)
+		}
+
+		value, err := formatVariable(v, regs, readMemory)
+		if err != nil {
+			t.Fatalf("failed to format %s: %s", v.Name, err)
+		}
+		if v.Type != "string" || value != `"gopher"` {
+			t.Fatalf(`expected name string = "gopher", but got %s %s = %s`, v.Name, v.Type, value)
+		}
+		return
+	}
+
+	t.Fatalf("name is not found in %+v", variables)
+}